@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/audit"
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/output"
+)
+
+// Audit prints the audit log, optionally limited to a repository, the SSH
+// user name clients gave and operations after since (a duration like 24h
+// or a date).
+func Audit(cfg *config.Config, repo, user, since string, format output.Format) error {
+	if cfg.AuditLog == "" {
+		return fmt.Errorf("audit log is disabled (set audit_log in the config)")
+	}
+
+	filter := audit.Filter{Repo: repo, SSHUser: user}
+	if since != "" {
+		t, err := parseLogTime(since)
+		if err != nil {
+			return err
+		}
+		filter.Since = t
+	}
+
+	records, err := audit.Read(cfg.AuditLog, filter)
+	if err != nil {
+		return err
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+
+	result := struct {
+		Records []audit.Record `json:"records"`
+	}{records}
+	return output.Print(os.Stdout, format, result, func() error {
+		return printAudit(records)
+	})
+}
+
+func printAudit(records []audit.Record) error {
+	if len(records) == 0 {
+		fmt.Println("No matching operations")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tREMOTE\tSSH USER\tREPO\tOP\tRESULT\tIN\tOUT\tDURATION\tDETAILS")
+	for _, rec := range records {
+		// Ref updates and errors go in the last column, one per line
+		var details []string
+		for _, ref := range rec.Refs {
+			detail := fmt.Sprintf("%s %s..%s", ref.Ref, shortID(ref.Old), shortID(ref.New))
+			if ref.Status == git.RefRejected {
+				detail += " rejected: " + ref.Reason
+			}
+			details = append(details, detail)
+		}
+		if rec.Error != "" {
+			details = append(details, "error: "+rec.Error)
+		}
+		if len(details) == 0 {
+			details = []string{""}
+		}
+
+		duration := (time.Duration(rec.DurationMS) * time.Millisecond).String()
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			rec.Time.Local().Format("2006-01-02 15:04:05"), rec.RemoteAddr, rec.SSHUser, rec.Repo,
+			rec.Operation, rec.Result, formatBytes(rec.BytesIn), formatBytes(rec.BytesOut), duration, details[0])
+		for _, detail := range details[1:] {
+			fmt.Fprintf(w, "\t\t\t\t\t\t\t\t\t%s\n", detail)
+		}
+	}
+	return w.Flush()
+}
+
+// shortID abbreviates an object ID, showing a missing object as "(none)".
+func shortID(id string) string {
+	if id == git.ZeroID {
+		return "(none)"
+	}
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -9,12 +9,29 @@ import (
 	"time"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
-func Backup(cfg *config.Config, repoName string) error {
-	// If no repo name provided, show interactive menu
+// BackupResult is the result of 'homegit backup'.
+type BackupResult struct {
+	Repo  string `json:"repo"`
+	File  string `json:"file"`
+	Bytes int64  `json:"bytes"`
+}
+
+func Backup(cfg *config.Config, repoName string, prompts Prompts, format output.Format) error {
+	// If no repo name provided, let the user pick one
 	if repoName == "" {
-		return backupInteractive(cfg)
+		if prompts.Yes || prompts.NonInteractive || format.Structured() {
+			return pickRequired("backup")
+		}
+		repos, err := getLocalRepoList(cfg.ReposDir)
+		if err != nil {
+			return err
+		}
+		if repoName, err = pickRepo("backup", repos); repoName == "" {
+			return err
+		}
 	}
 
 	if !strings.HasSuffix(repoName, ".git") {
@@ -23,59 +40,37 @@ func Backup(cfg *config.Config, repoName string) error {
 
 	repoPath := filepath.Join(cfg.ReposDir, repoName)
 	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return fmt.Errorf("repository not found: %s", repoName)
+		return repoNotFound(repoName)
 	}
 
-	return createBackup(cfg, repoName, repoPath)
-}
-
-func backupInteractive(cfg *config.Config) error {
-	entries, err := os.ReadDir(cfg.ReposDir)
-	if err != nil {
-		return fmt.Errorf("failed to read repos directory: %w", err)
-	}
-
-	repos := []string{}
-	for _, entry := range entries {
-		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".git") {
-			repos = append(repos, entry.Name())
+	if format.Structured() {
+		result, err := writeBackup(cfg, repoName)
+		if err != nil {
+			return err
 		}
+		return output.Print(os.Stdout, format, result, nil)
 	}
+	return createBackup(cfg, repoName)
+}
 
-	if len(repos) == 0 {
-		fmt.Println("No repositories found")
-		return nil
-	}
-
-	fmt.Println("Select a repository to backup:")
-	for i, repo := range repos {
-		fmt.Printf("  %d) %s\n", i+1, repo)
-	}
-	fmt.Printf("  0) Cancel\n\n")
-	fmt.Print("Enter number: ")
-
-	var choice int
-	_, err = fmt.Scanln(&choice)
-	if err != nil || choice < 0 || choice > len(repos) {
-		fmt.Println("Invalid selection")
-		return nil
-	}
-
-	if choice == 0 {
-		fmt.Println("Cancelled")
-		return nil
+func createBackup(cfg *config.Config, repoName string) error {
+	fmt.Printf("Creating backup of '%s'...\n", repoName)
+	result, err := writeBackup(cfg, repoName)
+	if err != nil {
+		return err
 	}
 
-	selectedRepo := repos[choice-1]
-	repoPath := filepath.Join(cfg.ReposDir, selectedRepo)
+	size := float64(result.Bytes) / 1024 / 1024 // Convert to MB
+	fmt.Printf("Backup created: %s (%.2f MB)\n", result.File, size)
 
-	return createBackup(cfg, selectedRepo, repoPath)
+	return nil
 }
 
-func createBackup(cfg *config.Config, repoName, repoPath string) error {
+// writeBackup archives repoName into the backup directory.
+func writeBackup(cfg *config.Config, repoName string) (*BackupResult, error) {
 	// Create backup directory if it doesn't exist
 	if err := os.MkdirAll(cfg.BackupDir, 0755); err != nil {
-		return fmt.Errorf("failed to create backup directory: %w", err)
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
 	}
 
 	// Generate backup filename with timestamp
@@ -83,22 +78,24 @@ func createBackup(cfg *config.Config, repoName, repoPath string) error {
 	baseName := strings.TrimSuffix(repoName, ".git")
 	backupFile := filepath.Join(cfg.BackupDir, fmt.Sprintf("%s-%s.tar.gz", baseName, timestamp))
 
-	fmt.Printf("Creating backup of '%s'...\n", repoName)
-
-	// Create tar.gz archive
-	cmd := exec.Command("tar", "-czf", backupFile, "-C", cfg.ReposDir, repoName)
+	// Create tar.gz archive, only giving it its final name once complete
+	// so a failed backup is never mistaken for a good one
+	partial := backupFile + ".partial"
+	cmd := exec.Command("tar", "-czf", partial, "-C", cfg.ReposDir, repoName)
 	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create backup: %w", err)
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+	if err := os.Rename(partial, backupFile); err != nil {
+		os.Remove(partial)
+		return nil, fmt.Errorf("failed to create backup: %w", err)
 	}
 
 	// Get file size
 	info, err := os.Stat(backupFile)
 	if err != nil {
-		return fmt.Errorf("failed to stat backup file: %w", err)
+		return nil, fmt.Errorf("failed to stat backup file: %w", err)
 	}
 
-	size := float64(info.Size()) / 1024 / 1024 // Convert to MB
-	fmt.Printf("Backup created: %s (%.2f MB)\n", backupFile, size)
-
-	return nil
+	return &BackupResult{Repo: repoName, File: backupFile, Bytes: info.Size()}, nil
 }
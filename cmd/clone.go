@@ -1,57 +1,63 @@
 package cmd
 
 import (
-	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/git"
 )
 
-func Clone(cfg *config.Config, repoName string) error {
-	// If no repo name provided, show interactive list
-	if repoName == "" {
-		repos, err := getRepoList(cfg)
-		if err != nil {
-			return err
-		}
+// Prompts controls whether a command may ask questions on the terminal.
+type Prompts struct {
+	Yes            bool // answer yes to confirmations
+	NonInteractive bool // fail instead of asking
+}
 
-		if len(repos) == 0 {
-			return fmt.Errorf("no repositories found")
-		}
+// pickRequired is the error for a command that would have to ask which
+// repository to use but may not prompt.
+func pickRequired(command string) error {
+	return fmt.Errorf("no repository given; run 'homegit %s <repo>' or drop --yes/--non-interactive to pick one", command)
+}
 
-		// Show interactive menu
-		fmt.Println("Available repositories:")
-		for i, repo := range repos {
-			fmt.Printf("  %d. %s\n", i+1, strings.TrimSuffix(repo, ".git"))
-		}
-		fmt.Print("\nSelect repository (number): ")
+// Clone clones repoName from the server of the given profile (empty for
+// the active one), offering a list to pick from if repoName is empty.
+func Clone(cfg *config.Config, profile, repoName string, prompts Prompts) error {
+	cfg, err := cfg.ForProfile(profile)
+	if err != nil {
+		return err
+	}
 
-		reader := bufio.NewReader(os.Stdin)
-		input, err := reader.ReadString('\n')
+	// If no repo name provided, let the user pick one
+	if repoName == "" {
+		if prompts.Yes || prompts.NonInteractive {
+			return pickRequired("clone")
+		}
+		repos, err := getRepoList(cfg)
 		if err != nil {
-			return fmt.Errorf("failed to read input: %w", err)
+			return err
 		}
-
-		choice, err := strconv.Atoi(strings.TrimSpace(input))
-		if err != nil || choice < 1 || choice > len(repos) {
-			return fmt.Errorf("invalid selection")
+		if repoName, err = pickRepo("clone", repos); repoName == "" {
+			return err
 		}
-
-		repoName = repos[choice-1]
 	}
 
 	if !strings.HasSuffix(repoName, ".git") {
 		repoName = repoName + ".git"
 	}
 
-	repoPath := filepath.Join(cfg.ReposDir, repoName)
-	if _, err := os.Stat(repoPath); os.IsNotExist(err) {
-		return fmt.Errorf("repository not found: %s", repoName)
+	// Another server's repos can only be checked by cloning them
+	if isLocalServer(cfg) {
+		repoPath := filepath.Join(cfg.ReposDir, repoName)
+		if _, err := os.Stat(repoPath); os.IsNotExist(err) {
+			return repoNotFound(repoName)
+		}
 	}
 
 	targetDir := strings.TrimSuffix(repoName, ".git")
@@ -65,8 +71,8 @@ func Clone(cfg *config.Config, repoName string) error {
 }
 
 func getRepoList(cfg *config.Config) ([]string, error) {
-	// If server_host is localhost, read local directory
-	if cfg.ServerHost == "localhost" || cfg.ServerHost == "127.0.0.1" {
+	// If the server is this machine's, read its directory
+	if isLocalServer(cfg) {
 		return getLocalRepoList(cfg.ReposDir)
 	}
 
@@ -79,32 +85,27 @@ func getLocalRepoList(reposDir string) ([]string, error) {
 		return nil, fmt.Errorf("failed to create repos directory: %w", err)
 	}
 
-	entries, err := os.ReadDir(reposDir)
+	repos, err := git.ListRepos(reposDir)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read repos directory: %w", err)
 	}
-
-	repos := []string{}
-	for _, entry := range entries {
-		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".git") {
-			repos = append(repos, entry.Name())
-		}
-	}
-
 	return repos, nil
 }
 
+// listReposCommand asks the server for its repositories over SSH.
+func listReposCommand(ctx context.Context, cfg *config.Config, sshOptions ...string) *exec.Cmd {
+	args := append(sshOptions, "-p", strconv.Itoa(cfg.Port), cfg.ServerHost, git.ListReposCommand)
+	return exec.CommandContext(ctx, "ssh", args...)
+}
+
 func getRemoteRepoList(cfg *config.Config) ([]string, error) {
-	// Use SSH to list repos on remote server
-	cmd := exec.Command("ssh", "-p", strconv.Itoa(cfg.Port), cfg.ServerHost, "ls", "-1", cfg.ReposDir)
-	output, err := cmd.Output()
+	output, err := listReposCommand(context.Background(), cfg).Output()
 	if err != nil {
-		return nil, fmt.Errorf("failed to list remote repos: %w", err)
+		return nil, fmt.Errorf("%w: failed to list repos on %s: %v", ErrUnreachable, cfg.ServerHost, err)
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
 	repos := []string{}
-	for _, line := range lines {
+	for _, line := range strings.Split(string(output), "\n") {
 		line = strings.TrimSpace(line)
 		if line != "" && strings.HasSuffix(line, ".git") {
 			repos = append(repos, line)
@@ -113,3 +114,26 @@ func getRemoteRepoList(cfg *config.Config) ([]string, error) {
 
 	return repos, nil
 }
+
+// RepoNames lists the server's repositories for shell completion, without
+// the ".git" suffix. It never prompts and gives up quickly on a server
+// that can't be reached.
+func RepoNames(cfg *config.Config) []string {
+	var output []byte
+	if isLocalServer(cfg) {
+		repos, _ := git.ListRepos(cfg.ReposDir)
+		output = []byte(strings.Join(repos, "\n"))
+	} else {
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		output, _ = listReposCommand(ctx, cfg, "-o", "BatchMode=yes", "-o", "ConnectTimeout=2").Output()
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if name, ok := strings.CutSuffix(strings.TrimSpace(line), ".git"); ok && name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
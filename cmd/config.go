@@ -1,17 +1,20 @@
 package cmd
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"text/tabwriter"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
-func Config() error {
-	home := config.GetHomeDir()
-	configPath := filepath.Join(home, ".homegit", "config")
+// ConfigEdit opens the config file in $EDITOR and validates it afterwards.
+func ConfigEdit() error {
+	configPath := config.Path()
 
 	// Ensure config exists
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
@@ -37,8 +40,181 @@ func Config() error {
 		return fmt.Errorf("failed to open editor: %w", err)
 	}
 
-	fmt.Println("\nConfig updated. Restart homegit for changes to take effect:")
+	// Point out mistakes while the edit is fresh
+	if _, err := config.Load(); err != nil {
+		fmt.Println()
+		printConfigProblems(err)
+		fmt.Println("\nFix them with: homegit config")
+		return nil
+	}
+
+	fmt.Println("\nConfig updated. A running server picks up most changes automatically.")
+	fmt.Println("Changing the port or host key requires a restart:")
 	fmt.Println("  homegit restart")
 
 	return nil
 }
+
+// ConfigValidate checks the config, including the server's directories,
+// which other commands don't need.
+func ConfigValidate() error {
+	cfg, err := config.Load()
+	if err == nil {
+		if problems := cfg.CheckDirs(); len(problems) > 0 {
+			err = &config.ValidationError{Path: config.Path(), Problems: append(cfg.Warnings(), problems...)}
+		}
+	}
+	if err != nil {
+		printConfigProblems(err)
+		return fmt.Errorf("config is invalid")
+	}
+	for _, w := range cfg.Warnings() {
+		fmt.Printf("warning: %s\n", w)
+	}
+	fmt.Printf("Config is valid: %s (version %d)\n", config.Path(), cfg.FileVersion())
+	if cfg.FileVersion() < config.CurrentVersion {
+		fmt.Printf("It is read as version %d; 'homegit config migrate' updates the file, as does starting the server\n", config.CurrentVersion)
+	}
+	return nil
+}
+
+// ConfigMigrate rewrites the config file in the current version, keeping
+// the original next to it.
+func ConfigMigrate() error {
+	from, backup, err := config.Migrate()
+	if err != nil {
+		return err
+	}
+	if backup == "" {
+		fmt.Printf("Config is already version %d: %s\n", from, config.Path())
+		return nil
+	}
+	fmt.Printf("✓ Migrated %s from version %d to %d\n", config.Path(), from, config.CurrentVersion)
+	fmt.Printf("  The previous file is saved as %s\n", backup)
+	return nil
+}
+
+// printConfigProblems lists each problem in a config load error.
+func printConfigProblems(err error) {
+	var invalid *config.ValidationError
+	if !errors.As(err, &invalid) {
+		fmt.Printf("error: %v\n", err)
+		return
+	}
+	for _, p := range invalid.Problems {
+		if p.Warning {
+			fmt.Printf("warning: %s\n", p)
+		} else {
+			fmt.Printf("error: %s\n", p)
+		}
+	}
+}
+
+// ConfigShow prints the config file, or with effective every resolved
+// setting and its source, with the replication secret redacted. The file
+// is JSON already; as YAML it is converted with its keys in the same
+// order.
+func ConfigShow(effective bool, format output.Format) error {
+	if effective {
+		return configShowEffective(format)
+	}
+	data, err := os.ReadFile(config.Path())
+	if err != nil {
+		return err
+	}
+	// A file that isn't valid JSON is shown as it is, to find the mistake
+	if redacted, err := config.RedactFile(data); err == nil {
+		data = redacted
+	}
+	if format == output.YAML {
+		if !json.Valid(data) {
+			return fmt.Errorf("%s is not valid JSON", config.Path())
+		}
+		return output.WriteYAML(os.Stdout, json.RawMessage(data))
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// EffectiveConfig is the result of 'homegit config show --effective'.
+type EffectiveConfig struct {
+	Path     string           `json:"path"`
+	Settings []config.Setting `json:"settings"`
+	Problems []config.Problem `json:"problems,omitempty"`
+}
+
+// configShowEffective prints every setting as resolved, with where its
+// value came from.
+func configShowEffective(format output.Format) error {
+	cfg, err := config.Load()
+	if cfg == nil {
+		return err
+	}
+	result := EffectiveConfig{Path: config.Path(), Settings: cfg.Settings(), Problems: cfg.Warnings()}
+	var invalid *config.ValidationError
+	if errors.As(err, &invalid) {
+		result.Problems = invalid.Problems
+	}
+
+	return output.Print(os.Stdout, format, result, func() error {
+		if err != nil {
+			printConfigProblems(err)
+			fmt.Println()
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "KEY\tVALUE\tSOURCE")
+		for _, s := range result.Settings {
+			source := s.Source
+			if source == config.SourceFile {
+				source = result.Path
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", s.Key, s.Value, source)
+		}
+		return w.Flush()
+	})
+}
+
+// ConfigGet prints the resolved value of one setting, including any
+// environment override, so scripts can read it.
+func ConfigGet(key string, format output.Format) error {
+	cfg, err := config.Load()
+	if cfg == nil {
+		return err
+	}
+	value, err := cfg.Get(key)
+	if err != nil {
+		return err
+	}
+	setting := config.Setting{Key: key, Value: value, Source: cfg.Source(key)}
+	return output.Print(os.Stdout, format, setting, func() error {
+		fmt.Println(value)
+		return nil
+	})
+}
+
+func ConfigSet(key, value string) error {
+	if err := config.SetInFile(key, value); err != nil {
+		return err
+	}
+	fmt.Printf("Set %s in %s\n", key, config.Path())
+	warnOverridden(key)
+	return nil
+}
+
+func ConfigUnset(key string) error {
+	if err := config.UnsetInFile(key); err != nil {
+		return err
+	}
+	fmt.Printf("Unset %s in %s, the default applies\n", key, config.Path())
+	warnOverridden(key)
+	return nil
+}
+
+// warnOverridden points out that the file setting just changed is
+// shadowed by an environment variable.
+func warnOverridden(key string) {
+	if env := config.EnvVar(key); os.Getenv(env) != "" {
+		fmt.Printf("Note: %s is set and overrides the config file\n", env)
+	}
+}
@@ -1,10 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
 	"github.com/chris-roerig/homegit/internal/daemon"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
 func Start(cfg *config.Config) error {
@@ -16,6 +20,7 @@ func Start(cfg *config.Config) error {
 }
 
 func Stop(cfg *config.Config) error {
+	fmt.Println("Stopping server...")
 	if err := daemon.Stop(cfg); err != nil {
 		return err
 	}
@@ -37,6 +42,81 @@ func Restart(cfg *config.Config) error {
 	return nil
 }
 
-func Status(cfg *config.Config) error {
-	return daemon.Status(cfg)
+func Reload(cfg *config.Config) error {
+	// The control socket reloads synchronously; signals are the fallback
+	err := control.Call(cfg.ControlSocket, control.MethodReload, nil, nil)
+	if err == nil {
+		fmt.Println("Server config reloaded")
+		return nil
+	}
+	if !errors.Is(err, control.ErrNotRunning) {
+		return err
+	}
+
+	if err := daemon.Reload(cfg); err != nil {
+		return err
+	}
+	fmt.Println("Server reloading config")
+	return nil
+}
+
+// Supervise runs the server under the crash-restarting supervisor. It is
+// what 'homegit start' launches in the background.
+func Supervise(cfg *config.Config) error {
+	return daemon.Supervise(cfg)
+}
+
+// StatusInfo is the result of 'homegit status'. With --verbose, Server
+// and Sessions are filled in from the running server's control socket.
+type StatusInfo struct {
+	daemon.State
+	Server   *control.Status   `json:"server,omitempty"`
+	Sessions []control.Session `json:"sessions,omitempty"`
+}
+
+// Status reports whether the server is running. It succeeds either way;
+// scripts read the state field.
+func Status(cfg *config.Config, verbose bool, format output.Format) error {
+	info := StatusInfo{State: daemon.GetState(cfg)}
+	var controlErr error
+	if verbose && info.State.State == daemon.StateRunning {
+		var status control.Status
+		controlErr = control.Call(cfg.ControlSocket, control.MethodStatus, nil, &status)
+		if controlErr == nil {
+			info.Server = &status
+			if status.Sessions > 0 {
+				if err := control.Call(cfg.ControlSocket, control.MethodSessions, nil, &info.Sessions); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return output.Print(os.Stdout, format, info, func() error {
+		if err := daemon.Status(cfg); err != nil {
+			return err
+		}
+		if !verbose || info.State.State != daemon.StateRunning {
+			return nil
+		}
+		if controlErr != nil {
+			fmt.Printf("\nControl socket not reachable at %s: %v\n", cfg.ControlSocket, controlErr)
+			return nil
+		}
+
+		status := info.Server
+		fmt.Println()
+		fmt.Printf("Version:      %s\n", status.Version)
+		fmt.Printf("PID:          %d\n", status.PID)
+		fmt.Printf("Uptime:       %s\n", status.Uptime)
+		fmt.Printf("Repos Dir:    %s\n", status.ReposDir)
+		fmt.Printf("Maintenance:  %s\n", onOff(status.Maintenance))
+		fmt.Printf("Sessions:     %d\n", status.Sessions)
+
+		if len(info.Sessions) > 0 {
+			fmt.Println()
+			printSessions(info.Sessions)
+		}
+		return nil
+	})
 }
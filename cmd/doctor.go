@@ -0,0 +1,317 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/daemon"
+	"github.com/chris-roerig/homegit/internal/health"
+	"github.com/chris-roerig/homegit/internal/hostkey"
+	"github.com/chris-roerig/homegit/internal/output"
+	"golang.org/x/crypto/ssh"
+)
+
+// DoctorReport is the result of 'homegit doctor'. Server is only
+// checked when the server runs on this machine.
+type DoctorReport struct {
+	Healthy bool            `json:"healthy"`
+	Server  []health.Result `json:"server,omitempty"`
+	Client  []health.Result `json:"client"`
+}
+
+// Doctor checks the server (when it runs on this machine) and the client
+// setup against the server of the given profile (empty for the active
+// one), printing a suggested fix for each problem. cfgErr is the error
+// from loading the config, if any.
+func Doctor(cfg *config.Config, cfgErr error, profile string, format output.Format) error {
+	var report DoctorReport
+	configResult := checkConfig(cfg, cfgErr)
+	if configResult.Status == health.Fail {
+		report.Client = []health.Result{configResult}
+		output.Print(os.Stdout, format, report, func() error {
+			printChecks("Client", report.Client)
+			return nil
+		})
+		return fmt.Errorf("config is invalid, fix it before running the other checks")
+	}
+	cfg, err := cfg.ForProfile(profile)
+	if err != nil {
+		return err
+	}
+
+	if isLocalServer(cfg) {
+		report.Server = append([]health.Result{checkServerRunning(cfg)}, health.Server(cfg.ReposDir, cfg.HostKeyFiles())...)
+	}
+	report.Client = []health.Result{configResult, checkReachable(cfg)}
+	if report.Client[1].Status != health.Fail {
+		report.Client = append(report.Client, checkHandshake(cfg))
+	}
+	if origin, ok := checkOrigin(cfg); ok {
+		report.Client = append(report.Client, origin)
+	}
+	failed := countFailed(report.Server) + countFailed(report.Client)
+	report.Healthy = failed == 0
+
+	err = output.Print(os.Stdout, format, report, func() error {
+		if report.Server != nil {
+			printChecks("Server", report.Server)
+			fmt.Println()
+		}
+		printChecks("Client", report.Client)
+		if report.Healthy {
+			fmt.Println("\nAll checks passed")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	return nil
+}
+
+// isLocalServer reports whether cfg's server is the one this machine's
+// config runs: its host resolves to an address of this machine and its
+// port is one the server listens on.
+func isLocalServer(cfg *config.Config) bool {
+	if !slices.Contains(listenPorts(cfg), strconv.Itoa(cfg.Port)) {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	resolved, err := net.DefaultResolver.LookupIPAddr(ctx, cfg.ServerHost)
+	if err != nil {
+		return false
+	}
+	local, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, ip := range resolved {
+		if ip.IP.IsLoopback() {
+			return true
+		}
+		for _, addr := range local {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip.IP) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// listenPorts returns the TCP ports the server listens on.
+func listenPorts(cfg *config.Config) []string {
+	var ports []string
+	for _, listen := range cfg.ListenAddrs() {
+		if strings.HasPrefix(listen, "unix:") {
+			continue
+		}
+		if _, port, err := net.SplitHostPort(listen); err == nil {
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+func countFailed(results []health.Result) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == health.Fail {
+			n++
+		}
+	}
+	return n
+}
+
+func printChecks(title string, results []health.Result) {
+	fmt.Printf("%s checks:\n", title)
+	for _, r := range results {
+		mark := "✓"
+		switch r.Status {
+		case health.Warn:
+			mark = "!"
+		case health.Fail:
+			mark = "✗"
+		}
+		fmt.Printf("  %s %-12s %s\n", mark, r.Name, r.Detail)
+		if r.Fix != "" {
+			fmt.Printf("    fix: %s\n", r.Fix)
+		}
+	}
+}
+
+func checkConfig(cfg *config.Config, cfgErr error) health.Result {
+	const name = "config"
+	if cfgErr != nil {
+		return health.Result{Name: name, Status: health.Fail, Detail: cfgErr.Error(),
+			Fix: "see 'homegit config validate' for details, then correct it with 'homegit config'"}
+	}
+	if warnings := cfg.Warnings(); len(warnings) > 0 {
+		return health.Result{Name: name, Status: health.Warn, Detail: warnings[0].String(),
+			Fix: "see 'homegit config validate' for details, then correct it with 'homegit config'"}
+	}
+	return health.Result{Name: name, Status: health.OK, Detail: config.Path()}
+}
+
+func checkServerRunning(cfg *config.Config) health.Result {
+	const name = "server"
+	if !daemon.IsRunning(cfg) {
+		return health.Result{Name: name, Status: health.Fail, Detail: "not running", Fix: "start it with 'homegit start'"}
+	}
+	return health.Result{Name: name, Status: health.OK, Detail: "running"}
+}
+
+func serverAddr(cfg *config.Config) string {
+	return net.JoinHostPort(cfg.ServerHost, strconv.Itoa(cfg.Port))
+}
+
+func checkReachable(cfg *config.Config) health.Result {
+	const name = "reachable"
+	addr := serverAddr(cfg)
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		fix := fmt.Sprintf("make sure homegit is running on %s ('homegit start' there), and that port %d is open in its firewall", cfg.ServerHost, cfg.Port)
+		return health.Result{Name: name, Status: health.Fail, Detail: fmt.Sprintf("cannot connect to %s: %v", addr, err), Fix: fix}
+	}
+	conn.Close()
+	return health.Result{Name: name, Status: health.OK, Detail: addr}
+}
+
+// checkHandshake connects over SSH and compares the server's host key with
+// the one pinned in known_hosts and, for a local server, the key on disk.
+func checkHandshake(cfg *config.Config) health.Result {
+	const name = "host key"
+	addr := serverAddr(cfg)
+
+	serverKey, err := fetchHostKey(addr)
+	if err != nil {
+		return health.Result{Name: name, Status: health.Fail, Detail: fmt.Sprintf("SSH handshake with %s failed: %v", addr, err),
+			Fix: "check that the process on that port is homegit and not another SSH server"}
+	}
+	fingerprint := ssh.FingerprintSHA256(serverKey)
+
+	if isLocalServer(cfg) {
+		for _, path := range cfg.HostKeyFiles() {
+			local, err := localHostKey(path)
+			if err != nil || local.Type() != serverKey.Type() {
+				continue
+			}
+			if !keysEqual(local, serverKey) {
+				return health.Result{Name: name, Status: health.Fail,
+					Detail: fmt.Sprintf("server presented %s but %s is %s", fingerprint, path, ssh.FingerprintSHA256(local)),
+					Fix:    "another process may be using the port; stop it or change port, then 'homegit restart'"}
+			}
+		}
+	}
+
+	knownHosts := hostkey.KnownHostsFile(config.GetHomeDir())
+	state, pinned, err := hostkey.Check(knownHosts, addr, serverKey)
+	switch {
+	case err != nil:
+		return health.Result{Name: name, Status: health.Warn, Detail: err.Error()}
+	case state == hostkey.Pinned:
+		return health.Result{Name: name, Status: health.OK, Detail: fingerprint + ", matches known_hosts"}
+	case state == hostkey.Changed:
+		changed := &hostkey.ChangedError{Addr: addr, Key: serverKey, Pinned: pinned}
+		return health.Result{Name: name, Status: health.Fail, Detail: changed.Error(),
+			Fix: fmt.Sprintf("if the server key was replaced on purpose, remove the old entry with %s, then 'homegit hostkey pin'; otherwise something else may be answering for the server", hostkey.RemoveCommand(addr))}
+	}
+	return health.Result{Name: name, Status: health.Warn, Detail: fingerprint + ", not pinned in known_hosts",
+		Fix: "pin it with 'homegit hostkey pin' after comparing it with 'homegit hostkey show' on the server"}
+}
+
+// fetchHostKey connects to the SSH server at addr and returns the host
+// key it presents.
+func fetchHostKey(addr string) (ssh.PublicKey, error) {
+	var serverKey ssh.PublicKey
+	clientCfg := &ssh.ClientConfig{
+		User: currentUser(),
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			serverKey = key
+			return nil
+		},
+		// Ask for the key the server advertises with mDNS
+		HostKeyAlgorithms: hostkey.Algorithms,
+		Timeout:           5 * time.Second,
+	}
+	client, err := ssh.Dial("tcp", addr, clientCfg)
+	if err != nil && serverKey == nil {
+		return nil, err
+	}
+	if client != nil {
+		client.Close()
+	}
+	return serverKey, nil
+}
+
+func localHostKey(path string) (ssh.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, err
+	}
+	return signer.PublicKey(), nil
+}
+
+func keysEqual(a, b ssh.PublicKey) bool {
+	return string(a.Marshal()) == string(b.Marshal())
+}
+
+func currentUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	return "git"
+}
+
+// checkOrigin reports whether the current directory's origin remote points
+// at the homegit server. ok is false outside a git repository.
+func checkOrigin(cfg *config.Config) (result health.Result, ok bool) {
+	const name = "origin"
+	out, err := exec.Command("git", "rev-parse", "--is-inside-work-tree").Output()
+	if err != nil || strings.TrimSpace(string(out)) != "true" {
+		return health.Result{}, false
+	}
+
+	repoName := filepath.Base(gitTopLevel()) + ".git"
+	expected := fmt.Sprintf("ssh://%s:%d/%s", cfg.ServerHost, cfg.Port, repoName)
+
+	out, err = exec.Command("git", "remote", "get-url", "origin").Output()
+	if err != nil {
+		return health.Result{Name: name, Status: health.Warn, Detail: "no origin remote",
+			Fix: fmt.Sprintf("git remote add origin %s (or run 'homegit init')", expected)}, true
+	}
+	origin := strings.TrimSpace(string(out))
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Scheme != "ssh" || u.Hostname() != cfg.ServerHost || u.Port() != strconv.Itoa(cfg.Port) {
+		return health.Result{Name: name, Status: health.Warn, Detail: origin + " is not on the homegit server",
+			Fix: fmt.Sprintf("git remote set-url origin %s", expected)}, true
+	}
+	return health.Result{Name: name, Status: health.OK, Detail: origin}, true
+}
+
+func gitTopLevel() string {
+	out, err := exec.Command("git", "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "."
+	}
+	return strings.TrimSpace(string(out))
+}
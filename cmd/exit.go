@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
+)
+
+// Exit codes, so scripts can tell failures apart. They are part of the
+// documented output schema in docs/output.md.
+const (
+	ExitOK          = 0
+	ExitError       = 1 // anything not covered below
+	ExitUsage       = 2 // bad command line
+	ExitNotFound    = 3 // repository, profile, setting or file doesn't exist
+	ExitPermission  = 4 // permission denied
+	ExitUnreachable = 5 // server not running or can't be reached
+)
+
+var (
+	ErrNotFound    = errors.New("not found")
+	ErrUnreachable = errors.New("server unreachable")
+)
+
+// ExitCode classifies err for the process exit status.
+func ExitCode(err error) int {
+	var opErr *net.OpError
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrUnreachable), errors.Is(err, control.ErrNotRunning),
+		errors.As(err, &opErr) && opErr.Op == "dial":
+		return ExitUnreachable
+	case errors.Is(err, fs.ErrPermission):
+		return ExitPermission
+	case errors.Is(err, ErrNotFound), errors.Is(err, fs.ErrNotExist),
+		errors.Is(err, config.ErrUnknownSetting), errors.Is(err, config.ErrUnknownProfile):
+		return ExitNotFound
+	}
+	return ExitError
+}
+
+// ErrorCode names an exit code in structured error output.
+func ErrorCode(code int) string {
+	switch code {
+	case ExitUsage:
+		return "usage"
+	case ExitNotFound:
+		return "not_found"
+	case ExitPermission:
+		return "permission_denied"
+	case ExitUnreachable:
+		return "unreachable"
+	}
+	return "error"
+}
+
+// repoNotFound is the error for a repository that doesn't exist.
+func repoNotFound(repoName string) error {
+	return fmt.Errorf("repository %w: %s", ErrNotFound, repoName)
+}
@@ -0,0 +1,307 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/cli"
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
+	"github.com/chris-roerig/homegit/internal/tui"
+)
+
+// ManifestFile is the name of the manifest 'homegit export' writes next to
+// its bundles, and that 'homegit import' reads back.
+const ManifestFile = "homegit-manifest.json"
+
+// Values of ExportRepo.Status.
+const (
+	ExportExported = "exported"
+	ExportSkipped  = "skipped"
+	ExportFailed   = "failed"
+)
+
+// ExportRepo is one repository in an export manifest: its homegit
+// metadata and where its refs went.
+type ExportRepo struct {
+	Repo          string   `json:"repo"`
+	Description   string   `json:"description,omitempty"`
+	DefaultBranch string   `json:"default_branch,omitempty"`
+	Branches      int      `json:"branches"`
+	Tags          int      `json:"tags"`
+	Hooks         []string `json:"hooks,omitempty"`
+	Bundle        string   `json:"bundle,omitempty"`
+	Remote        string   `json:"remote,omitempty"`
+	Status        string   `json:"status"`
+	Detail        string   `json:"detail,omitempty"`
+}
+
+// ExportManifest is the JSON manifest written by 'homegit export'.
+// Bundle paths are relative to the export directory.
+type ExportManifest struct {
+	Version  int          `json:"version"`
+	Exported time.Time    `json:"exported"`
+	Repos    []ExportRepo `json:"repos"`
+}
+
+// ExportReport is the result of 'homegit export'.
+type ExportReport struct {
+	Manifest string       `json:"manifest"`
+	Repos    []ExportRepo `json:"repos"`
+}
+
+// Export writes repoName, or every repository if all is set, to dest.
+// dest is either a directory, which gets a git bundle per repository, or
+// a remote URL that each repository is mirror-pushed to; {repo} in it is
+// replaced by the repository's name with its namespace and {name} by the
+// name alone. A manifest of each repository's metadata is written to
+// manifest, which defaults to ManifestFile in dest when it is a directory
+// and in the current directory otherwise.
+func Export(cfg *config.Config, repoName string, all bool, dest, manifest string, jobs int, format output.Format) error {
+	var repos []string
+	switch {
+	case all && repoName != "":
+		return &cli.UsageError{Err: errors.New("give a repository or --all, not both")}
+	case all:
+		var err error
+		if repos, err = getLocalRepoList(cfg.ReposDir); err != nil {
+			return err
+		}
+		if len(repos) == 0 {
+			return fmt.Errorf("no repositories %w in %s", ErrNotFound, cfg.ReposDir)
+		}
+	default:
+		if !strings.HasSuffix(repoName, ".git") {
+			repoName += ".git"
+		}
+		if _, err := os.Stat(filepath.Join(cfg.ReposDir, repoName)); err != nil {
+			return repoNotFound(repoName)
+		}
+		repos = []string{repoName}
+	}
+
+	remote := isRemoteURL(dest)
+	if remote {
+		// Two repositories pushed to one URL would overwrite each other
+		seen := make(map[string]string)
+		for _, repo := range repos {
+			url := expandURL(dest, strings.TrimSuffix(repo, ".git"))
+			if other, ok := seen[url]; ok {
+				return &cli.UsageError{Err: fmt.Errorf("%s and %s would both be pushed to %s; use {repo} in the URL", other, repo, url)}
+			}
+			seen[url] = repo
+		}
+		if manifest == "" {
+			manifest = ManifestFile
+		}
+	} else {
+		// git runs in each repository, so relative paths won't do
+		var err error
+		if dest, err = filepath.Abs(dest); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return fmt.Errorf("failed to create export directory: %w", err)
+		}
+		if manifest == "" {
+			manifest = filepath.Join(dest, ManifestFile)
+		}
+	}
+
+	results := make([]ExportRepo, len(repos))
+	var progress *tui.Progress
+	if !format.Structured() {
+		progress = tui.NewProgress("Exporting", len(repos))
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				name := strings.TrimSuffix(repos[i], ".git")
+				if progress != nil {
+					progress.Start(name)
+				}
+				if remote {
+					results[i] = pushRepo(cfg, repos[i], expandURL(dest, name))
+				} else {
+					results[i] = bundleRepo(cfg, repos[i], dest)
+				}
+				if progress != nil {
+					progress.Done(name, "")
+				}
+			}
+		}()
+	}
+	for i := range repos {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if progress != nil {
+		progress.Finish()
+	}
+
+	if err := writeManifest(manifest, ExportManifest{Version: 1, Exported: time.Now().UTC(), Repos: results}); err != nil {
+		return err
+	}
+	report := ExportReport{Manifest: manifest, Repos: results}
+	err := output.Print(os.Stdout, format, report, func() error {
+		return printExport(report)
+	})
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Status == ExportFailed {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repositories failed to export", failed, len(results))
+	}
+	return nil
+}
+
+// isRemoteURL reports whether dest is a URL git can push to rather than
+// a local directory.
+func isRemoteURL(dest string) bool {
+	if _, err := os.Stat(dest); err == nil {
+		return false
+	}
+	return strings.Contains(dest, "://") || scpURL.MatchString(dest)
+}
+
+// expandURL fills in the {repo} and {name} placeholders of template for
+// the repository name, which has no ".git" and may have a namespace.
+func expandURL(template, name string) string {
+	return strings.NewReplacer("{repo}", name, "{name}", path.Base(name)).Replace(template)
+}
+
+// repoMetadata reads what the manifest records about the repository at
+// repoPath.
+func repoMetadata(repoName, repoPath string) ExportRepo {
+	r := ExportRepo{Repo: repoName, Description: readDescription(repoPath)}
+	r.DefaultBranch, _ = gitOutput(repoPath, "symbolic-ref", "--short", "HEAD")
+	branches, _ := gitOutput(repoPath, "for-each-ref", "--format=x", "refs/heads")
+	tags, _ := gitOutput(repoPath, "for-each-ref", "--format=x", "refs/tags")
+	r.Branches, r.Tags = countLines(branches), countLines(tags)
+
+	// Hooks don't travel with the refs, so at least record which there were
+	if entries, err := os.ReadDir(filepath.Join(repoPath, "hooks")); err == nil {
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasSuffix(entry.Name(), ".sample") {
+				r.Hooks = append(r.Hooks, entry.Name())
+			}
+		}
+		sort.Strings(r.Hooks)
+	}
+	return r
+}
+
+// bundleRepo writes repoName as a bundle of all its refs into dir, keeping
+// its namespace as subdirectories.
+func bundleRepo(cfg *config.Config, repoName, dir string) ExportRepo {
+	repoPath := filepath.Join(cfg.ReposDir, filepath.FromSlash(repoName))
+	r := repoMetadata(repoName, repoPath)
+	if r.Branches == 0 && r.Tags == 0 {
+		r.Status, r.Detail = ExportSkipped, "empty repository"
+		return r
+	}
+
+	bundle := strings.TrimSuffix(repoName, ".git") + ".bundle"
+	file := filepath.Join(dir, filepath.FromSlash(bundle))
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		r.Status, r.Detail = ExportFailed, err.Error()
+		return r
+	}
+	partial := file + ".partial"
+	if _, err := gitOutput(repoPath, "bundle", "create", "--quiet", partial, "--all"); err != nil {
+		os.Remove(partial)
+		r.Status, r.Detail = ExportFailed, err.Error()
+		return r
+	}
+	if err := os.Rename(partial, file); err != nil {
+		os.Remove(partial)
+		r.Status, r.Detail = ExportFailed, err.Error()
+		return r
+	}
+	r.Bundle, r.Status = bundle, ExportExported
+	return r
+}
+
+// pushRepo mirror-pushes repoName to url.
+func pushRepo(cfg *config.Config, repoName, url string) ExportRepo {
+	repoPath := filepath.Join(cfg.ReposDir, filepath.FromSlash(repoName))
+	r := repoMetadata(repoName, repoPath)
+	if r.Branches == 0 && r.Tags == 0 {
+		r.Status, r.Detail = ExportSkipped, "empty repository"
+		return r
+	}
+	r.Remote = url
+	if _, err := gitOutput(repoPath, "push", "--quiet", "--mirror", url); err != nil {
+		r.Status, r.Detail = ExportFailed, err.Error()
+		return r
+	}
+	r.Status = ExportExported
+	return r
+}
+
+func writeManifest(file string, manifest ExportManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// readManifest reads the manifest in dir, if there is one.
+func readManifest(dir string) (*ExportManifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var manifest ExportManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestFile, err)
+	}
+	return &manifest, nil
+}
+
+func printExport(report ExportReport) error {
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tRESULT\tBRANCHES\tTAGS\tTO")
+	for _, r := range report.Repos {
+		counts[r.Status]++
+		status := r.Status
+		if r.Detail != "" {
+			status += ": " + r.Detail
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", strings.TrimSuffix(r.Repo, ".git"), status, r.Branches, r.Tags, orDash(r.Bundle+r.Remote))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d exported, %d skipped, %d failed; manifest in %s\n",
+		counts[ExportExported], counts[ExportSkipped], counts[ExportFailed], report.Manifest)
+	return nil
+}
@@ -8,28 +8,12 @@ import (
 	"github.com/chris-roerig/homegit/internal/config"
 )
 
+// Help prints this server's details, usage examples and notes. It follows
+// the command list generated from the command tree.
 func Help(cfg *config.Config) error {
 	hostname, _ := os.Hostname()
 	ip := getLocalIP()
 
-	fmt.Println("homegit - minimal portable Git server")
-	fmt.Println("\n=== COMMANDS ===")
-	fmt.Println("  setup       Configure homegit (server or client)")
-	fmt.Println("  init        Initialize git repo and add remote")
-	fmt.Println("  config      Edit configuration")
-	fmt.Println("  serve       Start server in foreground")
-	fmt.Println("  start       Start server as daemon")
-	fmt.Println("  stop        Stop daemon server")
-	fmt.Println("  restart     Restart daemon server")
-	fmt.Println("  status      Check daemon status")
-	fmt.Println("  list        List all repositories")
-	fmt.Println("  clone       Clone a repository from the server")
-	fmt.Println("  backup      Backup a repository to tar.gz")
-	fmt.Println("  remove      Remove a repository")
-	fmt.Println("  logs        View server logs")
-	fmt.Println("  version     Show version")
-	fmt.Println("  help        Show this help message")
-
 	fmt.Println("\n=== SERVER INFO ===")
 	fmt.Printf("  Port:        %d\n", cfg.Port)
 	fmt.Printf("  Repos Dir:   %s\n", cfg.ReposDir)
@@ -62,7 +46,7 @@ func Help(cfg *config.Config) error {
 	fmt.Println("  • Repositories are auto-created on first push")
 	fmt.Println("  • Repository names must end with .git")
 	fmt.Println("  • No authentication - use on trusted networks only")
-	fmt.Printf("  • Server logs: ~/.homegit/server.log\n")
+	fmt.Printf("  • Server logs: %s\n", cfg.LogFile())
 
 	return nil
 }
@@ -0,0 +1,291 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/hostkey"
+	"github.com/chris-roerig/homegit/internal/mdns"
+	"github.com/chris-roerig/homegit/internal/output"
+	"golang.org/x/crypto/ssh"
+)
+
+// HostKey is one of the server's host keys, as shown by 'homegit hostkey
+// show'.
+type HostKey struct {
+	Path   string `json:"path"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+	// Replaces is when a next key takes over from the active one
+	Replaces    time.Time `json:"replaces,omitzero"`
+	Fingerprint string    `json:"fingerprint"`
+	Randomart   string    `json:"randomart"`
+	KnownHosts  []string  `json:"known_hosts"`
+
+	key ssh.PublicKey
+}
+
+// Host key statuses. An active key is offered to clients; a next key is
+// only announced to them until its rotation finishes.
+const (
+	KeyActive = "active"
+	KeyNext   = "next"
+)
+
+// HostKeyReport lists the server's host keys.
+type HostKeyReport struct {
+	Keys []HostKey `json:"keys"`
+}
+
+// HostKeyShow prints the server's host keys, and those waiting to replace
+// them, with their fingerprints and randomart, and a known_hosts line for
+// every address the server listens on, so clients can be told what to
+// expect before they first connect.
+func HostKeyShow(cfg *config.Config, format output.Format) error {
+	hosts := listenHosts(cfg)
+	describe := func(path, status string) (HostKey, error) {
+		key, err := localHostKey(path)
+		if err != nil {
+			return HostKey{}, err
+		}
+		info := HostKey{
+			Path:        path,
+			Type:        key.Type(),
+			Status:      status,
+			Fingerprint: ssh.FingerprintSHA256(key),
+			Randomart:   hostkey.Randomart(key),
+			KnownHosts:  []string{},
+			key:         key,
+		}
+		for _, addr := range hosts {
+			info.KnownHosts = append(info.KnownHosts, hostkey.Line(addr, key))
+		}
+		return info, nil
+	}
+
+	var report HostKeyReport
+	for _, path := range cfg.HostKeyFiles() {
+		info, err := describe(path, KeyActive)
+		// A type added since the server started has no key until it reloads
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read host key %s: %w", path, err)
+		}
+		report.Keys = append(report.Keys, info)
+
+		started, ok := hostkey.Pending(path)
+		if !ok {
+			continue
+		}
+		next, err := describe(hostkey.NextFile(path), KeyNext)
+		if err != nil {
+			return fmt.Errorf("failed to read host key %s: %w", hostkey.NextFile(path), err)
+		}
+		next.Replaces = started.Add(hostKeyGrace(cfg))
+		report.Keys = append(report.Keys, next)
+	}
+	if len(report.Keys) == 0 {
+		return fmt.Errorf("no host key at %s yet; start the server once to generate it: %w", cfg.HostKey, ErrNotFound)
+	}
+
+	return output.Print(os.Stdout, format, report, func() error {
+		for i, k := range report.Keys {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s %s (%s)\n", hostkey.Describe(k.key), k.Fingerprint, k.Path)
+			if k.Status == KeyNext {
+				fmt.Printf("Next key: announced to clients, replaces the active one from %s\n", k.Replaces.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Println(k.Randomart)
+			if len(k.KnownHosts) > 0 {
+				fmt.Println("\nknown_hosts lines:")
+				for _, line := range k.KnownHosts {
+					fmt.Println(line)
+				}
+			}
+		}
+		fmt.Println("\nOn a client, 'homegit hostkey pin' checks the server presents one of these keys and pins it.")
+		return nil
+	})
+}
+
+// hostKeyGrace is how long a new key is announced before it replaces the
+// current one.
+func hostKeyGrace(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.HostKeyGrace) * 24 * time.Hour
+}
+
+// HostKeyRotate starts replacing the server's host keys of the given types,
+// or all of them. The new keys are announced to clients straight away and
+// replace the old ones once host_key_grace days have passed, or when the
+// rotation is finished early with finish.
+func HostKeyRotate(cfg *config.Config, types []string, finish bool) error {
+	if len(types) == 0 {
+		types = cfg.HostKeyTypes
+	}
+	for _, typ := range types {
+		if !slices.Contains(cfg.HostKeyTypes, typ) {
+			return fmt.Errorf("the server has no %s key; host_key_types is %s", typ, strings.Join(cfg.HostKeyTypes, ","))
+		}
+	}
+
+	for _, typ := range types {
+		path := cfg.HostKeyFile(typ)
+		_, pending := hostkey.Pending(path)
+		if finish {
+			if !pending {
+				return fmt.Errorf("no rotation of the %s key is under way; start one with 'homegit hostkey rotate --type %s'", typ, typ)
+			}
+			if err := hostkey.Retire(path); err != nil {
+				return err
+			}
+			fmt.Printf("✓ Replaced the %s key; the old one is kept at %s\n", typ, hostkey.RetiredFile(path))
+			continue
+		}
+
+		if pending {
+			return fmt.Errorf("a new %s key is already waiting at %s; finish that rotation with 'homegit hostkey rotate --finish --type %s'", typ, hostkey.NextFile(path), typ)
+		}
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("no %s host key at %s yet; start the server once to generate it: %w", typ, path, ErrNotFound)
+		}
+		signer, err := hostkey.Rotate(path, typ)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ New %s key %s at %s\n", typ, ssh.FingerprintSHA256(signer.PublicKey()), hostkey.NextFile(path))
+	}
+
+	if err := control.Call(cfg.ControlSocket, control.MethodReload, nil, nil); err != nil && !errors.Is(err, control.ErrNotRunning) {
+		return fmt.Errorf("keys written, but the server didn't reload: %w", err)
+	}
+	if finish {
+		fmt.Println("\nThe server now presents the new keys. Clients that didn't learn them will see a")
+		fmt.Println("changed host key; compare it with 'homegit hostkey show' before trusting it.")
+		return nil
+	}
+	if cfg.HostKeyGrace == 0 {
+		fmt.Println("\nhost_key_grace is 0, so the server switches to the new keys as soon as it loads them.")
+		return nil
+	}
+	fmt.Println("\nThe server announces the new keys to clients, and OpenSSH clients with")
+	fmt.Println("UpdateHostKeys add them to known_hosts on their next connection.")
+	fmt.Printf("They replace the current keys from %s (host_key_grace is %d days),\n",
+		time.Now().Add(hostKeyGrace(cfg)).Format("2006-01-02"), cfg.HostKeyGrace)
+	fmt.Println("or sooner with 'homegit hostkey rotate --finish'.")
+	return nil
+}
+
+// listenHosts returns the host:port addresses clients may use to reach
+// the server. An address on every interface stands for the host name,
+// each local address and localhost.
+func listenHosts(cfg *config.Config) []string {
+	var hosts []string
+	add := func(host, port string) {
+		if addr := net.JoinHostPort(host, port); !slices.Contains(hosts, addr) {
+			hosts = append(hosts, addr)
+		}
+	}
+	for _, listen := range cfg.ListenAddrs() {
+		if strings.HasPrefix(listen, "unix:") {
+			continue
+		}
+		host, port, err := net.SplitHostPort(listen)
+		if err != nil {
+			continue
+		}
+		if ip := net.ParseIP(host); host != "" && (ip == nil || !ip.IsUnspecified()) {
+			add(host, port)
+			continue
+		}
+		if hostname, err := os.Hostname(); err == nil {
+			label, _, _ := strings.Cut(hostname, ".")
+			add(hostname, port)
+			add(label+".local", port)
+		}
+		for _, ip := range mdns.LocalAddrs() {
+			add(ip.String(), port)
+		}
+		add("localhost", port)
+	}
+	return hosts
+}
+
+// HostKeyPin fetches the host key of the configured server and pins it in
+// ~/.ssh/known_hosts once confirmed, so ssh and git never have to accept
+// it blindly.
+func HostKeyPin(cfg *config.Config, profile string, prompts Prompts) error {
+	cfg, err := cfg.ForProfile(profile)
+	if err != nil {
+		return err
+	}
+	addr := serverAddr(cfg)
+	key, err := fetchHostKey(addr)
+	if err != nil {
+		return fmt.Errorf("%w: failed to connect to %s: %v", ErrUnreachable, addr, err)
+	}
+	return pinHostKey(addr, key, confirmPin(prompts))
+}
+
+// confirmPin asks whether to trust a host key that was just shown.
+func confirmPin(prompts Prompts) func() (bool, error) {
+	return func() (bool, error) {
+		if prompts.Yes {
+			return true, nil
+		}
+		if prompts.NonInteractive {
+			return false, fmt.Errorf("pinning the host key needs confirmation; pass --yes")
+		}
+		fmt.Print("Trust this key and pin it? (y/N): ")
+		var response string
+		fmt.Scanln(&response)
+		return strings.ToLower(response) == "y", nil
+	}
+}
+
+// pinHostKey pins key for the server at addr in known_hosts. An unpinned
+// key is shown first and only pinned if confirm says so; a different key
+// already pinned is an error.
+func pinHostKey(addr string, key ssh.PublicKey, confirm func() (bool, error)) error {
+	knownHosts := hostkey.KnownHostsFile(config.GetHomeDir())
+	state, pinned, err := hostkey.Check(knownHosts, addr, key)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case hostkey.Pinned:
+		fmt.Printf("✓ Host key %s for %s is already pinned in %s\n", ssh.FingerprintSHA256(key), addr, knownHosts)
+		return nil
+	case hostkey.Changed:
+		return fmt.Errorf("%w; if the server's key was replaced on purpose, remove the old one with %s and try again",
+			&hostkey.ChangedError{Addr: addr, Key: key, Pinned: pinned}, hostkey.RemoveCommand(addr))
+	}
+
+	fmt.Printf("\nThe server at %s presented this host key:\n\n", addr)
+	fmt.Printf("%s %s\n%s\n\n", hostkey.Describe(key), ssh.FingerprintSHA256(key), hostkey.Randomart(key))
+	fmt.Println("Compare it with 'homegit hostkey show' on the server.")
+	ok, err := confirm()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		fmt.Println("Not pinned; ssh will ask about the key on the first connection")
+		return nil
+	}
+	if err := hostkey.Pin(knownHosts, addr, key); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Pinned in %s\n", knownHosts)
+	return nil
+}
@@ -0,0 +1,384 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
+	"github.com/chris-roerig/homegit/internal/tui"
+)
+
+// Values of ImportResult.Status.
+const (
+	ImportImported = "imported"
+	ImportSkipped  = "skipped"
+	ImportFailed   = "failed"
+)
+
+// ImportResult is what 'homegit import' did with one source repository.
+type ImportResult struct {
+	Repo     string `json:"repo"`
+	Source   string `json:"source"`
+	Status   string `json:"status"`
+	Branches int    `json:"branches"`
+	Tags     int    `json:"tags"`
+	Detail   string `json:"detail,omitempty"`
+}
+
+// ImportReport is the result of 'homegit import'.
+type ImportReport struct {
+	ReposDir string         `json:"repos_dir"`
+	Repos    []ImportResult `json:"repos"`
+}
+
+// importSource is one repository to import and the name it gets.
+type importSource struct {
+	source      string // URL or local path
+	name        string // without ".git", may contain "/"
+	working     bool   // a working copy, whose remote-tracking refs are left behind
+	description string // from an export manifest, for a bundle
+}
+
+// scpURL matches the scp-like syntax git accepts, e.g. git@github.com:me/repo.git.
+var scpURL = regexp.MustCompile(`^([\w.-]+@)?[\w.-]+:[^/\\]`)
+
+// Import mirrors repositories into the repos directory under namespace.
+// source is a directory tree of bare repositories, working copies and
+// bundles (such as one written by Export), a single repository URL, or a
+// file listing one URL per line. Existing repositories are never
+// overwritten.
+func Import(cfg *config.Config, source, namespace string, jobs int, format output.Format) error {
+	namespace = strings.Trim(namespace, "/")
+	if namespace != "" {
+		if err := checkRepoName(namespace); err != nil {
+			return fmt.Errorf("invalid namespace: %w", err)
+		}
+	}
+	sources, err := importSources(source)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no repositories %w in %s", ErrNotFound, source)
+	}
+	if err := os.MkdirAll(cfg.ReposDir, 0755); err != nil {
+		return fmt.Errorf("failed to create repos directory: %w", err)
+	}
+
+	report := ImportReport{ReposDir: cfg.ReposDir, Repos: make([]ImportResult, len(sources))}
+	// Two sources with the same name would race for one target, so only
+	// the first is imported
+	var queue []int
+	first := make(map[string]string)
+	for i := range sources {
+		src := &sources[i]
+		if namespace != "" {
+			src.name = namespace + "/" + src.name
+		}
+		if other, ok := first[src.name]; ok {
+			report.Repos[i] = ImportResult{
+				Repo:   src.name + ".git",
+				Source: src.source,
+				Status: ImportSkipped,
+				Detail: "same name as " + other,
+			}
+			continue
+		}
+		first[src.name] = src.source
+		queue = append(queue, i)
+	}
+
+	var progress *tui.Progress
+	if !format.Structured() {
+		progress = tui.NewProgress("Importing", len(queue))
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				src := sources[i]
+				if progress != nil {
+					progress.Start(src.name)
+				}
+				report.Repos[i] = importRepo(cfg, src)
+				if progress != nil {
+					progress.Done(src.name, "")
+				}
+			}
+		}()
+	}
+	for _, i := range queue {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if progress != nil {
+		progress.Finish()
+	}
+
+	failed := 0
+	for _, r := range report.Repos {
+		if r.Status == ImportFailed {
+			failed++
+		}
+	}
+	err = output.Print(os.Stdout, format, report, func() error {
+		return printImport(report)
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repositories failed to import", failed, len(report.Repos))
+	}
+	return nil
+}
+
+// importSources works out what source names: a directory tree, a
+// bundle, a list of URLs in a file, or a single URL.
+func importSources(source string) ([]importSource, error) {
+	info, err := os.Stat(source)
+	switch {
+	case err == nil && info.IsDir():
+		return findRepos(source)
+	case err == nil && strings.HasSuffix(source, ".bundle"):
+		return []importSource{{source: source, name: strings.TrimSuffix(filepath.Base(source), ".bundle")}}, nil
+	case err == nil:
+		return readURLList(source)
+	case strings.Contains(source, "://") || scpURL.MatchString(source):
+		return []importSource{{source: source, name: repoNameFromURL(source)}}, nil
+	case os.IsNotExist(err):
+		return nil, fmt.Errorf("%s %w: it is not a directory, file or repository URL", source, ErrNotFound)
+	}
+	return nil, err
+}
+
+// findRepos walks root for bare repositories, working copies and
+// bundles, naming each by its path under root. Bundles take their
+// descriptions from the export manifest in root, if there is one.
+func findRepos(root string) ([]importSource, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := readManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	descriptions := make(map[string]string)
+	if manifest != nil {
+		for _, r := range manifest.Repos {
+			descriptions[r.Bundle] = r.Description
+		}
+	}
+
+	var sources []importSource
+	err = filepath.WalkDir(root, func(p string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			if strings.HasSuffix(p, ".bundle") {
+				rel, err := filepath.Rel(root, p)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+				sources = append(sources, importSource{
+					source:      p,
+					name:        strings.TrimSuffix(rel, ".bundle"),
+					description: descriptions[rel],
+				})
+			}
+			return nil
+		}
+		if p != root && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+		if p == root {
+			name = strings.TrimSuffix(filepath.Base(root), ".git")
+		}
+		switch {
+		case isBareRepo(p):
+			sources = append(sources, importSource{source: p, name: name})
+		case isBareRepo(filepath.Join(p, ".git")):
+			sources = append(sources, importSource{source: p, name: name, working: true})
+		default:
+			return nil
+		}
+		return filepath.SkipDir
+	})
+	return sources, err
+}
+
+// isBareRepo reports whether dir looks like a git directory.
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// readURLList reads one repository URL per line, skipping blank lines
+// and # comments.
+func readURLList(file string) ([]importSource, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sources []importSource
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sources = append(sources, importSource{source: line, name: repoNameFromURL(line)})
+	}
+	return sources, scanner.Err()
+}
+
+// repoNameFromURL takes the last path element of a URL, without ".git".
+func repoNameFromURL(u string) string {
+	if _, rest, ok := strings.Cut(u, "://"); ok {
+		u = rest
+	} else if _, rest, ok := strings.Cut(u, ":"); ok {
+		u = rest
+	}
+	return strings.TrimSuffix(path.Base(strings.TrimRight(u, "/")), ".git")
+}
+
+// importRepo mirrors src into the repos directory. It clones next to its
+// final place and renames it in, so a half-finished import is never
+// served.
+func importRepo(cfg *config.Config, src importSource) ImportResult {
+	result := ImportResult{Repo: src.name + ".git", Source: src.source}
+	fail := func(err error) ImportResult {
+		result.Status, result.Detail = ImportFailed, err.Error()
+		return result
+	}
+
+	if err := checkRepoName(src.name); err != nil {
+		return fail(err)
+	}
+	target := filepath.Join(cfg.ReposDir, filepath.FromSlash(src.name)+".git")
+	if _, err := os.Stat(target); err == nil {
+		result.Status, result.Detail = ImportSkipped, "already exists"
+		return result
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fail(err)
+	}
+	// Hidden, so repository listings skip it
+	partial := filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+".importing")
+	os.RemoveAll(partial)
+	if _, err := gitOutput("", "clone", "--quiet", "--mirror", src.source, partial); err != nil {
+		os.RemoveAll(partial)
+		return fail(err)
+	}
+
+	if err := finishImport(partial, src); err != nil {
+		os.RemoveAll(partial)
+		return fail(err)
+	}
+	if err := os.Rename(partial, target); err != nil {
+		os.RemoveAll(partial)
+		return fail(err)
+	}
+
+	branches, _ := gitOutput(target, "for-each-ref", "--format=x", "refs/heads")
+	tags, _ := gitOutput(target, "for-each-ref", "--format=x", "refs/tags")
+	result.Branches, result.Tags = countLines(branches), countLines(tags)
+	result.Status = ImportImported
+	return result
+}
+
+// finishImport turns a fresh mirror clone into a plain server repository:
+// it forgets where it came from, drops a working copy's remote-tracking
+// refs and takes over the source's description.
+func finishImport(dir string, src importSource) error {
+	// Only the config; removing the remote would delete every ref it mirrors
+	if _, err := gitOutput(dir, "config", "--remove-section", "remote.origin"); err != nil {
+		return err
+	}
+	if src.working {
+		refs, err := gitOutput(dir, "for-each-ref", "--format=%(refname)", "refs/remotes")
+		if err != nil {
+			return err
+		}
+		for _, ref := range strings.Fields(refs) {
+			if _, err := gitOutput(dir, "update-ref", "-d", ref); err != nil {
+				return err
+			}
+		}
+	}
+
+	desc := src.description
+	if desc == "" {
+		gitDir := src.source
+		if src.working {
+			gitDir = filepath.Join(src.source, ".git")
+		}
+		desc = readDescription(gitDir)
+	}
+	if desc != "" {
+		return os.WriteFile(filepath.Join(dir, "description"), []byte(desc+"\n"), 0644)
+	}
+	return nil
+}
+
+func countLines(s string) int {
+	if s == "" {
+		return 0
+	}
+	return strings.Count(s, "\n") + 1
+}
+
+func printImport(report ImportReport) error {
+	counts := make(map[string]int)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tRESULT\tBRANCHES\tTAGS\tSOURCE")
+	for _, r := range report.Repos {
+		counts[r.Status]++
+		status := r.Status
+		if r.Detail != "" {
+			status += ": " + r.Detail
+		}
+		refs := []string{"-", "-"}
+		if r.Status == ImportImported {
+			refs = []string{fmt.Sprint(r.Branches), fmt.Sprint(r.Tags)}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", strings.TrimSuffix(r.Repo, ".git"), status, refs[0], refs[1], r.Source)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Printf("\n%d imported, %d skipped, %d failed into %s\n",
+		counts[ImportImported], counts[ImportSkipped], counts[ImportFailed], report.ReposDir)
+	return nil
+}
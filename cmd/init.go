@@ -11,10 +11,20 @@ import (
 	"github.com/chris-roerig/homegit/internal/config"
 )
 
-func Init() error {
-	cfg, err := config.Load()
+// Init sets up the current directory as a git repository with origin on
+// the server of the given profile (empty for the active one). Each of
+// extra adds another remote, named after that profile, so the project can
+// be pushed to a second server.
+func Init(base *config.Config, profile string, extra []string) error {
+	cfg, err := base.ForProfile(profile)
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return err
+	}
+	extraCfgs := make([]*config.Config, len(extra))
+	for i, name := range extra {
+		if extraCfgs[i], err = base.ForProfile(name); err != nil {
+			return err
+		}
 	}
 
 	// Get current directory name for repo name
@@ -37,25 +47,24 @@ func Init() error {
 		fmt.Println("Initialized git repository")
 	}
 
-	// Add remote
-	remoteURL := fmt.Sprintf("ssh://%s:%d/%s.git", cfg.ServerHost, cfg.Port, repoName)
-	cmd := exec.Command("git", "remote", "add", "origin", remoteURL)
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		// Remote might already exist, try to set-url instead
-		cmd = exec.Command("git", "remote", "set-url", "origin", remoteURL)
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("failed to add remote: %w", err)
+	// Add remotes
+	remoteURL := repoURL(cfg, repoName)
+	if err := setRemote("origin", remoteURL); err != nil {
+		return err
+	}
+	for i, name := range extra {
+		if err := setRemote(name, repoURL(extraCfgs[i], repoName)); err != nil {
+			return err
 		}
-		fmt.Println("Updated 'origin' remote")
-	} else {
-		fmt.Println("Added 'origin' remote")
 	}
 
 	// Print helpful message
 	fmt.Printf("\n✓ Repository initialized: %s\n", repoName)
-	fmt.Printf("✓ Remote added: %s\n\n", remoteURL)
+	fmt.Printf("✓ Remote added: %s\n", remoteURL)
+	for i, name := range extra {
+		fmt.Printf("✓ Remote '%s' added: %s\n", name, repoURL(extraCfgs[i], repoName))
+	}
+	fmt.Println()
 	fmt.Println("Next steps:")
 	fmt.Println("  1. Add files:       git add .")
 	fmt.Printf("  2. Commit:          git commit -m \"Initial commit\"\n")
@@ -76,3 +85,25 @@ func Init() error {
 
 	return nil
 }
+
+func repoURL(cfg *config.Config, repoName string) string {
+	return fmt.Sprintf("ssh://%s:%d/%s.git", cfg.ServerHost, cfg.Port, repoName)
+}
+
+// setRemote adds the named remote, or points it at url if it exists.
+func setRemote(name, url string) error {
+	cmd := exec.Command("git", "remote", "add", name, url)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		// Remote might already exist, try to set-url instead
+		cmd = exec.Command("git", "remote", "set-url", name, url)
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to add remote: %w", err)
+		}
+		fmt.Printf("Updated '%s' remote\n", name)
+	} else {
+		fmt.Printf("Added '%s' remote\n", name)
+	}
+	return nil
+}
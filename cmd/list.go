@@ -2,82 +2,72 @@ package cmd
 
 import (
 	"fmt"
+	"net"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
-	"strings"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
-func List(cfg *config.Config) error {
-	// If server_host is localhost, read local directory
-	if cfg.ServerHost == "localhost" || cfg.ServerHost == "127.0.0.1" {
-		return listLocal(cfg)
-	}
-
-	// Otherwise, list from remote server via SSH
-	return listRemote(cfg)
+// RepoList is the result of 'homegit list'. The fields are the same
+// whether the repositories were read from repos_dir or over SSH; Path is
+// only known for a local server.
+type RepoList struct {
+	Server string     `json:"server"`
+	Repos  []RepoInfo `json:"repos"`
 }
 
-func listLocal(cfg *config.Config) error {
-	if err := os.MkdirAll(cfg.ReposDir, 0755); err != nil {
-		return fmt.Errorf("failed to create repos directory: %w", err)
-	}
-
-	entries, err := os.ReadDir(cfg.ReposDir)
-	if err != nil {
-		return fmt.Errorf("failed to read repos directory: %w", err)
-	}
-
-	repos := []string{}
-	for _, entry := range entries {
-		if entry.IsDir() && strings.HasSuffix(entry.Name(), ".git") {
-			repos = append(repos, entry.Name())
-		}
-	}
-
-	if len(repos) == 0 {
-		fmt.Println("No repositories found")
-		return nil
-	}
-
-	fmt.Printf("Repositories in %s:\n", cfg.ReposDir)
-	for _, repo := range repos {
-		fullPath := filepath.Join(cfg.ReposDir, repo)
-		fmt.Printf("  %s\n    Path: %s\n", repo, fullPath)
-	}
-
-	return nil
+type RepoInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
 }
 
-func listRemote(cfg *config.Config) error {
-	// Use SSH to list repos on remote server
-	cmd := exec.Command("ssh", "-p", strconv.Itoa(cfg.Port), cfg.ServerHost, "ls", "-1", cfg.ReposDir)
-	output, err := cmd.Output()
+func List(cfg *config.Config, profile string, format output.Format) error {
+	cfg, err := cfg.ForProfile(profile)
 	if err != nil {
-		return fmt.Errorf("failed to list remote repos: %w", err)
+		return err
 	}
 
-	lines := strings.Split(strings.TrimSpace(string(output)), "\n")
-	repos := []string{}
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line != "" && strings.HasSuffix(line, ".git") {
-			repos = append(repos, line)
+	result := RepoList{Server: net.JoinHostPort(cfg.ServerHost, strconv.Itoa(cfg.Port)), Repos: []RepoInfo{}}
+	// If the server is this machine's, read its directory
+	local := isLocalServer(cfg)
+	if local {
+		names, err := getLocalRepoList(cfg.ReposDir)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			result.Repos = append(result.Repos, RepoInfo{Name: name, Path: filepath.Join(cfg.ReposDir, name)})
+		}
+	} else {
+		// Otherwise, list from remote server via SSH
+		names, err := getRemoteRepoList(cfg)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			result.Repos = append(result.Repos, RepoInfo{Name: name})
 		}
 	}
 
-	if len(repos) == 0 {
-		fmt.Println("No repositories found")
+	return output.Print(os.Stdout, format, result, func() error {
+		if len(result.Repos) == 0 {
+			fmt.Println("No repositories found")
+			return nil
+		}
+		if local {
+			fmt.Printf("Repositories in %s:\n", cfg.ReposDir)
+		} else {
+			fmt.Printf("Repositories on %s:\n", cfg.ServerHost)
+		}
+		for _, repo := range result.Repos {
+			fmt.Printf("  %s\n", repo.Name)
+			if repo.Path != "" {
+				fmt.Printf("    Path: %s\n", repo.Path)
+			}
+		}
 		return nil
-	}
-
-	fmt.Printf("Repositories on %s:\n", cfg.ServerHost)
-	for _, repo := range repos {
-		fmt.Printf("  %s\n", repo)
-	}
-
-	return nil
+	})
 }
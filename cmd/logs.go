@@ -1,48 +1,264 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
 	"os/exec"
-	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/logging"
+	"github.com/chris-roerig/homegit/internal/logrotate"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
-func Logs(cfg *config.Config, args []string) error {
-	logFile := filepath.Join(filepath.Dir(cfg.PIDFile), "server.log")
+// logFilter selects structured log lines for 'homegit logs'.
+type logFilter struct {
+	level    slog.Level
+	hasLevel bool
+	repo     string
+	since    time.Time
+	until    time.Time
+}
+
+func (f *logFilter) active() bool {
+	return f.hasLevel || f.repo != "" || !f.since.IsZero() || !f.until.IsZero()
+}
 
-	if _, err := os.Stat(logFile); os.IsNotExist(err) {
-		return fmt.Errorf("no log file found at %s", logFile)
+func (f *logFilter) match(line string) bool {
+	if !f.active() {
+		return true
+	}
+	entry, ok := logging.ParseLine(line)
+	if !ok {
+		return false
+	}
+	if f.hasLevel && entry.Level < f.level {
+		return false
 	}
+	if f.repo != "" && repoKey(entry.Fields[logging.KeyRepo]) != repoKey(f.repo) {
+		return false
+	}
+	if !f.since.IsZero() && entry.Time.Before(f.since) {
+		return false
+	}
+	if !f.until.IsZero() && entry.Time.After(f.until) {
+		return false
+	}
+	return true
+}
 
-	lines := 50
-	follow := false
+// repoKey normalizes "/name.git", "name.git" and "name" to the same value.
+func repoKey(repo string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(repo, "/"), ".git")
+}
 
-	for i, arg := range args {
-		if arg == "--tail" || arg == "-n" {
-			if i+1 < len(args) {
-				if n, err := strconv.Atoi(args[i+1]); err == nil {
-					lines = n
-				}
-			}
+// parseLogTime accepts a duration back from now ("2h", "30m") or a date
+// and time ("2026-01-18", "2026-01-18 15:04", RFC 3339).
+func parseLogTime(value string) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
 		}
-		if arg == "--follow" || arg == "-f" {
-			follow = true
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q (use a duration like 2h or a date like 2026-01-18)", value)
+}
+
+// defaultLogLines is how many lines 'homegit logs' shows without --tail
+// or a time window.
+const defaultLogLines = 50
+
+// LogsOptions selects which server log lines 'homegit logs' shows.
+type LogsOptions struct {
+	Tail         int // lines to show, counted after filtering; 0 for the default
+	Follow       bool
+	Level        string // minimum level
+	Repo         string
+	Since, Until string // durations like 2h or dates
+	Format       output.Format
+}
+
+// LogEntry is one line of 'homegit logs' output as JSON or YAML. Lines
+// that aren't structured log records only have Msg.
+type LogEntry struct {
+	Time   string            `json:"time,omitempty"`
+	Level  string            `json:"level,omitempty"`
+	Msg    string            `json:"msg"`
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+func newLogEntry(line string) LogEntry {
+	entry, ok := logging.ParseLine(line)
+	if !ok {
+		return LogEntry{Msg: line}
+	}
+	return LogEntry{
+		Time:   entry.Time.Format(time.RFC3339Nano),
+		Level:  strings.ToLower(entry.Level.String()),
+		Msg:    entry.Msg,
+		Fields: entry.Fields,
+	}
+}
+
+func Logs(cfg *config.Config, opts LogsOptions) error {
+	logFile := cfg.LogFile()
+
+	_, err := os.Stat(logFile)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("log file %w: %s", ErrNotFound, logFile)
+	}
+
+	follow := opts.Follow
+	filter := logFilter{repo: opts.Repo}
+	if opts.Level != "" {
+		lvl, err := logging.ParseLevel(opts.Level)
+		if err != nil {
+			return err
+		}
+		filter.level, filter.hasLevel = lvl, true
+	}
+	if opts.Since != "" {
+		if filter.since, err = parseLogTime(opts.Since); err != nil {
+			return err
+		}
+	}
+	if opts.Until != "" {
+		if filter.until, err = parseLogTime(opts.Until); err != nil {
+			return err
 		}
 	}
 
-	var cmd *exec.Cmd
-	if follow {
-		cmd = exec.Command("tail", "-f", "-n", strconv.Itoa(lines), logFile)
-	} else {
-		cmd = exec.Command("tail", "-n", strconv.Itoa(lines), logFile)
+	// A time window shows everything in it unless --tail says otherwise
+	lines := opts.Tail
+	if lines <= 0 && filter.since.IsZero() && filter.until.IsZero() {
+		lines = defaultLogLines
 	}
 
-	cmd.Stdout = os.Stdout
+	printLine := func(line string) error {
+		if opts.Format.Structured() {
+			return output.PrintLine(os.Stdout, opts.Format, newLogEntry(line))
+		}
+		_, err := fmt.Println(line)
+		return err
+	}
+
+	if !filter.active() && !opts.Format.Structured() {
+		var cmd *exec.Cmd
+		if follow {
+			// -F follows the file by name, across rotations
+			cmd = exec.Command("tail", "-F", "-n", strconv.Itoa(lines), logFile)
+		} else {
+			cmd = exec.Command("tail", "-n", strconv.Itoa(lines), logFile)
+		}
+
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		cmd.Stdin = os.Stdin
+
+		return cmd.Run()
+	}
+
+	segments := []string{logFile}
+	if !filter.since.IsZero() {
+		if segments, err = logSegmentsSince(logFile, filter.since); err != nil {
+			return err
+		}
+	}
+
+	var matches []string
+	total := 0
+	for _, segment := range segments {
+		r, err := logrotate.OpenSegment(segment)
+		if err != nil {
+			return err
+		}
+		found, n, err := lastMatches(r, &filter, lines)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", segment, err)
+		}
+		matches = append(matches, found...)
+		total += n
+	}
+	if lines > 0 && len(matches) > lines {
+		matches = matches[len(matches)-lines:]
+	}
+	if len(matches) < total {
+		fmt.Fprintf(os.Stderr, "Showing the last %d of %d matching lines; use --tail to see more\n", len(matches), total)
+	}
+	for _, line := range matches {
+		if err := printLine(line); err != nil {
+			return err
+		}
+	}
+	if !follow {
+		return nil
+	}
+
+	// Follow new lines only; the backlog was printed above. -F keeps
+	// following after the log is rotated
+	cmd := exec.Command("tail", "-F", "-n", "0", logFile)
 	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		if filter.match(scanner.Text()) {
+			if err := printLine(scanner.Text()); err != nil {
+				cmd.Process.Kill()
+				cmd.Wait()
+				return err
+			}
+		}
+	}
+	return cmd.Wait()
+}
 
-	return cmd.Run()
+// logSegmentsSince returns the live log plus any rotated segments that may
+// hold entries newer than since, oldest first.
+func logSegmentsSince(logFile string, since time.Time) ([]string, error) {
+	all, err := logrotate.Segments(logFile)
+	if err != nil {
+		return nil, err
+	}
+	var segments []string
+	for _, segment := range all {
+		// A segment's rotation time is its newest entry
+		if rotated, ok := logrotate.RotatedAt(logFile, segment); ok && rotated.Before(since) {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	return segments, nil
+}
+
+// lastMatches returns up to n of the last lines from r that match filter,
+// or all of them if n is 0, and how many matched in all.
+func lastMatches(r io.Reader, filter *logFilter, n int) (matches []string, total int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if !filter.match(scanner.Text()) {
+			continue
+		}
+		total++
+		matches = append(matches, scanner.Text())
+		if n > 0 && len(matches) > n {
+			matches = matches[1:]
+		}
+	}
+	return matches, total, scanner.Err()
 }
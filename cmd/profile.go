@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
+)
+
+// ProfileUse makes name the profile client commands use by default.
+func ProfileUse(name string) error {
+	if err := config.UseProfile(name); err != nil {
+		return err
+	}
+	fmt.Printf("Now using profile %s\n", name)
+	return nil
+}
+
+func ProfileRemove(name string) error {
+	if err := config.RemoveProfile(name); err != nil {
+		return err
+	}
+	fmt.Printf("Removed profile %s\n", name)
+	return nil
+}
+
+// ProfileInfo is one entry in the result of 'homegit profile list'.
+type ProfileInfo struct {
+	Name   string `json:"name"`
+	Host   string `json:"host"`
+	Port   int    `json:"port"`
+	Active bool   `json:"active"`
+}
+
+// ProfileList prints the profiles, marking the active one.
+func ProfileList(cfg *config.Config, format output.Format) error {
+	active := cfg.ActiveProfile()
+	profiles := []ProfileInfo{{Name: config.DefaultProfile, Host: cfg.ServerHost, Port: cfg.Port}}
+	for _, name := range cfg.ProfileNames() {
+		p := cfg.Profiles[name]
+		profiles = append(profiles, ProfileInfo{Name: name, Host: p.Host, Port: p.Port})
+	}
+	for i := range profiles {
+		profiles[i].Active = profiles[i].Name == active
+	}
+
+	result := struct {
+		Profiles []ProfileInfo `json:"profiles"`
+	}{profiles}
+	return output.Print(os.Stdout, format, result, func() error {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "\tNAME\tSERVER")
+		for _, p := range profiles {
+			mark := ""
+			if p.Active {
+				mark = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", mark, p.Name, config.Profile{Host: p.Host, Port: p.Port})
+		}
+		return w.Flush()
+	})
+}
+
+func ProfileAdd(name, host string, port int) error {
+	if host == "" {
+		return fmt.Errorf("--host is required")
+	}
+	p := config.Profile{Host: host, Port: port}
+	if err := config.AddProfile(name, p); err != nil {
+		return err
+	}
+	fmt.Printf("Added profile %s (%s)\n", name, p)
+	fmt.Printf("Use it with: homegit profile use %s, or --profile %s\n", name, name)
+	return nil
+}
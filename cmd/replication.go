@@ -0,0 +1,163 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/output"
+)
+
+// ReplicationStatus shows this server's replication role and, on a
+// primary, how far behind each replica is per repository.
+func ReplicationStatus(cfg *config.Config, format output.Format) error {
+	var status control.ReplicationStatus
+	if err := control.Call(cfg.ControlSocket, control.MethodReplication, nil, &status); err != nil {
+		return err
+	}
+	return output.Print(os.Stdout, format, status, func() error {
+		return printReplication(status)
+	})
+}
+
+func printReplication(status control.ReplicationStatus) error {
+	switch status.Role {
+	case control.RoleStandalone:
+		fmt.Println("Replication is off. Set replicas on the primary, and replica_of on each standby, with the same replication_secret.")
+		return nil
+	case control.RoleReplica:
+		fmt.Printf("Replica of %s: pushes are refused except from it\n", status.Primary)
+		if len(status.Received) == 0 {
+			fmt.Println("No updates from the primary since the server started")
+		} else {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			fmt.Fprintln(w, "\nREPO\tLAST UPDATE")
+			for _, r := range status.Received {
+				fmt.Fprintf(w, "%s\t%s\n", strings.TrimSuffix(r.Repo, ".git"), ago(r.Synced))
+			}
+			if err := w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, replica := range status.Replicas {
+		fmt.Println()
+		switch {
+		case replica.Error != "":
+			fmt.Printf("Replica %s is unreachable: %s\n", replica.Addr, replica.Error)
+		case replica.Checked.IsZero():
+			fmt.Printf("Replica %s has not been checked yet\n", replica.Addr)
+		default:
+			fmt.Printf("Replica %s, checked %s\n", replica.Addr, ago(replica.Checked))
+		}
+		if len(replica.Repos) == 0 {
+			continue
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "REPO\tSTATE\tLAG\tLAST SYNC")
+		behind, lag := 0, 0.0
+		for _, r := range replica.Repos {
+			state, lagText := "in sync", "-"
+			if r.Pending {
+				behind++
+				lag = max(lag, r.LagSeconds)
+				state, lagText = "pending", (time.Duration(r.LagSeconds) * time.Second).String()
+			}
+			if r.Error != "" {
+				state = "failed: " + r.Error
+			}
+			synced := "never"
+			if !r.Synced.IsZero() {
+				synced = ago(r.Synced)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", strings.TrimSuffix(r.Repo, ".git"), state, lagText, synced)
+		}
+		if err := w.Flush(); err != nil {
+			return err
+		}
+		if behind == 0 {
+			fmt.Printf("All %d repositories in sync\n", len(replica.Repos))
+		} else {
+			fmt.Printf("%d of %d repositories behind, by up to %s\n", behind, len(replica.Repos), time.Duration(lag)*time.Second)
+		}
+	}
+	return nil
+}
+
+// ago describes how long before now t was, to the second.
+func ago(t time.Time) string {
+	return time.Since(t).Round(time.Second).String() + " ago"
+}
+
+// ReplicationPromote turns this replica into a primary for failover: it
+// clears replica_of, so the server accepts pushes again.
+func ReplicationPromote(cfg *config.Config) error {
+	if cfg.ReplicaOf == "" {
+		return errors.New("this server is not a replica (replica_of is not set)")
+	}
+	primary := cfg.ReplicaOf
+
+	if err := config.UnsetInFile("replica_of"); err != nil {
+		return err
+	}
+	warnOverridden("replica_of")
+	if err := control.Call(cfg.ControlSocket, control.MethodReload, nil, nil); err != nil && !errors.Is(err, control.ErrNotRunning) {
+		return fmt.Errorf("promoted in the config, but the server didn't reload: %w", err)
+	}
+	fmt.Printf("Promoted: this server no longer follows %s and accepts pushes\n", primary)
+
+	// Two primaries taking pushes would drift apart
+	if primaryReachable(primary) {
+		fmt.Printf("\nWarning: %s is still answering. Stop it, or make it a replica of this server\n", primary)
+		fmt.Println("with replica_of, so that only one server takes pushes.")
+	}
+	fmt.Println("\nPoint clients here with 'homegit profile add' or server_host, and list any")
+	fmt.Println("standbys for this server under replicas.")
+	return nil
+}
+
+// ReplicationPin fetches the host key of each replica and pins it in the
+// known_hosts of the user running it, which must be the server's user.
+// The primary only connects to replicas whose key is pinned, so the
+// replication secret can't be sent to a server posing as one.
+func ReplicationPin(cfg *config.Config, prompts Prompts) error {
+	if len(cfg.Replicas) == 0 {
+		return errors.New("no replicas configured; list them with 'homegit config set replicas host:port'")
+	}
+	for i, addr := range cfg.Replicas {
+		if i > 0 {
+			fmt.Println()
+		}
+		key, err := fetchHostKey(addr)
+		if err != nil {
+			return fmt.Errorf("%w: failed to connect to %s: %v", ErrUnreachable, addr, err)
+		}
+		if err := pinHostKey(addr, key, confirmPin(prompts)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// primaryReachable reports whether the homegit server at addr answers.
+func primaryReachable(addr string) bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ssh", "-o", "BatchMode=yes", "-o", "ConnectTimeout=3", "-p", port, host, git.ListReposCommand)
+	return cmd.Run() == nil
+}
@@ -1,14 +1,35 @@
 package cmd
 
 import (
+	"log/slog"
+
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/logging"
 	"github.com/chris-roerig/homegit/internal/ssh"
 )
 
+// Serve runs the server in the foreground. It first brings the config
+// file up to the current version and checks the directories it writes to.
 func Serve(cfg *config.Config) error {
+	if err := logging.SetupStderr(cfg.LogLevel, cfg.LogFormat); err != nil {
+		return err
+	}
+
+	from, backup, err := config.Migrate()
+	if err != nil {
+		return err
+	}
+	if backup != "" {
+		slog.Info("Migrated config", "path", config.Path(), "from", from, "to", config.CurrentVersion, "backup", backup)
+	}
+	if problems := cfg.CheckDirs(); len(problems) > 0 {
+		return &config.ValidationError{Path: config.Path(), Problems: problems}
+	}
+
 	server, err := ssh.NewServer(cfg)
 	if err != nil {
 		return err
 	}
+	server.Version = Version
 	return server.Start()
 }
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/daemon"
+	"github.com/chris-roerig/homegit/internal/systemd"
+)
+
+// Service installs or uninstalls the systemd units. action is "install"
+// or "uninstall"; userUnits selects the user's systemd instance.
+func Service(cfg *config.Config, action string, useSystemd, userUnits bool) error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("service install is only supported with systemd on Linux")
+	}
+
+	switch action {
+	case "install":
+		if !useSystemd {
+			return fmt.Errorf("specify a service manager: homegit service install --systemd [--user]")
+		}
+		return installService(cfg, userUnits)
+	case "uninstall":
+		if !userUnits {
+			// Default to whichever install is present
+			if installed, user := systemd.Installed(); installed {
+				userUnits = user
+			}
+		}
+		if err := systemd.Uninstall(userUnits); err != nil {
+			return fmt.Errorf("failed to uninstall service: %w", err)
+		}
+		fmt.Printf("Removed homegit units from %s\n", systemd.UnitDir(userUnits))
+		return nil
+	default:
+		return fmt.Errorf("unknown service command: %s", action)
+	}
+}
+
+func installService(cfg *config.Config, userUnits bool) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if resolved, err := filepath.EvalSymlinks(exe); err == nil {
+		exe = resolved
+	}
+
+	unit := &systemd.Unit{
+		Exe:          exe,
+		Home:         config.GetHomeDir(),
+		Config:       config.Path(),
+		ListenAddrs:  cfg.ListenAddrs(),
+		StopTimeout:  cfg.ShutdownTimeout,
+		UserInstance: userUnits,
+	}
+	if !userUnits {
+		// Under sudo, run the server as the invoking user rather than root
+		unit.User = os.Getenv("SUDO_USER")
+		if unit.User == "" {
+			if u, err := user.Current(); err == nil {
+				unit.User = u.Username
+			}
+		}
+	}
+
+	if installed, _ := systemd.Installed(); !installed && daemon.IsRunning(cfg) {
+		return fmt.Errorf("a homegit daemon is already running; stop it first with: homegit stop")
+	}
+
+	if err := unit.Install(); err != nil {
+		if !userUnits && os.Geteuid() != 0 {
+			fmt.Println("System units need root. Try: sudo -E homegit service install --systemd")
+		}
+		return fmt.Errorf("failed to install service: %w", err)
+	}
+
+	fmt.Printf("✓ Installed %s and %s in %s\n", systemd.ServiceName, systemd.SocketName, systemd.UnitDir(userUnits))
+	fmt.Println("✓ Socket enabled; the server starts on the first connection")
+	fmt.Println("\nhomegit start/stop/status now manage the systemd units")
+	return nil
+}
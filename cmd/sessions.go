@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/chris-roerig/homegit/internal/cli"
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/output"
+)
+
+// KillSession cancels an active session by the ID 'homegit sessions' shows.
+func KillSession(cfg *config.Config, idArg string) error {
+	id, err := strconv.ParseUint(idArg, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid session ID: %s", idArg)
+	}
+	if err := control.Call(cfg.ControlSocket, control.MethodKill, control.KillParams{ID: id}, nil); err != nil {
+		return err
+	}
+	fmt.Printf("Session %d killed\n", id)
+	return nil
+}
+
+// SessionList is the result of 'homegit sessions'.
+type SessionList struct {
+	Sessions []control.Session `json:"sessions"`
+}
+
+func Sessions(cfg *config.Config, format output.Format) error {
+	list := SessionList{Sessions: []control.Session{}}
+	if err := control.Call(cfg.ControlSocket, control.MethodSessions, nil, &list.Sessions); err != nil {
+		return err
+	}
+	return output.Print(os.Stdout, format, list, func() error {
+		if len(list.Sessions) == 0 {
+			fmt.Println("No active sessions")
+			return nil
+		}
+		printSessions(list.Sessions)
+		return nil
+	})
+}
+
+// MaintenanceInfo is the result of 'homegit maintenance'.
+type MaintenanceInfo struct {
+	Maintenance bool `json:"maintenance"`
+}
+
+// Maintenance shows maintenance mode, or turns it "on" or "off".
+func Maintenance(cfg *config.Config, state string, format output.Format) error {
+	if state == "" {
+		var status control.Status
+		if err := control.Call(cfg.ControlSocket, control.MethodStatus, nil, &status); err != nil {
+			return err
+		}
+		return output.Print(os.Stdout, format, MaintenanceInfo{status.Maintenance}, func() error {
+			fmt.Printf("Maintenance mode is %s\n", onOff(status.Maintenance))
+			return nil
+		})
+	}
+
+	var enabled bool
+	switch state {
+	case "on":
+		enabled = true
+	case "off":
+		enabled = false
+	default:
+		return &cli.UsageError{Err: fmt.Errorf("maintenance takes on or off, got %q", state)}
+	}
+
+	params := control.MaintenanceParams{Enabled: enabled}
+	if err := control.Call(cfg.ControlSocket, control.MethodMaintenance, params, nil); err != nil {
+		return err
+	}
+	return output.Print(os.Stdout, format, MaintenanceInfo{enabled}, func() error {
+		if enabled {
+			fmt.Println("Maintenance mode on: pushes are refused, fetches still work")
+		} else {
+			fmt.Println("Maintenance mode off")
+		}
+		return nil
+	})
+}
+
+func printSessions(sessions []control.Session) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tREMOTE\tUSER\tREPO\tOP\tIN\tOUT\tDURATION")
+	for _, sess := range sessions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			sess.ID, sess.RemoteAddr, sess.User, sess.Repo, sess.Operation,
+			formatBytes(sess.BytesIn), formatBytes(sess.BytesOut), sess.Duration)
+	}
+	w.Flush()
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
+
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
@@ -3,10 +3,15 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"net"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/mdns"
+	"golang.org/x/crypto/ssh"
 )
 
 func Setup() error {
@@ -42,30 +47,30 @@ func Setup() error {
 		hostname, _ := os.Hostname()
 		fmt.Printf("\n✓ Repos will be stored on this computer\n")
 		fmt.Printf("✓ Other computers can connect using: %s\n", hostname)
+		fmt.Println("✓ 'homegit setup' on them finds this server on the local network")
 		cfg.ServerHost = "localhost"
 	} else {
 		// This is a client
-		fmt.Print("\nEnter the computer's hostname or IP where repos are stored: ")
-		serverHost, err := reader.ReadString('\n')
+		server, err := discoverServer(reader)
 		if err != nil {
-			return fmt.Errorf("failed to read input: %w", err)
-		}
-		serverHost = strings.TrimSpace(serverHost)
-
-		if serverHost == "" {
-			return fmt.Errorf("hostname/IP is required")
+			return err
 		}
-
-		// Basic validation - no spaces, not localhost variants
-		if strings.Contains(serverHost, " ") {
-			return fmt.Errorf("invalid hostname/IP: cannot contain spaces")
+		if server != nil {
+			host, port, _ := net.SplitHostPort(server.Addr())
+			cfg.ServerHost = host
+			cfg.Port, _ = strconv.Atoi(port)
+			fmt.Printf("\n✓ Will connect to: %s, port %d\n", host, cfg.Port)
+		} else {
+			serverHost, err := askServerHost(reader)
+			if err != nil {
+				return err
+			}
+			cfg.ServerHost = serverHost
+			fmt.Printf("\n✓ Will connect to: %s\n", serverHost)
 		}
-		if serverHost == "localhost" || serverHost == "127.0.0.1" {
-			return fmt.Errorf("use option 1 to store repos on this computer")
+		if err := setupHostKey(reader, cfg, server); err != nil {
+			return err
 		}
-
-		cfg.ServerHost = serverHost
-		fmt.Printf("\n✓ Will connect to: %s\n", serverHost)
 	}
 
 	// Save config
@@ -73,7 +78,7 @@ func Setup() error {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	fmt.Println("\n✓ Configuration saved to ~/.homegit/config")
+	fmt.Printf("\n✓ Configuration saved to %s\n", config.Path())
 
 	if cfg.ServerHost == "localhost" {
 		// This is the server - ask if they want to start it
@@ -103,3 +108,100 @@ func Setup() error {
 
 	return nil
 }
+
+// askServerHost asks for the server's hostname or IP.
+func askServerHost(reader *bufio.Reader) (string, error) {
+	fmt.Print("\nEnter the computer's hostname or IP where repos are stored: ")
+	serverHost, err := reader.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	serverHost = strings.TrimSpace(serverHost)
+
+	if serverHost == "" {
+		return "", fmt.Errorf("hostname/IP is required")
+	}
+
+	// Basic validation - no spaces, not localhost variants
+	if strings.Contains(serverHost, " ") {
+		return "", fmt.Errorf("invalid hostname/IP: cannot contain spaces")
+	}
+	if serverHost == "localhost" || serverHost == "127.0.0.1" {
+		return "", fmt.Errorf("use option 1 to store repos on this computer")
+	}
+	return serverHost, nil
+}
+
+// discoverTimeout is how long setup waits for servers to answer.
+const discoverTimeout = 2 * time.Second
+
+// discoverServer looks for homegit servers on the local network and lets
+// the user pick one. It returns nil when none answered or the user would
+// rather type an address.
+func discoverServer(reader *bufio.Reader) (*mdns.Entry, error) {
+	fmt.Println("\nLooking for homegit servers on your network...")
+	found, err := mdns.Browse(discoverTimeout)
+	if err != nil {
+		fmt.Printf("⚠ Couldn't search the network: %v\n", err)
+		return nil, nil
+	}
+	if len(found) == 0 {
+		fmt.Println("No servers answered.")
+		return nil, nil
+	}
+
+	fmt.Println()
+	for i, e := range found {
+		fmt.Printf("  %d. %s\n", i+1, e)
+	}
+	fmt.Printf("  %d. Enter a hostname or IP instead\n", len(found)+1)
+	fmt.Print("\nChoose a server (1): ")
+	response, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	choice := 1
+	if response = strings.TrimSpace(response); response != "" {
+		if choice, err = strconv.Atoi(response); err != nil || choice < 1 || choice > len(found)+1 {
+			return nil, fmt.Errorf("invalid choice %q: enter a number from 1 to %d", response, len(found)+1)
+		}
+	}
+	if choice == len(found)+1 {
+		return nil, nil
+	}
+
+	return &found[choice-1], nil
+}
+
+// setupHostKey pins the chosen server's host key, trusting it on first
+// use. A discovered server must present the key it advertised, so that a
+// stray or forged answer can't point setup somewhere else. A server typed
+// in by hand may not be running yet, which only earns a warning.
+func setupHostKey(reader *bufio.Reader, cfg *config.Config, server *mdns.Entry) error {
+	addr := serverAddr(cfg)
+	key, err := fetchHostKey(addr)
+	if err != nil {
+		if server != nil {
+			return fmt.Errorf("failed to connect to %s: %w", addr, err)
+		}
+		fmt.Printf("\n⚠ Couldn't fetch the server's host key: %v\n", err)
+		fmt.Println("  Once it's running, pin it with: homegit hostkey pin")
+		return nil
+	}
+
+	if server != nil && server.Fingerprint != "" {
+		if fingerprint := ssh.FingerprintSHA256(key); fingerprint != server.Fingerprint {
+			return fmt.Errorf("%s presented host key %s, not the advertised %s; another machine may be answering for it", addr, fingerprint, server.Fingerprint)
+		}
+		fmt.Printf("\n✓ The host key matches the one %s advertised\n", server.Instance)
+	}
+	return pinHostKey(addr, key, func() (bool, error) {
+		fmt.Print("Trust this key and pin it? (Y/n): ")
+		response, err := reader.ReadString('\n')
+		if err != nil {
+			return false, fmt.Errorf("failed to read input: %w", err)
+		}
+		response = strings.TrimSpace(strings.ToLower(response))
+		return response == "" || response == "y" || response == "yes", nil
+	})
+}
@@ -0,0 +1,236 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
+	"github.com/chris-roerig/homegit/internal/tui"
+)
+
+// Values of SyncResult.Status.
+const (
+	SyncCloned  = "cloned"
+	SyncUpdated = "updated"
+	SyncCurrent = "current"
+	SyncSkipped = "skipped"
+	SyncFailed  = "failed"
+)
+
+// SyncResult is what 'homegit sync' did with one repository.
+type SyncResult struct {
+	Repo   string `json:"repo"`
+	Path   string `json:"path"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SyncReport is the result of 'homegit sync'.
+type SyncReport struct {
+	Server string       `json:"server"`
+	Dir    string       `json:"dir"`
+	Repos  []SyncResult `json:"repos"`
+}
+
+// Sync clones every repository on the server of profile (empty for the
+// active one) into dir, with namespaces as subdirectories, and brings
+// existing clones up to date with a fast-forward. Clones with local
+// changes or commits of their own are left alone. jobs repositories are
+// handled at a time.
+func Sync(cfg *config.Config, profile, dir string, jobs int, format output.Format) error {
+	cfg, err := cfg.ForProfile(profile)
+	if err != nil {
+		return err
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return err
+	}
+	repos, err := getRepoList(cfg)
+	if err != nil {
+		return err
+	}
+
+	report := SyncReport{Server: fmt.Sprintf("%s:%d", cfg.ServerHost, cfg.Port), Dir: dir, Repos: make([]SyncResult, len(repos))}
+	if len(repos) == 0 {
+		return output.Print(os.Stdout, format, report, func() error {
+			fmt.Println("No repositories found")
+			return nil
+		})
+	}
+
+	var progress *tui.Progress
+	if !format.Structured() {
+		progress = tui.NewProgress("Syncing", len(repos))
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range max(jobs, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				name := strings.TrimSuffix(repos[i], ".git")
+				if progress != nil {
+					progress.Start(name)
+				}
+				result := syncRepo(cfg, repos[i], filepath.Join(dir, filepath.FromSlash(name)))
+				report.Repos[i] = result
+				if progress != nil {
+					progress.Done(name, formatSyncResult(result))
+				}
+			}
+		}()
+	}
+	for i := range repos {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if progress != nil {
+		progress.Finish()
+	}
+
+	counts := make(map[string]int)
+	for _, result := range report.Repos {
+		counts[result.Status]++
+	}
+	err = output.Print(os.Stdout, format, report, func() error {
+		var parts []string
+		for _, status := range []string{SyncCloned, SyncUpdated, SyncCurrent, SyncSkipped, SyncFailed} {
+			if counts[status] > 0 {
+				parts = append(parts, fmt.Sprintf("%d %s", counts[status], syncStatusText(status)))
+			}
+		}
+		fmt.Printf("\n%d repositories in %s: %s\n", len(repos), dir, strings.Join(parts, ", "))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if counts[SyncFailed] > 0 {
+		return fmt.Errorf("%d of %d repositories failed to sync", counts[SyncFailed], len(repos))
+	}
+	return nil
+}
+
+func syncStatusText(status string) string {
+	if status == SyncCurrent {
+		return "up to date"
+	}
+	return status
+}
+
+func formatSyncResult(r SyncResult) string {
+	name := strings.TrimSuffix(r.Repo, ".git")
+	line := fmt.Sprintf("  %-10s %s", syncStatusText(r.Status), name)
+	if r.Detail != "" {
+		line += " (" + r.Detail + ")"
+	}
+	return line
+}
+
+// syncRepo clones repo into path, or fast-forwards the clone already
+// there.
+func syncRepo(cfg *config.Config, repo, path string) SyncResult {
+	result := SyncResult{Repo: repo, Path: path}
+	url := repoURL(cfg, strings.TrimSuffix(repo, ".git"))
+	fail := func(err error) SyncResult {
+		result.Status, result.Detail = SyncFailed, err.Error()
+		return result
+	}
+	skip := func(format string, args ...any) SyncResult {
+		result.Status, result.Detail = SyncSkipped, fmt.Sprintf(format, args...)
+		return result
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fail(err)
+		}
+		if _, err := gitOutput("", "clone", "--quiet", url, path); err != nil {
+			return fail(err)
+		}
+		result.Status = SyncCloned
+		return result
+	}
+
+	origin, err := gitOutput(path, "remote", "get-url", "origin")
+	switch {
+	case err != nil:
+		return skip("not a clone with an origin remote")
+	case origin != url:
+		return skip("origin is %s", origin)
+	}
+	if changes, err := gitOutput(path, "status", "--porcelain", "--untracked-files=no"); err != nil {
+		return fail(err)
+	} else if changes != "" {
+		return skip("local changes")
+	}
+
+	if _, err := gitOutput(path, "fetch", "--quiet", "--prune", "origin"); err != nil {
+		return fail(err)
+	}
+	if _, err := gitOutput(path, "rev-parse", "--abbrev-ref", "@{upstream}"); err != nil {
+		if _, err := gitOutput(path, "rev-parse", "--verify", "HEAD"); err != nil {
+			result.Status, result.Detail = SyncCurrent, "empty repository"
+			return result
+		}
+		return skip("fetched only, the current branch has no upstream")
+	}
+	counts, err := gitOutput(path, "rev-list", "--left-right", "--count", "HEAD...@{upstream}")
+	if err != nil {
+		return fail(err)
+	}
+	var ahead, behind int
+	fmt.Sscan(counts, &ahead, &behind)
+	switch {
+	case behind == 0:
+		result.Status = SyncCurrent
+		if ahead > 0 {
+			result.Detail = fmt.Sprintf("%d unpushed commit(s)", ahead)
+		}
+		return result
+	case ahead > 0:
+		return skip("diverged: %d local and %d new commit(s)", ahead, behind)
+	}
+	if _, err := gitOutput(path, "merge", "--quiet", "--ff-only", "@{upstream}"); err != nil {
+		return fail(err)
+	}
+	result.Status, result.Detail = SyncUpdated, fmt.Sprintf("%d new commit(s)", behind)
+	return result
+}
+
+// gitOutput runs git in dir without a terminal, so it fails instead of
+// prompting, and returns its trimmed output. The error includes git's
+// first fatal or error line, or failing that the last line it printed.
+func gitOutput(dir string, args ...string) (string, error) {
+	name := args[0]
+	if dir != "" {
+		args = append([]string{"-C", dir}, args...)
+	}
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		msg := strings.TrimSpace(lines[len(lines)-1])
+		for _, line := range lines {
+			if strings.HasPrefix(line, "fatal: ") || strings.HasPrefix(line, "error: ") {
+				msg = strings.TrimSpace(line)
+				break
+			}
+		}
+		if msg != "" {
+			return "", fmt.Errorf("git %s: %s", name, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
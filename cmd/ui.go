@@ -0,0 +1,497 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/tui"
+)
+
+// pickRepo asks which of repos (names ending in .git) to act on, e.g.
+// "backup". It returns "" if the user cancels.
+func pickRepo(action string, repos []string) (string, error) {
+	if len(repos) == 0 {
+		return "", fmt.Errorf("no repositories found")
+	}
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = strings.TrimSuffix(repo, ".git")
+	}
+
+	i, err := tui.Select(fmt.Sprintf("Select a repository to %s:", action), names)
+	if errors.Is(err, tui.ErrCancelled) {
+		fmt.Println("Cancelled")
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return repos[i], nil
+}
+
+// checkRepoName rejects names that would end up outside the repos
+// directory or be hidden. Namespaces are separated by "/", as in
+// "team/website".
+func checkRepoName(name string) error {
+	if strings.Contains(name, `\`) {
+		return fmt.Errorf("repository name %q can't contain a backslash", name)
+	}
+	for _, part := range strings.Split(strings.TrimSuffix(name, ".git"), "/") {
+		switch {
+		case part == "":
+			return fmt.Errorf("invalid repository name %q", name)
+		case strings.HasPrefix(part, "-") || strings.HasPrefix(part, "."):
+			return fmt.Errorf("invalid repository name %q: parts can't start with %q", name, part[:1])
+		}
+	}
+	return nil
+}
+
+// defaultDescription is what 'git init' puts in a repository's
+// description file.
+const defaultDescription = "Unnamed repository; edit this file 'description' to name the repository."
+
+// readDescription returns the description of the git directory gitDir,
+// or "" if it has none or only the default one.
+func readDescription(gitDir string) string {
+	data, err := os.ReadFile(filepath.Join(gitDir, "description"))
+	if err != nil {
+		return ""
+	}
+	if desc := strings.TrimSpace(string(data)); desc != defaultDescription {
+		return desc
+	}
+	return ""
+}
+
+// repoDetails is what the details pane shows about a repository.
+type repoDetails struct {
+	description   string
+	size          int64
+	defaultBranch string
+	branches      []string
+	lastCommit    string
+	lastCommitBy  string
+}
+
+func loadRepoDetails(path string) *repoDetails {
+	d := &repoDetails{description: readDescription(path)}
+	filepath.WalkDir(path, func(_ string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			if info, err := entry.Info(); err == nil {
+				d.size += info.Size()
+			}
+		}
+		return nil
+	})
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", path}, args...)...).Output()
+		if err != nil {
+			return ""
+		}
+		return strings.TrimSpace(string(out))
+	}
+	d.defaultBranch = git("symbolic-ref", "--short", "HEAD")
+	if branches := git("for-each-ref", "--sort=-committerdate", "--format=%(refname:short)", "refs/heads"); branches != "" {
+		d.branches = strings.Split(branches, "\n")
+	}
+	if commit := git("log", "-1", "--format=%h %s%x00%an, %cr"); commit != "" {
+		d.lastCommit, d.lastCommitBy, _ = strings.Cut(commit, "\x00")
+	}
+	return d
+}
+
+// uiMode is what key presses currently do in 'homegit ui'.
+type uiMode int
+
+const (
+	modeBrowse  uiMode = iota
+	modeFilter         // typing edits the filter
+	modePrompt         // typing edits the prompt's answer
+	modeConfirm        // the next key answers a yes/no question
+)
+
+type ui struct {
+	cfg    *config.Config
+	local  bool // the repositories are on this machine
+	screen *tui.Screen
+	list   *tui.List
+	repos  []string
+
+	details map[string]*repoDetails
+
+	mode     uiMode
+	status   string
+	label    string
+	input    string
+	onAnswer func(answer string)
+}
+
+// UI runs 'homegit ui', a full-screen browser for the server's
+// repositories with a details pane and keys for the common actions.
+func UI(cfg *config.Config) error {
+	if !tui.IsTerminal() {
+		return fmt.Errorf("homegit ui needs a terminal; use 'homegit list', 'clone', 'backup' and 'remove' instead")
+	}
+	u := &ui{cfg: cfg, local: isLocalServer(cfg), list: tui.NewList(nil), details: make(map[string]*repoDetails)}
+	if err := u.reload(); err != nil {
+		return err
+	}
+
+	screen, err := tui.Open()
+	if err != nil {
+		return err
+	}
+	defer screen.Close()
+	u.screen = screen
+
+	for {
+		u.draw()
+		key, err := screen.ReadKey()
+		if err != nil {
+			return err
+		}
+		if u.handleKey(key) {
+			return nil
+		}
+	}
+}
+
+// reload reads the repository list again.
+func (u *ui) reload() error {
+	repos, err := getRepoList(u.cfg)
+	if err != nil {
+		return err
+	}
+	u.repos = repos
+	names := make([]string, len(repos))
+	for i, repo := range repos {
+		names[i] = strings.TrimSuffix(repo, ".git")
+	}
+	u.list.SetItems(names)
+	return nil
+}
+
+func (u *ui) repoPath(name string) string {
+	return filepath.Join(u.cfg.ReposDir, name+".git")
+}
+
+// handleKey acts on a key press and reports whether to quit.
+func (u *ui) handleKey(key tui.Key) bool {
+	_, height := u.screen.Size()
+	page := max(height-6, 1)
+
+	switch u.mode {
+	case modeFilter:
+		switch key.Name {
+		case tui.KeyEnter:
+			u.mode = modeBrowse
+		case tui.KeyEscape:
+			u.list.SetFilter("")
+			u.mode = modeBrowse
+		case tui.KeyCtrlC:
+			return true
+		default:
+			u.list.HandleKey(key, page)
+		}
+		return false
+
+	case modePrompt:
+		switch key.Name {
+		case tui.KeyEnter:
+			u.mode = modeBrowse
+			u.onAnswer(u.input)
+		case tui.KeyEscape, tui.KeyCtrlC:
+			u.mode = modeBrowse
+			u.status = "Cancelled"
+		case tui.KeyBackspace:
+			if r := []rune(u.input); len(r) > 0 {
+				u.input = string(r[:len(r)-1])
+			}
+		case tui.KeyCtrlU:
+			u.input = ""
+		case "":
+			u.input += string(key.Rune)
+		}
+		return false
+
+	case modeConfirm:
+		u.mode = modeBrowse
+		if key.Rune == 'y' || key.Rune == 'Y' {
+			u.onAnswer("y")
+		} else {
+			u.status = "Cancelled"
+		}
+		return false
+	}
+
+	u.status = ""
+	if key.Name != "" {
+		switch key.Name {
+		case tui.KeyEscape:
+			if u.list.Filter() == "" {
+				return true
+			}
+			u.list.SetFilter("")
+		case tui.KeyCtrlC:
+			return true
+		case tui.KeyBackspace, tui.KeyCtrlU:
+		default:
+			u.list.HandleKey(key, page)
+		}
+		return false
+	}
+
+	name, ok := u.list.Selected()
+	switch key.Rune {
+	case 'q':
+		return true
+	case 'j':
+		u.list.Move(1)
+	case 'k':
+		u.list.Move(-1)
+	case '/':
+		u.mode = modeFilter
+	case 'g':
+		u.details = make(map[string]*repoDetails)
+		if err := u.reload(); err != nil {
+			u.status = "Error: " + err.Error()
+		}
+	case 'c':
+		if ok {
+			u.clone(name)
+		}
+	case 'b':
+		if ok && u.needLocal() {
+			u.backup(name)
+		}
+	case 'd':
+		if ok && u.needLocal() {
+			u.ask(modeConfirm, fmt.Sprintf("Remove repository '%s'? (y/N)", name), "", func(string) { u.remove(name) })
+		}
+	case 'r':
+		if ok && u.needLocal() {
+			u.ask(modePrompt, "Rename to: ", name, func(newName string) { u.rename(name, newName) })
+		}
+	case 'e':
+		if ok && u.needLocal() {
+			current := u.repoDetails(name).description
+			u.ask(modePrompt, "Description: ", current, func(desc string) { u.describe(name, desc) })
+		}
+	}
+	return false
+}
+
+// needLocal reports whether the repositories are on this machine,
+// explaining in the status line if not.
+func (u *ui) needLocal() bool {
+	if !u.local {
+		u.status = fmt.Sprintf("Only on the server: run 'homegit ui' on %s", u.cfg.ServerHost)
+	}
+	return u.local
+}
+
+// ask shows a question in the status line and calls onAnswer with the
+// reply, unless the user presses Esc.
+func (u *ui) ask(mode uiMode, label, initial string, onAnswer func(string)) {
+	u.mode, u.label, u.input, u.onAnswer = mode, label, initial, onAnswer
+}
+
+// busy shows message while a slow action runs.
+func (u *ui) busy(message string) {
+	u.status = message
+	u.draw()
+}
+
+func (u *ui) clone(name string) {
+	if _, err := os.Stat(name); err == nil {
+		u.status = fmt.Sprintf("Error: ./%s already exists", name)
+		return
+	}
+	// Hand the terminal to git so its progress and any SSH prompts show
+	u.screen.Suspend()
+	fmt.Printf("Cloning %s...\n", name)
+	cmd := exec.Command("git", "clone", repoURL(u.cfg, name), name)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err := cmd.Run()
+	if resumeErr := u.screen.Resume(); resumeErr != nil {
+		u.status = "Error: " + resumeErr.Error()
+		return
+	}
+	if err != nil {
+		u.status = fmt.Sprintf("Error: clone failed: %v", err)
+		return
+	}
+	u.status = fmt.Sprintf("Cloned into ./%s", name)
+}
+
+func (u *ui) backup(name string) {
+	u.busy(fmt.Sprintf("Creating backup of '%s'...", name))
+	result, err := writeBackup(u.cfg, name+".git")
+	if err != nil {
+		u.status = "Error: " + err.Error()
+		return
+	}
+	u.status = fmt.Sprintf("Backup created: %s (%s)", result.File, formatBytes(result.Bytes))
+}
+
+func (u *ui) remove(name string) {
+	if err := os.RemoveAll(u.repoPath(name)); err != nil {
+		u.status = fmt.Sprintf("Error: failed to remove repository: %v", err)
+		return
+	}
+	delete(u.details, name)
+	u.status = fmt.Sprintf("Repository '%s' removed", name)
+	if err := u.reload(); err != nil {
+		u.status = "Error: " + err.Error()
+	}
+}
+
+func (u *ui) rename(name, newName string) {
+	newName = strings.TrimSuffix(strings.TrimSpace(newName), ".git")
+	if newName == name {
+		return
+	}
+	if err := checkRepoName(newName); err != nil {
+		u.status = "Error: " + err.Error()
+		return
+	}
+	if _, err := os.Stat(u.repoPath(newName)); err == nil {
+		u.status = fmt.Sprintf("Error: repository '%s' already exists", newName)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(u.repoPath(newName)), 0755); err != nil {
+		u.status = fmt.Sprintf("Error: failed to rename repository: %v", err)
+		return
+	}
+	if err := os.Rename(u.repoPath(name), u.repoPath(newName)); err != nil {
+		u.status = fmt.Sprintf("Error: failed to rename repository: %v", err)
+		return
+	}
+	delete(u.details, name)
+	u.status = fmt.Sprintf("Renamed '%s' to '%s'; update clones with: git remote set-url origin %s", name, newName, repoURL(u.cfg, newName))
+	u.list.SetFilter("")
+	if err := u.reload(); err != nil {
+		u.status = "Error: " + err.Error()
+	}
+	u.list.Select(newName)
+}
+
+func (u *ui) describe(name, desc string) {
+	desc = strings.TrimSpace(desc)
+	if desc == "" {
+		desc = defaultDescription
+	}
+	if err := os.WriteFile(filepath.Join(u.repoPath(name), "description"), []byte(desc+"\n"), 0644); err != nil {
+		u.status = fmt.Sprintf("Error: failed to set description: %v", err)
+		return
+	}
+	delete(u.details, name)
+	u.status = fmt.Sprintf("Description of '%s' updated", name)
+}
+
+// repoDetails returns the details of a local repository, reading them
+// the first time it's selected.
+func (u *ui) repoDetails(name string) *repoDetails {
+	d, ok := u.details[name]
+	if !ok {
+		d = loadRepoDetails(u.repoPath(name))
+		u.details[name] = d
+	}
+	return d
+}
+
+// detailLines describes the selected repository for the details pane.
+func (u *ui) detailLines(height int) []string {
+	name, ok := u.list.Selected()
+	if !ok {
+		return nil
+	}
+	lines := []string{tui.Bold(name), "", "Clone URL:  " + repoURL(u.cfg, name)}
+	if !u.local {
+		return append(lines, "", tui.Dim("Details are shown when 'homegit ui' runs on the server."))
+	}
+
+	d := u.repoDetails(name)
+	desc := d.description
+	if desc == "" {
+		desc = tui.Dim("(none, press e to set one)")
+	}
+	lines = append(lines,
+		"Path:       "+u.repoPath(name),
+		"Size:       "+formatBytes(d.size),
+		"Describe:   "+desc,
+		"",
+	)
+	if d.lastCommit == "" {
+		return append(lines, tui.Dim("No commits yet"))
+	}
+	lines = append(lines,
+		"Last commit:",
+		"  "+d.lastCommit,
+		"  "+tui.Dim(d.lastCommitBy),
+		"",
+		fmt.Sprintf("Branches (%d):", len(d.branches)),
+	)
+	for i, branch := range d.branches {
+		if len(lines) >= height-1 && i < len(d.branches)-1 {
+			lines = append(lines, tui.Dim(fmt.Sprintf("  ... and %d more", len(d.branches)-i)))
+			break
+		}
+		if branch == d.defaultBranch {
+			branch += tui.Dim(" (default)")
+		}
+		lines = append(lines, "  "+branch)
+	}
+	return lines
+}
+
+func (u *ui) draw() {
+	width, height := u.screen.Size()
+	bodyHeight := max(height-4, 1)
+	listWidth := min(max(width/3, 20), 40)
+	detailWidth := max(width-listWidth-3, 0)
+
+	title := fmt.Sprintf(" homegit  %s:%d  %d repositories", u.cfg.ServerHost, u.cfg.Port, len(u.repos))
+	lines := []string{tui.Reverse(tui.Fit(title, width))}
+
+	rows := u.list.Render(listWidth, bodyHeight, u.mode != modeFilter)
+	details := u.detailLines(bodyHeight)
+	for i := 0; i < bodyHeight; i++ {
+		detail := ""
+		if i < len(details) {
+			detail = details[i]
+		}
+		lines = append(lines, rows[i]+tui.Dim(" │ ")+tui.Fit(detail, detailWidth))
+	}
+
+	var bottom string
+	switch {
+	case u.mode == modeFilter:
+		bottom = "Filter: " + u.list.Filter() + "█"
+	case u.mode == modePrompt:
+		bottom = u.label + u.input + "█"
+	case u.mode == modeConfirm:
+		bottom = u.label
+	case u.status != "":
+		bottom = u.status
+	case u.list.Filter() != "":
+		bottom = tui.Dim(fmt.Sprintf("Filter: %s (%d matches, esc clears)", u.list.Filter(), u.list.Len()))
+	}
+	help := "↑↓ move  / filter  c clone  b backup  r rename  e describe  d remove  g refresh  q quit"
+	switch u.mode {
+	case modeFilter:
+		help = "type to filter  ↑↓ move  enter done  esc clear"
+	case modePrompt:
+		help = "enter save  esc cancel"
+	}
+	lines = append(lines, "", bottom, tui.Dim(help))
+	u.screen.Draw(lines)
+}
@@ -2,10 +2,19 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
 const Version = "1.0.4"
 
-func ShowVersion() {
-	fmt.Printf("homegit version %s\n", Version)
+func ShowVersion(format output.Format) error {
+	info := struct {
+		Version string `json:"version"`
+	}{Version}
+	return output.Print(os.Stdout, format, info, func() error {
+		fmt.Printf("homegit version %s\n", Version)
+		return nil
+	})
 }
@@ -0,0 +1,313 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
+	"github.com/chris-roerig/homegit/internal/tui"
+)
+
+// BranchCommits is a branch and a number of commits on it.
+type BranchCommits struct {
+	Branch  string `json:"branch"`
+	Commits int    `json:"commits"`
+}
+
+// WorkspaceRepo is the state of one clone found by 'homegit status
+// --workspace'. Safe means everything in it is on the server: no
+// uncommitted or untracked files, no unpushed commits and no local-only
+// branches.
+type WorkspaceRepo struct {
+	Repo        string          `json:"repo"`
+	Server      string          `json:"server"`
+	Path        string          `json:"path"`
+	Branch      string          `json:"branch,omitempty"`
+	Modified    int             `json:"modified"`
+	Untracked   int             `json:"untracked"`
+	Unpushed    []BranchCommits `json:"unpushed,omitempty"`
+	NoUpstream  []string        `json:"no_upstream,omitempty"`
+	ServerNewer []string        `json:"server_newer,omitempty"`
+	Unreachable bool            `json:"unreachable,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	Safe        bool            `json:"safe"`
+	origin      string
+}
+
+// WorkspaceReport is the result of 'homegit status --workspace'.
+type WorkspaceReport struct {
+	Dir   string          `json:"dir"`
+	Repos []WorkspaceRepo `json:"repos"`
+}
+
+// WorkspaceStatus finds the clones under dir whose origin is on one of
+// the configured homegit servers and reports, for each, work that isn't
+// on the server yet and whether the server has commits the clone lacks.
+// Unless offline, each server is asked for its branches; offline, newer
+// commits are only known from the clone's last fetch.
+func WorkspaceStatus(cfg *config.Config, dir string, offline bool, format output.Format) error {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	clones, err := findClones(cfg, dir)
+	if err != nil {
+		return err
+	}
+	report := WorkspaceReport{Dir: dir, Repos: clones}
+
+	var progress *tui.Progress
+	if !format.Structured() && !offline && len(clones) > 0 {
+		progress = tui.NewProgress("Checking", len(clones))
+	}
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				r := &report.Repos[i]
+				if progress != nil {
+					progress.Start(r.Repo)
+				}
+				inspectClone(r, offline)
+				if progress != nil {
+					progress.Done(r.Repo, "")
+				}
+			}
+		}()
+	}
+	for i := range clones {
+		work <- i
+	}
+	close(work)
+	wg.Wait()
+	if progress != nil {
+		progress.Finish()
+	}
+
+	return output.Print(os.Stdout, format, report, func() error {
+		return printWorkspace(report)
+	})
+}
+
+// findClones walks dir for working copies whose origin is a homegit
+// server from the config: the default server or any profile's.
+func findClones(cfg *config.Config, dir string) ([]WorkspaceRepo, error) {
+	servers := map[string]bool{config.Profile{Host: cfg.ServerHost, Port: cfg.Port}.String(): true}
+	for _, p := range cfg.Profiles {
+		servers[p.String()] = true
+	}
+
+	clones := []WorkspaceRepo{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if _, err := os.Stat(filepath.Join(path, ".git")); err != nil {
+			return nil
+		}
+
+		// Nested clones are rare; don't walk the working tree
+		origin, err := gitOutput(path, "remote", "get-url", "origin")
+		if err != nil {
+			return filepath.SkipDir
+		}
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme != "ssh" {
+			return filepath.SkipDir
+		}
+		port := u.Port()
+		if port == "" {
+			port = "22"
+		}
+		server := u.Hostname() + ":" + port
+		if servers[server] {
+			clones = append(clones, WorkspaceRepo{
+				Repo:   strings.TrimSuffix(strings.TrimPrefix(u.Path, "/"), ".git"),
+				Server: server,
+				Path:   path,
+				origin: origin,
+			})
+		}
+		return filepath.SkipDir
+	})
+	return clones, err
+}
+
+// inspectClone fills in r from its working copy and, unless offline, the
+// server's branches.
+func inspectClone(r *WorkspaceRepo, offline bool) {
+	fail := func(err error) {
+		r.Error = err.Error()
+	}
+	r.Branch, _ = gitOutput(r.Path, "symbolic-ref", "--short", "-q", "HEAD")
+
+	status, err := gitOutput(r.Path, "status", "--porcelain")
+	if err != nil {
+		fail(err)
+		return
+	}
+	for _, line := range strings.Split(status, "\n") {
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "??"):
+			r.Untracked++
+		default:
+			r.Modified++
+		}
+	}
+
+	// Each local branch and its upstream, if any
+	refs, err := gitOutput(r.Path, "for-each-ref", "--format=%(refname:short)%00%(objectname)%00%(upstream:short)%00%(upstream:track,nobracket)", "refs/heads")
+	if err != nil {
+		fail(err)
+		return
+	}
+	local := make(map[string]string)
+	for _, line := range strings.Split(refs, "\n") {
+		fields := strings.Split(line, "\x00")
+		if len(fields) != 4 {
+			continue
+		}
+		branch, head, upstream, track := fields[0], fields[1], fields[2], fields[3]
+		local[branch] = head
+		if upstream == "" || track == "gone" {
+			r.NoUpstream = append(r.NoUpstream, branch)
+			continue
+		}
+		if ahead := trackCount(track, "ahead"); ahead > 0 {
+			r.Unpushed = append(r.Unpushed, BranchCommits{Branch: branch, Commits: ahead})
+		}
+		// Offline, the last fetch is all there is to go on
+		if offline && trackCount(track, "behind") > 0 {
+			r.ServerNewer = append(r.ServerNewer, branch)
+		}
+	}
+
+	if !offline {
+		r.ServerNewer, r.Unreachable = serverNewer(r, local)
+	}
+	r.Safe = r.Error == "" && r.Modified == 0 && r.Untracked == 0 && len(r.Unpushed) == 0 && len(r.NoUpstream) == 0
+}
+
+// trackCount reads "ahead 2, behind 1" as git prints it for an upstream.
+func trackCount(track, word string) int {
+	for _, part := range strings.Split(track, ",") {
+		if n, ok := strings.CutPrefix(strings.TrimSpace(part), word+" "); ok {
+			count, _ := strconv.Atoi(n)
+			return count
+		}
+	}
+	return 0
+}
+
+// serverNewer asks the server for its branches and returns those with
+// commits the local branch of the same name doesn't have. unreachable is
+// set if the server couldn't be asked.
+func serverNewer(r *WorkspaceRepo, local map[string]string) (branches []string, unreachable bool) {
+	heads, err := gitOutput(r.Path, "ls-remote", "--heads", r.origin)
+	if err != nil {
+		return nil, true
+	}
+	for _, line := range strings.Split(heads, "\n") {
+		id, ref, ok := strings.Cut(line, "\t")
+		if !ok {
+			continue
+		}
+		branch := strings.TrimPrefix(ref, "refs/heads/")
+		head, ok := local[branch]
+		if !ok || head == id {
+			continue
+		}
+		// Newer unless the server's commit is already in the local branch
+		if _, err := gitOutput(r.Path, "merge-base", "--is-ancestor", id, head); err != nil {
+			branches = append(branches, branch)
+		}
+	}
+	sort.Strings(branches)
+	return branches, false
+}
+
+func printWorkspace(report WorkspaceReport) error {
+	if len(report.Repos) == 0 {
+		fmt.Printf("No clones of a homegit server found in %s\n", report.Dir)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPO\tPATH\tUNCOMMITTED\tUNPUSHED\tNO UPSTREAM\tSERVER")
+	unsafe := 0
+	for _, r := range report.Repos {
+		rel, err := filepath.Rel(report.Dir, r.Path)
+		if err != nil {
+			rel = r.Path
+		}
+		if r.Error != "" {
+			unsafe++
+			fmt.Fprintf(w, "%s\t%s\terror: %s\t\t\t\n", r.Repo, rel, r.Error)
+			continue
+		}
+		if !r.Safe {
+			unsafe++
+		}
+
+		var uncommitted []string
+		if r.Modified > 0 {
+			uncommitted = append(uncommitted, fmt.Sprintf("%d modified", r.Modified))
+		}
+		if r.Untracked > 0 {
+			uncommitted = append(uncommitted, fmt.Sprintf("%d untracked", r.Untracked))
+		}
+		var unpushed []string
+		for _, b := range r.Unpushed {
+			unpushed = append(unpushed, fmt.Sprintf("%s +%d", b.Branch, b.Commits))
+		}
+		server := "-"
+		switch {
+		case r.Unreachable:
+			server = "unreachable"
+		case len(r.ServerNewer) > 0:
+			server = "newer: " + strings.Join(r.ServerNewer, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", r.Repo, rel,
+			orDash(strings.Join(uncommitted, ", ")), orDash(strings.Join(unpushed, ", ")),
+			orDash(strings.Join(r.NoUpstream, ", ")), server)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if unsafe == 0 {
+		fmt.Printf("\nAll %d clone(s) are safely on the server\n", len(report.Repos))
+	} else {
+		fmt.Printf("\n%d of %d clone(s) have work that isn't on the server\n", unsafe, len(report.Repos))
+	}
+	return nil
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,640 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chris-roerig/homegit/cmd"
+	"github.com/chris-roerig/homegit/internal/cli"
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/hostkey"
+	"github.com/chris-roerig/homegit/internal/output"
+)
+
+// commands builds homegit's command tree.
+func (a *app) commands() *cli.Command {
+	var showVersion bool
+	root := &cli.Command{
+		Name:  "homegit",
+		Short: "homegit - minimal portable Git server",
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(&showVersion, "version", false, "show version")
+			fs.BoolVar(&showVersion, "v", false, "show version")
+		},
+		PersistentFlags: func(fs *flag.FlagSet) {
+			// Exported so the server processes homegit starts use the same config
+			fs.Func("config", "use the config file at `path` instead of ~/.homegit/config", func(path string) error {
+				abs, err := filepath.Abs(path)
+				if err != nil {
+					return err
+				}
+				return os.Setenv(config.EnvConfig, abs)
+			})
+			fs.BoolVar(&a.nonInteractive, "non-interactive", false, "fail instead of prompting")
+		},
+	}
+	root.Run = func([]string) error {
+		if showVersion {
+			return cmd.ShowVersion(output.Table)
+		}
+		return a.help(root, nil)
+	}
+
+	root.Add(
+		a.setupCommand(),
+		a.initCommand(),
+		a.configCommand(),
+		a.profileCommand(),
+		&cli.Command{Name: "serve", Short: "Start server in foreground",
+			Run: func([]string) error { return cmd.Serve(a.config()) }},
+		&cli.Command{Name: "supervise", Short: "Run the server under the restarting supervisor", Hidden: true,
+			Run: func([]string) error { return cmd.Supervise(a.config()) }},
+		&cli.Command{Name: "start", Short: "Start server as daemon",
+			Run: func([]string) error { return cmd.Start(a.config()) }},
+		&cli.Command{Name: "stop", Short: "Stop daemon server",
+			Run: func([]string) error { return cmd.Stop(a.config()) }},
+		&cli.Command{Name: "restart", Short: "Restart daemon server",
+			Run: func([]string) error { return cmd.Restart(a.config()) }},
+		&cli.Command{Name: "reload", Short: "Reload daemon config without restarting",
+			Run: func([]string) error { return cmd.Reload(a.config()) }},
+		a.statusCommand(),
+		a.sessionsCommand(),
+		a.maintenanceCommand(),
+		a.replicationCommand(),
+		a.hostkeyCommand(),
+		a.serviceCommand(),
+		a.listCommand(),
+		&cli.Command{Name: "ui", Short: "Browse and manage repositories in a full-screen view",
+			Long: "Keys: arrows or j/k move, / filters, c clones into the current directory, b backs up, r renames, e sets the description, d removes, q quits.",
+			Run:  func([]string) error { return cmd.UI(a.config()) }},
+		a.cloneCommand(),
+		a.syncCommand(),
+		a.importCommand(),
+		a.exportCommand(),
+		a.backupCommand(),
+		a.removeCommand(),
+		a.logsCommand(),
+		a.auditCommand(),
+		a.doctorCommand(),
+		&cli.Command{Name: "version", Short: "Show version",
+			Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+			Run: func([]string) error { return cmd.ShowVersion(a.format) }},
+		a.completionCommand(root),
+		a.helpCommand(root),
+	)
+	return root
+}
+
+// outputFlags registers --output and -o alongside a command's other
+// flags, for commands that can print JSON or YAML.
+func (a *app) outputFlags(flags func(fs *flag.FlagSet)) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		if flags != nil {
+			flags(fs)
+		}
+		usage := "print as `format`: " + strings.Join(output.Formats, ", ")
+		fs.Var(&a.format, "output", usage)
+		fs.Var(&a.format, "o", usage)
+	}
+}
+
+// outputValues adds completion of --output to a command's flag values.
+func outputValues(values map[string]func() []string) map[string]func() []string {
+	if values == nil {
+		values = make(map[string]func() []string)
+	}
+	formats := func() []string { return output.Formats }
+	values["output"], values["o"] = formats, formats
+	return values
+}
+
+func (a *app) prompts(yes bool) cmd.Prompts {
+	return cmd.Prompts{Yes: yes, NonInteractive: a.nonInteractive}
+}
+
+func (a *app) setupCommand() *cli.Command {
+	return &cli.Command{
+		Name:  "setup",
+		Short: "Configure homegit (server or client)",
+		Run:   func([]string) error { return cmd.Setup() },
+	}
+}
+
+func (a *app) initCommand() *cli.Command {
+	var profile string
+	var addRemotes cli.StringList
+	return &cli.Command{
+		Name:  "init",
+		Short: "Initialize git repo and add remote",
+		Long:  "Initializes the current directory as a git repository with origin on the homegit server.",
+		Flags: func(fs *flag.FlagSet) {
+			fs.StringVar(&profile, "profile", "", "use the server of profile `name`")
+			fs.Var(&addRemotes, "add-remote", "also add a remote on the server of `profile`, named after it (repeatable)")
+		},
+		FlagValues: map[string]func() []string{"profile": a.profileNames, "add-remote": a.profileNames},
+		Run: func([]string) error {
+			return cmd.Init(a.config(), profile, addRemotes)
+		},
+	}
+}
+
+func (a *app) configCommand() *cli.Command {
+	var effective bool
+	c := &cli.Command{
+		Name:  "config",
+		Short: "Edit, validate or show configuration",
+		Long:  "Without a subcommand, opens the config file in $EDITOR.",
+		Run:   func([]string) error { return cmd.ConfigEdit() },
+	}
+	keyArg := func(args []string) []string {
+		if len(args) > 0 {
+			return nil
+		}
+		return settingKeys()
+	}
+	c.Add(
+		&cli.Command{Name: "validate", Short: "Check the config for errors and unknown settings",
+			Run: func([]string) error { return cmd.ConfigValidate() }},
+		&cli.Command{Name: "migrate", Short: "Rewrite the config file in the current version",
+			Long: "Older files are read as the current version as they are; this updates the file itself, keeping the original next to it. The server does this when it starts.",
+			Run:  func([]string) error { return cmd.ConfigMigrate() }},
+		&cli.Command{Name: "show", Short: "Print the config file",
+			Flags: a.outputFlags(func(fs *flag.FlagSet) {
+				fs.BoolVar(&effective, "effective", false, "show every resolved setting and where it came from")
+			}),
+			FlagValues: outputValues(nil),
+			Run:        func([]string) error { return cmd.ConfigShow(effective, a.format) }},
+		&cli.Command{Name: "get", Args: "<key>", Short: "Print one setting", MinArgs: 1, MaxArgs: 1,
+			Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+			Complete: keyArg,
+			Run:      func(args []string) error { return cmd.ConfigGet(args[0], a.format) }},
+		&cli.Command{Name: "set", Args: "<key> <value>", Short: "Change one setting in the config file", MinArgs: 2, MaxArgs: 2,
+			Complete: keyArg,
+			Run:      func(args []string) error { return cmd.ConfigSet(args[0], args[1]) }},
+		&cli.Command{Name: "unset", Args: "<key>", Short: "Remove a setting so its default applies", MinArgs: 1, MaxArgs: 1,
+			Complete: keyArg,
+			Run:      func(args []string) error { return cmd.ConfigUnset(args[0]) }},
+	)
+	return c
+}
+
+func settingKeys() []string {
+	var keys []string
+	for _, s := range config.Default().Settings() {
+		if s.Key != "version" {
+			keys = append(keys, s.Key)
+		}
+	}
+	return keys
+}
+
+func (a *app) profileNames() []string {
+	cfg := a.quietConfig()
+	if cfg == nil {
+		return nil
+	}
+	return append([]string{config.DefaultProfile}, cfg.ProfileNames()...)
+}
+
+func (a *app) profileCommand() *cli.Command {
+	var host string
+	var port int
+	profileArg := func(args []string) []string {
+		if len(args) > 0 {
+			return nil
+		}
+		return a.profileNames()
+	}
+	c := &cli.Command{
+		Name:  "profile",
+		Short: "Add or switch between homegit servers",
+		Long:  `The "default" profile is the server_host and port settings.`,
+		Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+		Run: func([]string) error { return cmd.ProfileList(a.config(), a.format) },
+	}
+	c.Add(
+		&cli.Command{Name: "list", Short: "List profiles, marking the active one",
+			Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+			Run: func([]string) error { return cmd.ProfileList(a.config(), a.format) }},
+		&cli.Command{Name: "add", Args: "<name>", Short: "Add or replace a profile", MinArgs: 1, MaxArgs: 1,
+			Flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&host, "host", "", "server `host` name or address (required)")
+				fs.IntVar(&port, "port", config.Default().Port, "server SSH `port`")
+			},
+			Run: func(args []string) error { return cmd.ProfileAdd(args[0], host, port) }},
+		&cli.Command{Name: "use", Args: "<name>", Short: "Make a profile the active one", MinArgs: 1, MaxArgs: 1,
+			Complete: profileArg,
+			Run:      func(args []string) error { return cmd.ProfileUse(args[0]) }},
+		&cli.Command{Name: "remove", Args: "<name>", Short: "Delete a profile", MinArgs: 1, MaxArgs: 1,
+			Complete: profileArg,
+			Run:      func(args []string) error { return cmd.ProfileRemove(args[0]) }},
+	)
+	return c
+}
+
+func (a *app) statusCommand() *cli.Command {
+	var verbose, offline bool
+	var workspace string
+	return &cli.Command{
+		Name:  "status",
+		Short: "Check daemon status, or the clones in a workspace",
+		Long:  "With --workspace, finds the clones under dir whose origin is a homegit server and shows uncommitted changes, unpushed commits, branches without an upstream and branches with newer commits on the server.",
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.BoolVar(&verbose, "verbose", false, "show uptime, maintenance mode and sessions")
+			fs.BoolVar(&verbose, "v", false, "show uptime, maintenance mode and sessions")
+			fs.StringVar(&workspace, "workspace", "", "check the clones under `dir` instead")
+			fs.BoolVar(&offline, "offline", false, "with --workspace, don't ask the server for newer commits")
+		}),
+		FlagValues: outputValues(nil),
+		Run: func([]string) error {
+			if workspace != "" {
+				return cmd.WorkspaceStatus(a.config(), workspace, offline, a.format)
+			}
+			return cmd.Status(a.config(), verbose, a.format)
+		},
+	}
+}
+
+func (a *app) sessionsCommand() *cli.Command {
+	c := &cli.Command{
+		Name:  "sessions",
+		Short: "List or kill active sessions",
+		Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+		Run: func([]string) error { return cmd.Sessions(a.config(), a.format) },
+	}
+	c.Add(&cli.Command{Name: "kill", Args: "<id>", Short: "Cancel an active session", MinArgs: 1, MaxArgs: 1,
+		Run: func(args []string) error { return cmd.KillSession(a.config(), args[0]) }})
+	return c
+}
+
+func (a *app) maintenanceCommand() *cli.Command {
+	return &cli.Command{
+		Name:    "maintenance",
+		Args:    "[on|off]",
+		Short:   "Turn maintenance (read-only) mode on or off",
+		Long:    "In maintenance mode pushes are refused while fetches keep working. Without an argument, shows the current mode.",
+		MaxArgs: 1,
+		Flags:   a.outputFlags(nil), FlagValues: outputValues(nil),
+		Complete: func([]string) []string { return []string{"on", "off"} },
+		Run: func(args []string) error {
+			state := ""
+			if len(args) > 0 {
+				state = args[0]
+			}
+			return cmd.Maintenance(a.config(), state, a.format)
+		},
+	}
+}
+
+func (a *app) replicationCommand() *cli.Command {
+	var yes bool
+	c := &cli.Command{
+		Name:  "replication",
+		Short: "Show replication to standby servers, or promote a standby",
+		Long:  "A primary lists its standbys under replicas and pushes every change to them; each standby sets replica_of to the primary. Both set the same replication_secret.",
+		Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+		Run: func([]string) error { return cmd.ReplicationStatus(a.config(), a.format) },
+	}
+	c.Add(
+		&cli.Command{Name: "status", Short: "Show the role and, on a primary, each replica's lag per repository",
+			Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+			Run: func([]string) error { return cmd.ReplicationStatus(a.config(), a.format) }},
+		&cli.Command{Name: "pin", Short: "Fetch each replica's host key and pin it in ~/.ssh/known_hosts",
+			Long: "Run on the primary as the server's user. Replication only connects to replicas whose host key is pinned; compare each key with 'homegit hostkey show' on the replica.",
+			Flags: func(fs *flag.FlagSet) {
+				fs.BoolVar(&yes, "yes", false, "trust the keys without asking")
+				fs.BoolVar(&yes, "y", false, "trust the keys without asking")
+			},
+			Run: func([]string) error { return cmd.ReplicationPin(a.config(), a.prompts(yes)) }},
+		&cli.Command{Name: "promote", Short: "Make this standby accept pushes, for failover",
+			Run: func([]string) error { return cmd.ReplicationPromote(a.config()) }},
+	)
+	return c
+}
+
+func (a *app) hostkeyCommand() *cli.Command {
+	var profile string
+	var yes bool
+	var types []string
+	var finish bool
+	c := &cli.Command{Name: "hostkey", Short: "Show or rotate the server's host keys, or pin a server's key on a client"}
+	c.Add(
+		&cli.Command{Name: "show", Short: "Show the host keys' fingerprints, randomart and known_hosts lines",
+			Flags: a.outputFlags(nil), FlagValues: outputValues(nil),
+			Run: func([]string) error { return cmd.HostKeyShow(a.config(), a.format) }},
+		&cli.Command{Name: "pin", Short: "Fetch the server's host key and pin it in ~/.ssh/known_hosts",
+			Long: "Shows the key the server presents and asks before trusting it; compare it with 'homegit hostkey show' on the server.",
+			Flags: func(fs *flag.FlagSet) {
+				fs.StringVar(&profile, "profile", "", "pin the key of the server of profile `name`")
+				fs.BoolVar(&yes, "yes", false, "trust the key without asking")
+				fs.BoolVar(&yes, "y", false, "trust the key without asking")
+			},
+			FlagValues: map[string]func() []string{"profile": a.profileNames},
+			Run:        func([]string) error { return cmd.HostKeyPin(a.config(), profile, a.prompts(yes)) }},
+		&cli.Command{Name: "rotate", Short: "Replace the server's host keys after a grace period",
+			Long: "Writes a new key of each type, or only --type, and announces it to clients; it replaces the current key after host_key_grace days.",
+			Flags: func(fs *flag.FlagSet) {
+				fs.Func("type", "rotate only the key of `type` (repeatable): "+strings.Join(hostkey.Types, ", "), func(typ string) error {
+					types = append(types, typ)
+					return nil
+				})
+				fs.BoolVar(&finish, "finish", false, "switch to the new keys now instead of waiting for the grace period")
+			},
+			FlagValues: map[string]func() []string{"type": func() []string { return hostkey.Types }},
+			Run:        func([]string) error { return cmd.HostKeyRotate(a.config(), types, finish) }},
+	)
+	return c
+}
+
+func (a *app) serviceCommand() *cli.Command {
+	var useSystemd, userUnits bool
+	flags := func(fs *flag.FlagSet) {
+		fs.BoolVar(&useSystemd, "systemd", false, "use systemd")
+		fs.BoolVar(&userUnits, "user", false, "use the user's systemd instance instead of the system one")
+	}
+	c := &cli.Command{Name: "service", Short: "Install or uninstall systemd units (Linux)"}
+	c.Add(
+		&cli.Command{Name: "install", Short: "Install and start the systemd units", Flags: flags,
+			Run: func([]string) error { return cmd.Service(a.config(), "install", useSystemd, userUnits) }},
+		&cli.Command{Name: "uninstall", Short: "Stop and remove the systemd units", Flags: flags,
+			Run: func([]string) error { return cmd.Service(a.config(), "uninstall", useSystemd, userUnits) }},
+	)
+	return c
+}
+
+func (a *app) doctorCommand() *cli.Command {
+	var profile string
+	return &cli.Command{
+		Name:  "doctor",
+		Short: "Check the server and client setup",
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.StringVar(&profile, "profile", "", "check the server of profile `name`")
+		}),
+		FlagValues: outputValues(map[string]func() []string{"profile": a.profileNames}),
+		Run: func([]string) error {
+			cfg, err := a.loadConfig()
+			return cmd.Doctor(cfg, err, profile, a.format)
+		},
+	}
+}
+
+func (a *app) listCommand() *cli.Command {
+	var profile string
+	return &cli.Command{
+		Name:  "list",
+		Short: "List all repositories",
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.StringVar(&profile, "profile", "", "list the server of profile `name`")
+		}),
+		FlagValues: outputValues(map[string]func() []string{"profile": a.profileNames}),
+		Run:        func([]string) error { return cmd.List(a.config(), profile, a.format) },
+	}
+}
+
+// repoArg completes a single repository argument from the configured
+// server.
+func (a *app) repoArg(args []string) []string {
+	cfg := a.quietConfig()
+	if cfg == nil || len(args) > 0 {
+		return nil
+	}
+	return cmd.RepoNames(cfg)
+}
+
+// yesFlags registers --yes and -y on a command that can prompt.
+func yesFlags(yes *bool) func(fs *flag.FlagSet) {
+	return func(fs *flag.FlagSet) {
+		fs.BoolVar(yes, "yes", false, "don't prompt: confirm, and fail instead of asking which repository")
+		fs.BoolVar(yes, "y", false, "don't prompt: confirm, and fail instead of asking which repository")
+	}
+}
+
+func (a *app) cloneCommand() *cli.Command {
+	var profile string
+	var yes bool
+	return &cli.Command{
+		Name:    "clone",
+		Args:    "[repo]",
+		Short:   "Clone a repository from the server",
+		Long:    "Without a repository name, lists the server's repositories to pick from.",
+		MaxArgs: 1,
+		Flags: func(fs *flag.FlagSet) {
+			yesFlags(&yes)(fs)
+			fs.StringVar(&profile, "profile", "", "clone from the server of profile `name`")
+		},
+		FlagValues: map[string]func() []string{"profile": a.profileNames},
+		Complete:   a.repoArg,
+		Run: func(args []string) error {
+			return cmd.Clone(a.config(), profile, optional(args), a.prompts(yes))
+		},
+	}
+}
+
+func (a *app) syncCommand() *cli.Command {
+	var profile string
+	var jobs int
+	return &cli.Command{
+		Name:    "sync",
+		Args:    "<dir>",
+		Short:   "Clone or update every repository into a directory",
+		Long:    "Clones repositories missing from dir, with namespaces as subdirectories, and fast-forwards the clones already there. Clones with local changes or unpushed commits are skipped.",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.StringVar(&profile, "profile", "", "sync from the server of profile `name`")
+			fs.IntVar(&jobs, "jobs", 4, "repositories to sync at a time")
+			fs.IntVar(&jobs, "j", 4, "repositories to sync at a time")
+		}),
+		FlagValues: outputValues(map[string]func() []string{"profile": a.profileNames}),
+		Run: func(args []string) error {
+			return cmd.Sync(a.config(), profile, args[0], jobs, a.format)
+		},
+	}
+}
+
+func (a *app) importCommand() *cli.Command {
+	var namespace string
+	var jobs int
+	return &cli.Command{
+		Name:    "import",
+		Args:    "<source>",
+		Short:   "Import repositories from a directory, a URL or a list of URLs",
+		Long:    "source is a directory tree of bare repositories, working copies and bundles (such as one from 'homegit export'), a repository URL, or a file with one URL per line. Each repository is mirrored with all its refs into the repos directory, under --namespace if given, and keeps its description. Existing repositories are skipped.",
+		MinArgs: 1,
+		MaxArgs: 1,
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.StringVar(&namespace, "namespace", "", "import under namespace `ns`, e.g. github")
+			fs.IntVar(&jobs, "jobs", 4, "repositories to import at a time")
+			fs.IntVar(&jobs, "j", 4, "repositories to import at a time")
+		}),
+		FlagValues: outputValues(nil),
+		Run: func(args []string) error {
+			return cmd.Import(a.config(), args[0], namespace, jobs, a.format)
+		},
+	}
+}
+
+func (a *app) exportCommand() *cli.Command {
+	var all bool
+	var manifest string
+	var jobs int
+	c := &cli.Command{
+		Name:    "export",
+		Args:    "<repo|--all> <dest>",
+		Short:   "Export repositories as bundles or push them to another server",
+		Long:    "dest is a directory, which gets a git bundle per repository, or a URL each repository is mirror-pushed to. In the URL, {repo} becomes the repository's name with its namespace (team/app) and {name} the name alone (app), e.g. git@github.com:me/{name}.git. A JSON manifest records descriptions, default branches and hooks. 'homegit import' reads an export directory back in.",
+		MinArgs: 1,
+		MaxArgs: 2,
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.BoolVar(&all, "all", false, "export every repository")
+			fs.StringVar(&manifest, "manifest", "", "write the manifest to `file` instead of "+cmd.ManifestFile+" in dest, or in the current directory for a URL")
+			fs.IntVar(&jobs, "jobs", 4, "repositories to export at a time")
+			fs.IntVar(&jobs, "j", 4, "repositories to export at a time")
+		}),
+		FlagValues: outputValues(nil),
+		Complete:   a.repoArg,
+	}
+	c.Run = func(args []string) error {
+		if all != (len(args) == 1) {
+			return &cli.UsageError{Command: c, Err: fmt.Errorf("%s needs %s", c.Path(), c.Args)}
+		}
+		repo := ""
+		if !all {
+			repo = args[0]
+		}
+		return cmd.Export(a.config(), repo, all, args[len(args)-1], manifest, jobs, a.format)
+	}
+	return c
+}
+
+func (a *app) backupCommand() *cli.Command {
+	var yes bool
+	return &cli.Command{
+		Name:       "backup",
+		Args:       "[repo]",
+		Short:      "Backup a repository to tar.gz",
+		MaxArgs:    1,
+		Flags:      a.outputFlags(yesFlags(&yes)),
+		FlagValues: outputValues(nil),
+		Complete:   a.repoArg,
+		Run: func(args []string) error {
+			return cmd.Backup(a.config(), optional(args), a.prompts(yes), a.format)
+		},
+	}
+}
+
+func (a *app) removeCommand() *cli.Command {
+	var yes bool
+	return &cli.Command{
+		Name:     "remove",
+		Args:     "[repo]",
+		Short:    "Remove a repository",
+		MaxArgs:  1,
+		Flags:    yesFlags(&yes),
+		Complete: a.repoArg,
+		Run: func(args []string) error {
+			return cmd.Remove(a.config(), optional(args), a.prompts(yes))
+		},
+	}
+}
+
+// optional returns the single optional argument, or "".
+func optional(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
+
+func (a *app) logsCommand() *cli.Command {
+	var opts cmd.LogsOptions
+	return &cli.Command{
+		Name:  "logs",
+		Short: "View server logs",
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			usage := "show the last `n` lines (default 50, or all of --since/--until)"
+			fs.IntVar(&opts.Tail, "tail", 0, usage)
+			fs.IntVar(&opts.Tail, "n", 0, usage)
+			fs.BoolVar(&opts.Follow, "follow", false, "keep printing new lines")
+			fs.BoolVar(&opts.Follow, "f", false, "keep printing new lines")
+			fs.StringVar(&opts.Level, "level", "", "minimum `level`: debug, info, warn or error")
+			fs.StringVar(&opts.Repo, "repo", "", "only lines about repository `name`")
+			fs.StringVar(&opts.Since, "since", "", "only lines after `time`, e.g. 2h or 2026-01-18")
+			fs.StringVar(&opts.Until, "until", "", "only lines before `time`")
+		}),
+		FlagValues: outputValues(map[string]func() []string{
+			"level": func() []string { return []string{"debug", "info", "warn", "error"} },
+			"repo":  func() []string { return a.repoArg(nil) },
+		}),
+		Run: func([]string) error {
+			opts.Format = a.format
+			return cmd.Logs(a.config(), opts)
+		},
+	}
+}
+
+func (a *app) auditCommand() *cli.Command {
+	var repo, user, since string
+	return &cli.Command{
+		Name:  "audit",
+		Short: "Show who pushed and fetched what",
+		Flags: a.outputFlags(func(fs *flag.FlagSet) {
+			fs.StringVar(&repo, "repo", "", "only operations on repository `name`")
+			fs.StringVar(&user, "user", "", "only operations by the SSH `user` name clients gave (unauthenticated)")
+			fs.StringVar(&since, "since", "", "only operations after `time`, e.g. 24h or 2026-01-18")
+		}),
+		FlagValues: outputValues(map[string]func() []string{"repo": func() []string { return a.repoArg(nil) }}),
+		Run:        func([]string) error { return cmd.Audit(a.config(), repo, user, since, a.format) },
+	}
+}
+
+func (a *app) completionCommand(root *cli.Command) *cli.Command {
+	return &cli.Command{
+		Name:  "completion",
+		Args:  "<bash|zsh|fish>",
+		Short: "Print a shell completion script",
+		Long: `Load completion in the current shell with:
+  bash:  source <(homegit completion bash)
+  zsh:   source <(homegit completion zsh)
+  fish:  homegit completion fish | source`,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Complete: func([]string) []string { return []string{"bash", "zsh", "fish"} },
+		Run: func(args []string) error {
+			return root.WriteCompletion(os.Stdout, args[0])
+		},
+	}
+}
+
+func (a *app) helpCommand(root *cli.Command) *cli.Command {
+	return &cli.Command{
+		Name:    "help",
+		Args:    "[command]",
+		Short:   "Show help for homegit or a command",
+		MaxArgs: -1,
+		Complete: func(args []string) []string {
+			return root.Completions(append(args, ""))
+		},
+		Run: func(args []string) error { return a.help(root, args) },
+	}
+}
+
+// help prints help for the command named by path, or the command list
+// and this server's details.
+func (a *app) help(root *cli.Command, path []string) error {
+	c := root
+	for _, name := range path {
+		if c = c.Find(name); c == nil {
+			return &cli.UsageError{Command: root, Err: fmt.Errorf("unknown command %q", name)}
+		}
+	}
+	c.PrintHelp(os.Stdout)
+	if c != root {
+		return nil
+	}
+	fmt.Println()
+	return cmd.Help(a.config())
+}
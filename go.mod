@@ -4,4 +4,7 @@ go 1.24.1
 
 require golang.org/x/crypto v0.47.0
 
-require golang.org/x/sys v0.40.0 // indirect
+require (
+	golang.org/x/sys v0.40.0
+	golang.org/x/term v0.39.0
+)
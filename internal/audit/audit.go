@@ -0,0 +1,176 @@
+// Package audit keeps an append-only record of every git operation the
+// server runs: who did what to which repo, and how it ended.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/logrotate"
+)
+
+// Operations recorded in the audit log.
+const (
+	OpClone   = "clone"
+	OpFetch   = "fetch"
+	OpPush    = "push"
+	OpArchive = "archive"
+)
+
+// Results recorded in the audit log. A rejected push ran, but
+// receive-pack refused some of its ref updates; the refs say which.
+const (
+	ResultOK       = "ok"
+	ResultFailed   = "failed"
+	ResultRefused  = "refused"
+	ResultRejected = "rejected"
+)
+
+// Record is one line of the audit log.
+type Record struct {
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remote_addr"`
+	// SSHUser is the user name the client connected with. homegit doesn't
+	// authenticate clients, so it is whatever the client claimed.
+	SSHUser    string          `json:"ssh_user"`
+	Repo       string          `json:"repo"`
+	Operation  string          `json:"op"`
+	Refs       []git.RefUpdate `json:"refs,omitempty"`
+	Result     string          `json:"result"`
+	Error      string          `json:"error,omitempty"`
+	BytesIn    int64           `json:"bytes_in"`
+	BytesOut   int64           `json:"bytes_out"`
+	DurationMS int64           `json:"duration_ms"`
+}
+
+// UnmarshalJSON also reads records written before ssh_user was named
+// user.
+func (r *Record) UnmarshalJSON(data []byte) error {
+	type plain Record
+	var rec struct {
+		plain
+		User string `json:"user"`
+	}
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return err
+	}
+	*r = Record(rec.plain)
+	if r.SSHUser == "" {
+		r.SSHUser = rec.User
+	}
+	return nil
+}
+
+var (
+	appendMu sync.Mutex
+	// writer stays open between records, for the path it was opened at
+	writer     *logrotate.Writer
+	writerPath string
+)
+
+// Append adds rec to the audit log at path, one JSON object per line,
+// rotating the file according to policy.
+func Append(path string, policy logrotate.Policy, rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	appendMu.Lock()
+	defer appendMu.Unlock()
+
+	// Only the server should be able to read who did what
+	policy.Perm = 0600
+	if writer == nil || writerPath != path {
+		if writer != nil {
+			writer.Close()
+			writer = nil
+		}
+		w, err := logrotate.Open(path, policy)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		writer, writerPath = w, path
+	}
+	writer.SetPolicy(policy)
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return nil
+}
+
+// Filter selects audit records. Zero fields match everything.
+type Filter struct {
+	Repo    string
+	SSHUser string
+	Since   time.Time
+}
+
+func (f Filter) match(rec Record) bool {
+	if f.Repo != "" && repoKey(rec.Repo) != repoKey(f.Repo) {
+		return false
+	}
+	if f.SSHUser != "" && rec.SSHUser != f.SSHUser {
+		return false
+	}
+	if !f.Since.IsZero() && rec.Time.Before(f.Since) {
+		return false
+	}
+	return true
+}
+
+// repoKey normalizes "/name.git", "name.git" and "name" to the same value.
+func repoKey(repo string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(repo, "/"), ".git")
+}
+
+// Read returns the records in the audit log at path, including its rotated
+// segments, that match filter, oldest first. A missing log has no records.
+func Read(path string, filter Filter) ([]Record, error) {
+	segments, err := logrotate.Segments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	for _, segment := range segments {
+		// A segment's rotation time is its newest record
+		if rotated, ok := logrotate.RotatedAt(path, segment); ok && !filter.Since.IsZero() && rotated.Before(filter.Since) {
+			continue
+		}
+		found, err := readSegment(segment, filter)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, found...)
+	}
+	return records, nil
+}
+
+func readSegment(segment string, filter Filter) ([]Record, error) {
+	f, err := logrotate.OpenSegment(segment)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var rec Record
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", segment, line, err)
+		}
+		if filter.match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,104 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/logrotate"
+)
+
+func TestAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+
+	records := []Record{
+		{Time: now.Add(-2 * time.Hour), SSHUser: "alice", Repo: "app.git", Operation: OpClone, Result: ResultOK},
+		{Time: now.Add(-time.Hour), SSHUser: "bob", Repo: "app.git", Operation: OpPush, Result: ResultOK,
+			Refs: []git.RefUpdate{{Ref: "refs/heads/main", Old: git.ZeroID, New: "abc"}}},
+		{Time: now, SSHUser: "alice", Repo: "tools/cli.git", Operation: OpFetch, Result: ResultFailed, Error: "boom"},
+	}
+	for _, rec := range records {
+		if err := Append(path, logrotate.Policy{}, rec); err != nil {
+			t.Fatalf("Append failed: %v", err)
+		}
+	}
+
+	all, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 records, got %d", len(all))
+	}
+	if len(all[1].Refs) != 1 || all[1].Refs[0].Ref != "refs/heads/main" {
+		t.Errorf("Expected ref update to round-trip, got %+v", all[1].Refs)
+	}
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"by repo", Filter{Repo: "app"}, 2},
+		{"by repo with slash", Filter{Repo: "/tools/cli.git"}, 1},
+		{"by user", Filter{SSHUser: "alice"}, 2},
+		{"since", Filter{Since: now.Add(-90 * time.Minute)}, 2},
+		{"combined", Filter{SSHUser: "alice", Since: now.Add(-90 * time.Minute)}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(path, tt.filter)
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if len(got) != tt.want {
+				t.Errorf("Expected %d records, got %d", tt.want, len(got))
+			}
+		})
+	}
+}
+
+func TestReadMissing(t *testing.T) {
+	records, err := Read(filepath.Join(t.TempDir(), "audit.log"), Filter{})
+	if err != nil {
+		t.Fatalf("Expected no error for missing log, got %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("Expected no records, got %d", len(records))
+	}
+}
+
+func TestReadRotated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	now := time.Now()
+
+	// A record from before ssh_user was named, in a rotated segment
+	old := `{"time":"` + now.Add(-time.Hour).Format(time.RFC3339) + `","user":"alice","repo":"app.git","op":"clone","result":"ok"}` + "\n"
+	if err := os.WriteFile(path+".20060102-150405", []byte(old), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rec := Record{Time: now, SSHUser: "bob", Repo: "app.git", Operation: OpPush, Result: ResultRejected}
+	if err := Append(path, logrotate.Policy{}, rec); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	got, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(got))
+	}
+	if got[0].SSHUser != "alice" {
+		t.Errorf("Expected the legacy user field to be read, got %q", got[0].SSHUser)
+	}
+	if got[1].Result != ResultRejected {
+		t.Errorf("Expected the live segment last, got %+v", got[1])
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private audit log, got %v, %v", info, err)
+	}
+}
@@ -0,0 +1,376 @@
+// Package cli is homegit's command tree: each command declares its flags,
+// arguments and help text, and the tree provides --help, usage errors and
+// shell completion. Flags are parsed with the standard flag package and
+// may appear before, after or between arguments.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Command is a node in the command tree. A command either runs or groups
+// subcommands; a grouping command with a Run func runs it when no
+// subcommand is given.
+type Command struct {
+	Name  string
+	Args  string // positional arguments for the usage line, e.g. "[repo]"
+	Short string // one line shown in the parent's command list
+	Long  string // optional paragraph shown in the command's help
+
+	// Hidden commands run and complete but aren't listed in help.
+	Hidden bool
+
+	// Flags registers the command's own flags. PersistentFlags registers
+	// flags that also apply to every subcommand.
+	Flags           func(fs *flag.FlagSet)
+	PersistentFlags func(fs *flag.FlagSet)
+
+	// MinArgs and MaxArgs bound the positional arguments. MaxArgs < 0
+	// allows any number.
+	MinArgs, MaxArgs int
+
+	Run func(args []string) error
+
+	// Complete suggests values for the next positional argument, given
+	// the ones before it. FlagValues suggests values for flags by name.
+	Complete   func(args []string) []string
+	FlagValues map[string]func() []string
+
+	Subcommands []*Command
+
+	parent *Command
+	fs     *flag.FlagSet
+	pfs    *flag.FlagSet
+}
+
+// UsageError is a mistake in how a command was invoked.
+type UsageError struct {
+	Command *Command
+	Err     error
+}
+
+func (e *UsageError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *UsageError) Unwrap() error {
+	return e.Err
+}
+
+// Add appends subcommands to c.
+func (c *Command) Add(subs ...*Command) {
+	for _, sub := range subs {
+		sub.parent = c
+		c.Subcommands = append(c.Subcommands, sub)
+	}
+}
+
+// Path returns the command's full name, e.g. "homegit config set".
+func (c *Command) Path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.Path() + " " + c.Name
+}
+
+// Find returns the subcommand called name, or nil.
+func (c *Command) Find(name string) *Command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// persistent returns the flag set holding c's persistent flags. Values
+// are bound once, so a flag parsed on a parent keeps its value when a
+// subcommand's flags are parsed.
+func (c *Command) persistent() *flag.FlagSet {
+	if c.pfs == nil {
+		c.pfs = flag.NewFlagSet(c.Name, flag.ContinueOnError)
+		if c.PersistentFlags != nil {
+			c.PersistentFlags(c.pfs)
+		}
+	}
+	return c.pfs
+}
+
+// flags returns the set of flags c accepts: its own, its persistent
+// flags and those of its ancestors.
+func (c *Command) flags() *flag.FlagSet {
+	if c.fs != nil {
+		return c.fs
+	}
+	fs := flag.NewFlagSet(c.Path(), flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	if c.Flags != nil {
+		c.Flags(fs)
+	}
+	for cmd := c; cmd != nil; cmd = cmd.parent {
+		cmd.persistent().VisitAll(func(f *flag.Flag) {
+			if fs.Lookup(f.Name) == nil {
+				fs.Var(f.Value, f.Name, f.Usage)
+			}
+		})
+	}
+	c.fs = fs
+	return fs
+}
+
+// Execute parses args, the command line without the program name, and
+// runs the command they select. -h or --help prints that command's help.
+func (c *Command) Execute(args []string) error {
+	cmd, positional, err := c.parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		cmd.PrintHelp(os.Stdout)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(cmd.Subcommands) > 0 && len(positional) > 0 && cmd.MaxArgs == 0 {
+		return &UsageError{cmd, fmt.Errorf("unknown command %q for %s", positional[0], cmd.Path())}
+	}
+	if cmd.Run == nil {
+		cmd.PrintHelp(os.Stdout)
+		return nil
+	}
+	if len(positional) < cmd.MinArgs {
+		return &UsageError{cmd, fmt.Errorf("%s needs %s", cmd.Path(), cmd.Args)}
+	}
+	if cmd.MaxArgs >= 0 && len(positional) > cmd.MaxArgs {
+		return &UsageError{cmd, fmt.Errorf("too many arguments for %s", cmd.Path())}
+	}
+	return cmd.Run(positional)
+}
+
+// parse walks args down the tree, parsing each command's flags on the
+// way, and returns the selected command and its positional arguments.
+// Everything after "--" is positional, as with the flag package.
+func (c *Command) parse(args []string) (*Command, []string, error) {
+	cmd := c
+	var positional []string
+	for {
+		fs := cmd.flags()
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return cmd, nil, err
+			}
+			return cmd, nil, &UsageError{cmd, err}
+		}
+		rest := fs.Args()
+		if endedFlags(fs, args[:len(args)-len(rest)]) {
+			return cmd, append(positional, rest...), nil
+		}
+		args = rest
+		if len(args) == 0 {
+			return cmd, positional, nil
+		}
+		if len(positional) == 0 {
+			if sub := cmd.Find(args[0]); sub != nil {
+				cmd = sub
+				args = args[1:]
+				continue
+			}
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// endedFlags reports whether the flags fs parsed from consumed ended with
+// a "--" terminator rather than a flag's value that happens to be "--".
+func endedFlags(fs *flag.FlagSet, consumed []string) bool {
+	for i := 0; i < len(consumed); i++ {
+		arg := consumed[i]
+		if arg == "--" {
+			return true
+		}
+		name := strings.TrimLeft(arg, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := fs.Lookup(name); f != nil && !isBool(f) {
+			i++ // its value
+		}
+	}
+	return false
+}
+
+// PrintHelp writes c's usage, subcommands and flags.
+func (c *Command) PrintHelp(w io.Writer) {
+	if c.Short != "" {
+		fmt.Fprintf(w, "%s\n\n", c.Short)
+	}
+	if c.Long != "" {
+		fmt.Fprintf(w, "%s\n\n", strings.TrimSpace(c.Long))
+	}
+	fmt.Fprintf(w, "Usage:\n  %s\n", c.usageLine())
+
+	var subs []*Command
+	for _, sub := range c.Subcommands {
+		if !sub.Hidden {
+			subs = append(subs, sub)
+		}
+	}
+	if len(subs) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		width := 0
+		for _, sub := range subs {
+			width = max(width, len(sub.Name))
+		}
+		for _, sub := range subs {
+			fmt.Fprintf(w, "  %-*s  %s\n", width, sub.Name, sub.Short)
+		}
+	}
+
+	inherited := make(map[string]bool)
+	for cmd := c.parent; cmd != nil; cmd = cmd.parent {
+		cmd.persistent().VisitAll(func(f *flag.Flag) { inherited[f.Name] = true })
+	}
+	own := flagLines(c.flags(), func(name string) bool { return !inherited[name] })
+	global := flagLines(c.flags(), func(name string) bool { return inherited[name] })
+	for _, section := range []struct {
+		title string
+		lines []string
+	}{{"Flags", own}, {"Global flags", global}} {
+		if len(section.lines) == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, line := range section.lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+	if len(subs) > 0 {
+		fmt.Fprintf(w, "\nRun '%s <command> --help' for more about a command.\n", c.Path())
+	}
+}
+
+func (c *Command) usageLine() string {
+	parts := []string{c.Path()}
+	if len(c.Subcommands) > 0 {
+		if c.Run != nil {
+			parts = append(parts, "[command]")
+		} else {
+			parts = append(parts, "<command>")
+		}
+	}
+	if hasFlags(c.flags()) {
+		parts = append(parts, "[flags]")
+	}
+	if c.Args != "" {
+		parts = append(parts, c.Args)
+	}
+	return strings.Join(parts, " ")
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// flagLines describes each flag that include selects once, listing names
+// that share a value as aliases, e.g. "-f, --follow".
+func flagLines(fs *flag.FlagSet, include func(name string) bool) []string {
+	type entry struct {
+		names       []string
+		placeholder string
+		usage       string
+		def         string
+	}
+	var entries []*entry
+	byValue := make(map[any]*entry)
+	fs.VisitAll(func(f *flag.Flag) {
+		if !include(f.Name) {
+			return
+		}
+		// Aliases are registered on the same variable
+		key := any(f.Name)
+		if v := reflect.ValueOf(f.Value); v.Kind() == reflect.Pointer {
+			key = v.Pointer()
+		}
+		if e, ok := byValue[key]; ok {
+			e.names = append(e.names, f.Name)
+			return
+		}
+		placeholder, usage := flag.UnquoteUsage(f)
+		if isBool(f) {
+			placeholder = ""
+		}
+		e := &entry{names: []string{f.Name}, placeholder: placeholder, usage: usage, def: f.DefValue}
+		if isBool(f) || f.DefValue == "" || f.DefValue == "0" || f.DefValue == "[]" {
+			e.def = ""
+		}
+		byValue[key] = e
+		entries = append(entries, e)
+	})
+
+	// Line long names up when some flags have a short one
+	hasShort := false
+	for _, e := range entries {
+		sort.Slice(e.names, func(a, b int) bool { return len(e.names[a]) < len(e.names[b]) })
+		hasShort = hasShort || len(e.names[0]) == 1
+	}
+
+	var lines []string
+	names := make([]string, len(entries))
+	width := 0
+	for i, e := range entries {
+		var dashed []string
+		for _, name := range e.names {
+			if len(name) == 1 {
+				dashed = append(dashed, "-"+name)
+			} else {
+				dashed = append(dashed, "--"+name)
+			}
+		}
+		names[i] = strings.Join(dashed, ", ")
+		if hasShort && len(e.names[0]) > 1 {
+			names[i] = "    " + names[i]
+		}
+		if e.placeholder != "" {
+			names[i] += " " + e.placeholder
+		}
+		width = max(width, len(names[i]))
+	}
+	for i, e := range entries {
+		line := fmt.Sprintf("  %-*s  %s", width, names[i], e.usage)
+		if e.def != "" {
+			line += fmt.Sprintf(" (default %s)", e.def)
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func isBool(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// StringList is a flag that can be repeated, collecting every value.
+type StringList []string
+
+func (l *StringList) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *StringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTree builds "prog [--config path] clone [--yes] [--profile name] [repo]"
+// plus "prog config set <key> <value>", recording what ran.
+func testTree(ran *[]string, configPath *string, yes *bool) *Command {
+	root := &Command{
+		Name: "prog",
+		PersistentFlags: func(fs *flag.FlagSet) {
+			fs.StringVar(configPath, "config", "", "config `path`")
+		},
+	}
+	var profile string
+	clone := &Command{
+		Name: "clone", Args: "[repo]", Short: "Clone a repo", MaxArgs: 1,
+		Flags: func(fs *flag.FlagSet) {
+			fs.BoolVar(yes, "yes", false, "don't prompt")
+			fs.BoolVar(yes, "y", false, "don't prompt")
+			fs.StringVar(&profile, "profile", "", "server `name`")
+		},
+		Run: func(args []string) error {
+			*ran = append([]string{"clone", profile}, args...)
+			return nil
+		},
+		Complete:   func([]string) []string { return []string{"notes", "website"} },
+		FlagValues: map[string]func() []string{"profile": func() []string { return []string{"home", "office"} }},
+	}
+	config := &Command{Name: "config", Short: "Configure"}
+	config.Add(&Command{
+		Name: "set", Args: "<key> <value>", MinArgs: 2, MaxArgs: 2,
+		Run: func(args []string) error {
+			*ran = append([]string{"set"}, args...)
+			return nil
+		},
+	})
+	root.Add(clone, config)
+	return root
+}
+
+func TestExecuteInterspersedFlags(t *testing.T) {
+	var ran []string
+	var configPath string
+	var yes bool
+	root := testTree(&ran, &configPath, &yes)
+
+	if err := root.Execute([]string{"--config", "/tmp/c", "clone", "notes", "-y", "--profile", "office"}); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if want := []string{"clone", "office", "notes"}; !reflect.DeepEqual(ran, want) {
+		t.Errorf("Expected %v, got %v", want, ran)
+	}
+	if configPath != "/tmp/c" || !yes {
+		t.Errorf("Expected --config and -y to be set, got %q %v", configPath, yes)
+	}
+}
+
+func TestExecuteEndOfFlags(t *testing.T) {
+	var ran []string
+	var configPath string
+	var yes bool
+	root := testTree(&ran, &configPath, &yes)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"clone", "--", "-y"}, []string{"clone", "", "-y"}},
+		{[]string{"clone", "-y", "--", "--profile"}, []string{"clone", "", "--profile"}},
+		{[]string{"clone", "--profile", "--", "notes"}, []string{"clone", "--", "notes"}},
+		{[]string{"config", "set", "--", "-key", "-value"}, []string{"set", "-key", "-value"}},
+	}
+	for _, tt := range tests {
+		ran = nil
+		if err := root.Execute(tt.args); err != nil {
+			t.Errorf("%v: Execute failed: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(ran, tt.want) {
+			t.Errorf("%v: expected %v, got %v", tt.args, tt.want, ran)
+		}
+	}
+
+	// A subcommand's name after -- is an argument, not the subcommand
+	ran = nil
+	var usage *UsageError
+	if err := root.Execute([]string{"--", "clone"}); !errors.As(err, &usage) || ran != nil {
+		t.Errorf("Expected -- clone to be an unknown command, got %v, ran %v", err, ran)
+	}
+}
+
+func TestExecuteUsageErrors(t *testing.T) {
+	var ran []string
+	var configPath string
+	var yes bool
+	root := testTree(&ran, &configPath, &yes)
+
+	for _, args := range [][]string{
+		{"config", "set", "port"},
+		{"clone", "a", "b"},
+		{"clone", "--nope"},
+		{"config", "frobnicate"},
+	} {
+		err := root.Execute(args)
+		var usage *UsageError
+		if !errors.As(err, &usage) {
+			t.Errorf("%v: expected a usage error, got %v", args, err)
+		}
+	}
+	if ran != nil {
+		t.Errorf("Expected nothing to run, got %v", ran)
+	}
+}
+
+func TestHelp(t *testing.T) {
+	var ran []string
+	var configPath string
+	var yes bool
+	root := testTree(&ran, &configPath, &yes)
+
+	var b bytes.Buffer
+	root.Find("clone").PrintHelp(&b)
+	help := b.String()
+	for _, want := range []string{"prog clone [flags] [repo]", "-y, --yes", "--profile name", "--config path"} {
+		if !strings.Contains(help, want) {
+			t.Errorf("Help missing %q:\n%s", want, help)
+		}
+	}
+}
+
+func TestCompletions(t *testing.T) {
+	var ran []string
+	var configPath string
+	var yes bool
+	root := testTree(&ran, &configPath, &yes)
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{""}, []string{"clone", "config"}},
+		{[]string{"c"}, []string{"clone", "config"}},
+		{[]string{"config", ""}, []string{"set"}},
+		{[]string{"clone", "w"}, []string{"website"}},
+		{[]string{"clone", "notes", ""}, nil},
+		{[]string{"clone", "--profile", ""}, []string{"home", "office"}},
+		{[]string{"--config", "x", "clone", "--p"}, []string{"--profile"}},
+		{[]string{"clone", "--", "-"}, nil},
+		{[]string{"clone", "--", "w"}, []string{"website"}},
+		{[]string{"--", "c"}, nil},
+	}
+	for _, tt := range tests {
+		if got := root.Completions(tt.words); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Completions(%q) = %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
+
+func TestWriteCompletion(t *testing.T) {
+	root := &Command{Name: "prog"}
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var b bytes.Buffer
+		if err := root.WriteCompletion(&b, shell); err != nil {
+			t.Fatalf("%s: %v", shell, err)
+		}
+		if !strings.Contains(b.String(), "prog "+CompleteCommand) {
+			t.Errorf("%s script doesn't call %s:\n%s", shell, CompleteCommand, b.String())
+		}
+	}
+	if err := root.WriteCompletion(&bytes.Buffer{}, "tcsh"); err == nil {
+		t.Errorf("Expected an error for an unsupported shell")
+	}
+}
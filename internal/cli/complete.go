@@ -0,0 +1,132 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CompleteCommand is the hidden command the completion scripts call with
+// the words typed so far, the last one being completed.
+const CompleteCommand = "__complete"
+
+// Completions returns the candidates for the last of words, the command
+// line after the program name.
+func (c *Command) Completions(words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur := words[len(words)-1]
+
+	cmd := c
+	var positional []string
+	var pending *flag.Flag // a flag waiting for its value
+	ended := false         // past "--", where every word is an argument
+	for _, word := range words[:len(words)-1] {
+		fs := cmd.flags()
+		switch {
+		case ended:
+			positional = append(positional, word)
+		case pending != nil:
+			pending = nil
+		case word == "--":
+			ended = true
+		case strings.HasPrefix(word, "-") && word != "-":
+			name, _, hasValue := strings.Cut(strings.TrimLeft(word, "-"), "=")
+			if f := fs.Lookup(name); f != nil && !isBool(f) && !hasValue {
+				pending = f
+			}
+		case len(positional) == 0 && cmd.Find(word) != nil:
+			cmd = cmd.Find(word)
+		default:
+			positional = append(positional, word)
+		}
+	}
+
+	var candidates []string
+	switch {
+	case pending != nil:
+		if values := cmd.flagValues(pending.Name); values != nil {
+			candidates = values()
+		}
+	case strings.HasPrefix(cur, "-") && !ended:
+		cmd.flags().VisitAll(func(f *flag.Flag) {
+			candidates = append(candidates, "--"+f.Name)
+		})
+	default:
+		if len(positional) == 0 && !ended {
+			for _, sub := range cmd.Subcommands {
+				if !sub.Hidden {
+					candidates = append(candidates, sub.Name)
+				}
+			}
+		}
+		if cmd.Complete != nil && (cmd.MaxArgs < 0 || len(positional) < cmd.MaxArgs) {
+			candidates = append(candidates, cmd.Complete(positional)...)
+		}
+	}
+
+	var out []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, cur) {
+			out = append(out, candidate)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// flagValues finds the value completer for a flag on cmd or, for
+// persistent flags, an ancestor.
+func (c *Command) flagValues(name string) func() []string {
+	for cmd := c; cmd != nil; cmd = cmd.parent {
+		if values, ok := cmd.FlagValues[name]; ok {
+			return values
+		}
+	}
+	return nil
+}
+
+// WriteCompletion writes the completion script for shell: bash, zsh or
+// fish. The scripts ask the program itself for candidates.
+func (c *Command) WriteCompletion(w io.Writer, shell string) error {
+	prog := c.Name
+	fn := "_" + strings.ReplaceAll(prog, "-", "_")
+	switch shell {
+	case "bash":
+		fmt.Fprintf(w, `# bash completion for %[1]s
+%[2]s() {
+    local IFS=$'\n'
+    COMPREPLY=($(%[1]s %[3]s "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+}
+complete -o default -F %[2]s %[1]s
+`, prog, fn, CompleteCommand)
+	case "zsh":
+		fmt.Fprintf(w, `#compdef %[1]s
+# zsh completion for %[1]s
+%[2]s() {
+    local -a candidates
+    candidates=("${(@f)$(%[1]s %[3]s "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    compadd -a candidates
+}
+if [ "$funcstack[1]" = "%[2]s" ]; then
+    %[2]s "$@"
+else
+    compdef %[2]s %[1]s
+fi
+`, prog, fn, CompleteCommand)
+	case "fish":
+		fmt.Fprintf(w, `# fish completion for %[1]s
+function __%[2]s_complete
+    set -l words (commandline -opc) (commandline -ct)
+    %[1]s %[3]s $words[2..-1] 2>/dev/null
+end
+complete -c %[1]s -f -a '(__%[2]s_complete)'
+`, prog, strings.TrimPrefix(fn, "_"), CompleteCommand)
+	default:
+		return fmt.Errorf("unsupported shell %q (bash, zsh or fish)", shell)
+	}
+	return nil
+}
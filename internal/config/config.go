@@ -2,11 +2,16 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"path/filepath"
 )
 
 type Config struct {
+	// Version is the schema version of the config file. Older files are
+	// migrated in memory when loaded, and rewritten by Migrate.
+	Version int `json:"version"`
+
 	Port          int    `json:"port"`
 	ServerHost    string `json:"server_host"`
 	ReposDir      string `json:"repos_dir"`
@@ -15,6 +20,79 @@ type Config struct {
 	PIDFile       string `json:"pid_file"`
 	DefaultBranch string `json:"default_branch"`
 	BackupDir     string `json:"backup_dir"`
+
+	// HostKeyTypes are the kinds of host key the server presents:
+	// ed25519, ecdsa and rsa. The ed25519 key is HostKey; the others sit
+	// beside it, named after their type (see HostKeyFile).
+	HostKeyTypes []string `json:"host_key_types"`
+	// HostKeyGrace is how many days a rotated host key is announced to
+	// clients alongside the current one before it replaces it.
+	HostKeyGrace int `json:"host_key_grace"`
+
+	// Listen lists the addresses the server binds to, e.g.
+	// "192.168.1.10:2222", "[::1]:2222" or "unix:/run/homegit.sock".
+	// When empty the server listens on Port on every interface.
+	Listen []string `json:"listen,omitempty"`
+
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string `json:"log_level"`
+	// LogFormat is "text" (key=value pairs) or "json".
+	LogFormat string `json:"log_format"`
+
+	// Rotation of server.log when running as a daemon, and of the audit
+	// log. LogMaxSize is in megabytes and LogMaxAge in days; 0 disables
+	// that trigger.
+	// LogMaxBackups rotated files are kept, gzipped if LogCompress is set.
+	LogMaxSize    int  `json:"log_max_size"`
+	LogMaxAge     int  `json:"log_max_age"`
+	LogMaxBackups int  `json:"log_max_backups"`
+	LogCompress   bool `json:"log_compress"`
+
+	// HTTPListen is the address of the optional HTTP endpoint serving
+	// Prometheus metrics at /metrics and health checks at /healthz and
+	// /readyz, e.g. "127.0.0.1:9090". Empty disables it.
+	HTTPListen string `json:"http_listen"`
+
+	// AuditLog is the append-only record of every git operation. Empty
+	// disables auditing.
+	AuditLog string `json:"audit_log"`
+
+	// ControlSocket is the Unix socket the running server answers
+	// status and session management requests on.
+	ControlSocket string `json:"control_socket"`
+
+	// ShutdownTimeout is how many seconds the server waits for in-flight
+	// operations to finish before cancelling them on shutdown.
+	ShutdownTimeout int `json:"shutdown_timeout"`
+
+	// MDNS advertises the server on the local network, so 'homegit setup'
+	// on other computers can find it.
+	MDNS bool `json:"mdns"`
+
+	// Replicas are the standby servers, as host:port, that this server
+	// pushes every change to. ReplicaOf is the primary's host:port when
+	// this server is a standby; it then refuses pushes except from the
+	// primary. Both ends need the same ReplicationSecret.
+	Replicas          []string `json:"replicas,omitempty"`
+	ReplicaOf         string   `json:"replica_of,omitempty"`
+	ReplicationSecret string   `json:"replication_secret,omitempty"`
+	// ReplicationInterval is how many seconds apart a primary checks its
+	// replicas for changes pushes don't cover, such as removed and
+	// renamed repositories.
+	ReplicationInterval int `json:"replication_interval"`
+
+	// Profile names the server client commands such as init, clone and
+	// list talk to, from Profiles. Empty or "default" means ServerHost
+	// and Port.
+	Profile  string             `json:"profile,omitempty"`
+	Profiles map[string]Profile `json:"profiles,omitempty"`
+
+	// sources records where each setting came from; warnings are the
+	// non-fatal problems found while loading. fileVersion is the version
+	// the file was written as, before migration.
+	sources     map[string]string
+	warnings    []Problem
+	fileVersion int
 }
 
 func getHomeDir() string {
@@ -32,10 +110,41 @@ func GetHomeDir() string {
 	return getHomeDir()
 }
 
+// Environment variables that relocate homegit, so several independent
+// instances can run on one machine.
+const (
+	// EnvHome replaces ~/.homegit as the directory holding the config
+	// and the default locations of repos, keys, logs and sockets.
+	EnvHome = "HOMEGIT_HOME"
+	// EnvConfig names the config file directly. 'homegit --config'
+	// sets it so that the server processes it starts inherit it.
+	EnvConfig = "HOMEGIT_CONFIG"
+)
+
+// BaseDir returns the directory holding homegit's files: $HOMEGIT_HOME,
+// else the directory of $HOMEGIT_CONFIG, else ~/.homegit.
+func BaseDir() string {
+	if dir := os.Getenv(EnvHome); dir != "" {
+		return dir
+	}
+	if path := os.Getenv(EnvConfig); path != "" {
+		return filepath.Dir(path)
+	}
+	return filepath.Join(getHomeDir(), ".homegit")
+}
+
+// Path returns the location of the config file.
+func Path() string {
+	if path := os.Getenv(EnvConfig); path != "" {
+		return path
+	}
+	return filepath.Join(BaseDir(), "config")
+}
+
 func Default() *Config {
-	home := getHomeDir()
-	baseDir := filepath.Join(home, ".homegit")
+	baseDir := BaseDir()
 	return &Config{
+		Version:       CurrentVersion,
 		Port:          2222,
 		ServerHost:    "localhost",
 		ReposDir:      filepath.Join(baseDir, "repos"),
@@ -44,45 +153,156 @@ func Default() *Config {
 		PIDFile:       filepath.Join(baseDir, "homegit.pid"),
 		DefaultBranch: "main",
 		BackupDir:     filepath.Join(baseDir, "backups"),
+		HostKeyTypes:  []string{"ed25519"},
+		HostKeyGrace:  7,
+
+		ShutdownTimeout:     30,
+		MDNS:                true,
+		ReplicationInterval: 60,
+		ControlSocket:       filepath.Join(baseDir, "control.sock"),
+		AuditLog:            filepath.Join(baseDir, "audit.log"),
+		LogLevel:            "info",
+		LogFormat:           "text",
+		LogMaxSize:          10,
+		LogMaxAge:           0,
+		LogMaxBackups:       5,
+		LogCompress:         true,
 	}
 }
 
+// Load reads the config file, creating it with defaults if it doesn't
+// exist and migrating it in memory if it was written by an older version;
+// the file itself is only rewritten by Migrate. A config that fails
+// validation is returned along with a *ValidationError so callers can
+// still inspect it.
 func Load() (*Config, error) {
-	home := getHomeDir()
-	configPath := filepath.Join(home, ".homegit", "config")
+	configPath := Path()
 
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
-		cfg := Default()
-		if err := cfg.Save(); err != nil {
+		if err := Default().Save(); err != nil {
 			return nil, err
 		}
-		return cfg, nil
 	}
 
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		return nil, err
 	}
+	return parse(configPath, data)
+}
+
+func parse(path string, data []byte) (*Config, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	from, err := migrate(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	cfg, err := decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	cfg.fileVersion = from
 
+	problems := append(cfg.applyEnv(), cfg.Validate()...)
+	if len(problems) > 0 {
+		return cfg, &ValidationError{Path: path, Problems: append(cfg.warnings, problems...)}
+	}
+	return cfg, nil
+}
+
+// decode builds a config from the settings in a current-version file
+// decoded as a generic map. Unknown keys become warnings.
+func decode(raw map[string]any) (*Config, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
 	cfg := Default()
 	if err := json.Unmarshal(data, cfg); err != nil {
 		return nil, err
 	}
+
+	cfg.sources = make(map[string]string)
+	for _, key := range keys() {
+		if _, ok := raw[key]; ok {
+			cfg.sources[key] = SourceFile
+		}
+	}
+	cfg.warnings = unknownKeys(raw)
 	return cfg, nil
 }
 
+// FileVersion returns the schema version the config file is written in,
+// which is older than CurrentVersion until the file is migrated.
+func (c *Config) FileVersion() int {
+	return c.fileVersion
+}
+
+// Warnings returns the non-fatal problems found when the config was
+// loaded, such as unknown settings.
+func (c *Config) Warnings() []Problem {
+	return c.warnings
+}
+
+// ListenAddrs returns the addresses the server should bind to.
+func (c *Config) ListenAddrs() []string {
+	if len(c.Listen) > 0 {
+		return c.Listen
+	}
+	return []string{fmt.Sprintf(":%d", c.Port)}
+}
+
+// HostKeyFile is where the server keeps its host key of type typ.
+func (c *Config) HostKeyFile(typ string) string {
+	if typ == "ed25519" {
+		return c.HostKey
+	}
+	return c.HostKey + "_" + typ
+}
+
+// HostKeyFiles lists the host key of every configured type.
+func (c *Config) HostKeyFiles() []string {
+	files := make([]string, len(c.HostKeyTypes))
+	for i, typ := range c.HostKeyTypes {
+		files[i] = c.HostKeyFile(typ)
+	}
+	return files
+}
+
+// LogFile is the daemon's server log.
+func (c *Config) LogFile() string {
+	return filepath.Join(filepath.Dir(c.PIDFile), "server.log")
+}
+
+// ListenFile is where a running server records the addresses it is bound to.
+func (c *Config) ListenFile() string {
+	return filepath.Join(filepath.Dir(c.PIDFile), "listen")
+}
+
 func (c *Config) Save() error {
-	home := getHomeDir()
-	baseDir := filepath.Join(home, ".homegit")
-	if err := os.MkdirAll(baseDir, 0755); err != nil {
+	configPath := Path()
+	if err := os.MkdirAll(filepath.Dir(configPath), 0755); err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(baseDir, "config")
 	data, err := json.MarshalIndent(c, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	return writeFile(configPath, data)
+}
+
+// writeFile writes a config file, or a backup of one, readable only by
+// its owner since it may hold the replication secret.
+func writeFile(path string, data []byte) error {
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of a file that already exists
+	return os.Chmod(path, 0600)
 }
@@ -1,8 +1,10 @@
 package config
 
 import (
+	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -62,3 +64,360 @@ func TestLoadAndSave(t *testing.T) {
 		t.Errorf("Expected port 3333 after reload, got %d", cfg2.Port)
 	}
 }
+
+func TestListenAddrs(t *testing.T) {
+	cfg := Default()
+
+	addrs := cfg.ListenAddrs()
+	if len(addrs) != 1 || addrs[0] != ":2222" {
+		t.Errorf("Expected [:2222] without listen set, got %v", addrs)
+	}
+
+	cfg.Listen = []string{"192.168.1.10:2222", "unix:/run/homegit.sock"}
+	addrs = cfg.ListenAddrs()
+	if len(addrs) != 2 || addrs[1] != "unix:/run/homegit.sock" {
+		t.Errorf("Expected configured listen addresses, got %v", addrs)
+	}
+}
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	path := filepath.Join(home, ".homegit", "config")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadMigratesUnversionedConfig(t *testing.T) {
+	path := writeConfig(t, `{"port": 2300}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if cfg.Version != CurrentVersion || cfg.FileVersion() != 0 || cfg.Port != 2300 {
+		t.Errorf("Expected migrated config with port 2300, got version %d (file %d) port %d", cfg.Version, cfg.FileVersion(), cfg.Port)
+	}
+	if _, err := os.Stat(path + ".v0.bak"); !os.IsNotExist(err) {
+		t.Errorf("Expected Load to leave the file alone, got backup error %v", err)
+	}
+
+	from, backup, err := Migrate()
+	if err != nil || from != 0 || backup != path+".v0.bak" {
+		t.Fatalf("Migrate() = %d, %q, %v", from, backup, err)
+	}
+	if _, err := os.Stat(backup); err != nil {
+		t.Errorf("Expected the original file to be kept: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"version": 1`) {
+		t.Errorf("Expected the version to be written back, got %s", data)
+	}
+	if _, backup, err := Migrate(); err != nil || backup != "" {
+		t.Errorf("Expected a current config to be left alone, got %q, %v", backup, err)
+	}
+}
+
+func TestCheckDirs(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := Default()
+	cfg.ReposDir = filepath.Join(dir, "repos", "not", "yet")
+	cfg.BackupDir = filepath.Join(file, "backups")
+
+	// Client commands load the config without looking at the server's dirs
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	problems := cfg.CheckDirs()
+	if len(problems) != 1 || problems[0].Key != "backup_dir" {
+		t.Errorf("Expected a backup_dir problem only, got %v", problems)
+	}
+}
+
+func TestLoadRejectsNewerVersion(t *testing.T) {
+	writeConfig(t, `{"version": 99}`)
+	if _, err := Load(); err == nil {
+		t.Errorf("Expected an error for a config from a newer version")
+	}
+}
+
+func TestLoadWarnsOnUnknownKeys(t *testing.T) {
+	writeConfig(t, `{"version": 1, "prot": 2300}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Expected unknown keys not to be fatal, got %v", err)
+	}
+	warnings := cfg.Warnings()
+	if len(warnings) != 1 || warnings[0].Key != "prot" || !strings.Contains(warnings[0].Message, `"port"`) {
+		t.Errorf("Expected a warning suggesting port, got %v", warnings)
+	}
+}
+
+func TestLoadValidates(t *testing.T) {
+	writeConfig(t, `{"version": 1, "port": 70000, "log_format": "xml"}`)
+
+	cfg, err := Load()
+	var invalid *ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected a validation error, got %v", err)
+	}
+	if cfg == nil {
+		t.Fatalf("Expected the config to be returned with the error")
+	}
+	var keys []string
+	for _, p := range invalid.Problems {
+		keys = append(keys, p.Key)
+	}
+	if len(keys) != 2 || keys[0] != "log_format" || keys[1] != "port" {
+		t.Errorf("Expected log_format and port problems, got %v", invalid.Problems)
+	}
+}
+
+func TestValidateReplication(t *testing.T) {
+	cfg := Default()
+	cfg.ReposDir = t.TempDir()
+	cfg.Replicas = []string{"standby.lan:2222", "standby2.lan"}
+	cfg.ReplicationInterval = 0
+
+	var keys []string
+	for _, p := range cfg.Validate() {
+		keys = append(keys, p.Key)
+	}
+	want := "replicas replication_interval replication_secret"
+	if got := strings.Join(keys, " "); got != want {
+		t.Errorf("Expected problems with %s, got %v", want, cfg.Validate())
+	}
+
+	cfg.Replicas = nil
+	cfg.ReplicaOf = "nas.lan:2222"
+	cfg.ReplicationSecret = "s3cret"
+	cfg.ReplicationInterval = 60
+	for _, p := range cfg.Validate() {
+		if strings.HasPrefix(p.Key, "replica") {
+			t.Errorf("Unexpected problem %v", p)
+		}
+	}
+}
+
+func TestValidateHostKeys(t *testing.T) {
+	cfg := Default()
+	cfg.ReposDir = t.TempDir()
+	cfg.HostKeyTypes = []string{"ed25519", "dsa", "ed25519"}
+	cfg.HostKeyGrace = -1
+
+	var msgs []string
+	for _, p := range cfg.Validate() {
+		msgs = append(msgs, p.String())
+	}
+	want := []string{
+		`host_key_grace: must not be negative`,
+		`host_key_types: "dsa" is not ed25519, ecdsa or rsa`,
+		`host_key_types: "ed25519" is listed twice`,
+	}
+	if got := strings.Join(msgs, "\n"); got != strings.Join(want, "\n") {
+		t.Errorf("Expected problems:\n%s\ngot:\n%s", strings.Join(want, "\n"), got)
+	}
+
+	cfg.HostKeyTypes = []string{"rsa", "ed25519"}
+	cfg.HostKeyGrace = 0
+	if problems := cfg.Validate(); len(problems) != 0 {
+		t.Errorf("Unexpected problems %v", problems)
+	}
+	if got := cfg.HostKeyFile("rsa"); got != cfg.HostKey+"_rsa" {
+		t.Errorf("Expected the rsa key beside host_key, got %s", got)
+	}
+	if got := cfg.HostKeyFile("ed25519"); got != cfg.HostKey {
+		t.Errorf("Expected the ed25519 key at host_key, got %s", got)
+	}
+}
+
+func TestSettingsSources(t *testing.T) {
+	writeConfig(t, `{"version": 1, "port": 2300}`)
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	sources := make(map[string]Setting)
+	for _, s := range cfg.Settings() {
+		sources[s.Key] = s
+	}
+	if s := sources["port"]; s.Value != "2300" || s.Source != SourceFile {
+		t.Errorf("Expected port 2300 from the file, got %+v", s)
+	}
+	if s := sources["log_level"]; s.Value != "info" || s.Source != SourceDefault {
+		t.Errorf("Expected default log_level, got %+v", s)
+	}
+}
+
+func TestReplicationSecretKeptPrivate(t *testing.T) {
+	path := writeConfig(t, `{"version": 1}`)
+
+	if err := SetInFile("replication_secret", "s3cret"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the config to be made private, got %v, %v", info.Mode(), err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	for _, s := range cfg.Settings() {
+		if s.Key == "replication_secret" && s.Value != Redacted {
+			t.Errorf("Expected the secret to be redacted, got %+v", s)
+		}
+	}
+	if value, _ := cfg.Get("replication_secret"); value != "s3cret" {
+		t.Errorf("Expected Get to return the secret, got %q", value)
+	}
+
+	data, _ := os.ReadFile(path)
+	redacted, err := RedactFile(data)
+	if err != nil || strings.Contains(string(redacted), "s3cret") || !strings.Contains(string(redacted), Redacted) {
+		t.Errorf("Expected the secret redacted from the file, got %s, %v", redacted, err)
+	}
+}
+
+func TestEnvOverrides(t *testing.T) {
+	writeConfig(t, `{"version": 1, "port": 2300}`)
+	t.Setenv("HOMEGIT_PORT", "2400")
+	t.Setenv("HOMEGIT_LOG_COMPRESS", "false")
+	t.Setenv("HOMEGIT_LISTEN", "127.0.0.1:2400, [::1]:2400")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != 2400 || cfg.LogCompress || len(cfg.Listen) != 2 || cfg.Listen[1] != "[::1]:2400" {
+		t.Errorf("Overrides not applied: port %d, log_compress %v, listen %v", cfg.Port, cfg.LogCompress, cfg.Listen)
+	}
+	if got := cfg.Source("port"); got != "env HOMEGIT_PORT" {
+		t.Errorf("Expected port from env HOMEGIT_PORT, got %q", got)
+	}
+
+	t.Setenv("HOMEGIT_PORT", "abc")
+	if _, err := Load(); err == nil || !strings.Contains(err.Error(), "HOMEGIT_PORT") {
+		t.Errorf("Expected an error naming HOMEGIT_PORT, got %v", err)
+	}
+}
+
+func TestHomegitHome(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	dir := t.TempDir()
+	t.Setenv(EnvHome, dir)
+
+	if got := Path(); got != filepath.Join(dir, "config") {
+		t.Errorf("Expected config in %s, got %s", dir, got)
+	}
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ReposDir != filepath.Join(dir, "repos") {
+		t.Errorf("Expected repos under %s, got %s", dir, cfg.ReposDir)
+	}
+
+	other := filepath.Join(t.TempDir(), "other.json")
+	t.Setenv(EnvHome, "")
+	t.Setenv(EnvConfig, other)
+	if Path() != other || BaseDir() != filepath.Dir(other) {
+		t.Errorf("Expected %s to locate the instance, got config %s in %s", EnvConfig, Path(), BaseDir())
+	}
+}
+
+func TestSetInFile(t *testing.T) {
+	path := writeConfig(t, `{"version": 1, "port": 2300, "custom": "kept"}`)
+
+	if err := SetInFile("port", "2500"); err != nil {
+		t.Fatalf("SetInFile failed: %v", err)
+	}
+	if err := SetInFile("daemon", "yes"); err == nil {
+		t.Errorf("Expected a type error for daemon=yes")
+	}
+	if err := SetInFile("port", "99999"); err == nil {
+		t.Errorf("Expected port 99999 to be refused")
+	}
+	if err := SetInFile("prot", "1"); err == nil || !strings.Contains(err.Error(), `"port"`) {
+		t.Errorf("Expected an unknown setting error suggesting port, got %v", err)
+	}
+	if err := UnsetInFile("log_level"); err != nil {
+		t.Fatalf("UnsetInFile failed: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != 2500 {
+		t.Errorf("Expected port 2500, got %d", cfg.Port)
+	}
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"custom": "kept"`) {
+		t.Errorf("Expected unknown keys to be preserved:\n%s", data)
+	}
+
+	if err := UnsetInFile("port"); err != nil {
+		t.Fatalf("UnsetInFile failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.Port != 2222 || cfg.Source("port") != SourceDefault {
+		t.Errorf("Expected port back to its default, got %d from %s", cfg.Port, cfg.Source("port"))
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	writeConfig(t, `{"version": 1, "server_host": "nas.lan"}`)
+
+	if err := AddProfile("office", Profile{Host: "office.lan", Port: 2300}); err != nil {
+		t.Fatalf("AddProfile failed: %v", err)
+	}
+	if err := AddProfile("default", Profile{Host: "x", Port: 22}); err == nil {
+		t.Errorf("Expected the default profile name to be reserved")
+	}
+	if err := AddProfile("bad", Profile{Host: "x", Port: 0}); err == nil {
+		t.Errorf("Expected port 0 to be refused")
+	}
+	if err := UseProfile("ofice"); err == nil {
+		t.Errorf("Expected an unknown profile to be refused")
+	}
+	if err := UseProfile("office"); err != nil {
+		t.Fatalf("UseProfile failed: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.ServerHost != "nas.lan" {
+		t.Errorf("Expected server_host to stay nas.lan, got %s", cfg.ServerHost)
+	}
+	active, err := cfg.ForProfile("")
+	if err != nil || active.ServerHost != "office.lan" || active.Port != 2300 {
+		t.Errorf("Expected the active profile to be office.lan:2300, got %+v, %v", active, err)
+	}
+	if listen := active.ListenAddrs(); len(listen) != 1 || listen[0] != ":2222" {
+		t.Errorf("Expected the profile to keep the server's listen address, got %v", listen)
+	}
+	if def, _ := cfg.ForProfile(DefaultProfile); def.ServerHost != "nas.lan" || def.Port != 2222 {
+		t.Errorf("Expected the default profile to be nas.lan:2222, got %s:%d", def.ServerHost, def.Port)
+	}
+
+	if err := RemoveProfile("office"); err != nil {
+		t.Fatalf("RemoveProfile failed: %v", err)
+	}
+	if cfg, _ := Load(); cfg.ActiveProfile() != DefaultProfile || len(cfg.Profiles) != 0 {
+		t.Errorf("Expected removing the active profile to reset it, got %q %v", cfg.ActiveProfile(), cfg.Profiles)
+	}
+}
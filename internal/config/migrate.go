@@ -0,0 +1,82 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// CurrentVersion is the config schema version this build reads and writes.
+const CurrentVersion = 1
+
+// migrations[i] upgrades a version i config, decoded as a generic map, to
+// version i+1.
+var migrations = []func(raw map[string]any) error{
+	// 0 -> 1: files written before the version field existed. The
+	// settings themselves are unchanged.
+	func(raw map[string]any) error { return nil },
+}
+
+// migrate upgrades raw to CurrentVersion in place and returns the version
+// it started at.
+func migrate(raw map[string]any) (int, error) {
+	from := 0
+	if v, ok := raw["version"]; ok {
+		f, ok := v.(float64)
+		if !ok || f != float64(int(f)) || f < 0 {
+			return 0, fmt.Errorf("version: %v is not a schema version", v)
+		}
+		from = int(f)
+	}
+	if from > CurrentVersion {
+		return from, fmt.Errorf("config version %d is newer than this homegit supports (%d), upgrade homegit", from, CurrentVersion)
+	}
+
+	for v := from; v < CurrentVersion; v++ {
+		if err := migrations[v](raw); err != nil {
+			return from, fmt.Errorf("failed to migrate config from version %d: %w", v, err)
+		}
+	}
+	raw["version"] = CurrentVersion
+	return from, nil
+}
+
+// Migrate rewrites the config file in the current version if it was
+// written by an older one, keeping the original next to it. It returns
+// the version the file was in and the backup's path, empty if the file
+// was already current.
+func Migrate() (from int, backup string, err error) {
+	path := Path()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, "", err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return 0, "", fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if from, err = migrate(raw); err != nil {
+		return from, "", fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if from == CurrentVersion {
+		return from, "", nil
+	}
+	if backup, err = writeMigrated(path, data, raw, from); err != nil {
+		return from, "", fmt.Errorf("failed to migrate config %s: %w", path, err)
+	}
+	return from, backup, nil
+}
+
+// writeMigrated saves the original file next to path and replaces it with
+// the migrated settings. It returns the backup's path.
+func writeMigrated(path string, original []byte, raw map[string]any, from int) (string, error) {
+	backup := fmt.Sprintf("%s.v%d.bak", path, from)
+	if err := writeFile(backup, original); err != nil {
+		return "", err
+	}
+	data, err := marshalRaw(raw)
+	if err != nil {
+		return "", err
+	}
+	return backup, writeFile(path, data)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DefaultProfile is the server given by the server_host and port settings.
+const DefaultProfile = "default"
+
+// Profile is a homegit server this machine uses as a client.
+type Profile struct {
+	Host string `json:"host"`
+	Port int    `json:"port"`
+}
+
+func (p Profile) String() string {
+	return fmt.Sprintf("%s:%d", p.Host, p.Port)
+}
+
+// ProfileNames returns the names of the configured profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ActiveProfile returns the name of the profile client commands use by
+// default.
+func (c *Config) ActiveProfile() string {
+	if c.Profile == "" {
+		return DefaultProfile
+	}
+	return c.Profile
+}
+
+// ForProfile returns a copy of c whose ServerHost and Port point at the
+// named profile. An empty name selects the active profile. The copy's
+// ListenAddrs stay those of this machine's server.
+func (c *Config) ForProfile(name string) (*Config, error) {
+	if name == "" {
+		name = c.ActiveProfile()
+	}
+	out := *c
+	if name == DefaultProfile {
+		return &out, nil
+	}
+	p, ok := c.Profiles[name]
+	if !ok {
+		return nil, unknownProfile(name, c.ProfileNames())
+	}
+	out.Listen = c.ListenAddrs()
+	out.ServerHost = p.Host
+	out.Port = p.Port
+	return &out, nil
+}
+
+// ErrUnknownProfile is returned for a profile name that isn't configured.
+var ErrUnknownProfile = errors.New("no profile named")
+
+func unknownProfile(name string, known []string) error {
+	if suggestion := closest(name, known); suggestion != "" {
+		return fmt.Errorf("%w %q (did you mean %q?)", ErrUnknownProfile, name, suggestion)
+	}
+	return fmt.Errorf("%w %q, add it with 'homegit profile add'", ErrUnknownProfile, name)
+}
+
+func checkProfileName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("profile names must not be empty")
+	case name == DefaultProfile:
+		return fmt.Errorf("%q is reserved for server_host and port", name)
+	case strings.ContainsAny(name, " \t/:"):
+		return fmt.Errorf("%q: profile names must not contain spaces, '/' or ':'", name)
+	}
+	return nil
+}
+
+// AddProfile adds or replaces a profile in the config file.
+func AddProfile(name string, p Profile) error {
+	if err := checkProfileName(name); err != nil {
+		return err
+	}
+	return editFile("profiles", func(raw map[string]any) {
+		profiles, _ := raw["profiles"].(map[string]any)
+		if profiles == nil {
+			profiles = make(map[string]any)
+		}
+		profiles[name] = p
+		raw["profiles"] = profiles
+	})
+}
+
+// RemoveProfile deletes a profile from the config file. If it was the
+// active profile, the default becomes active again.
+func RemoveProfile(name string) error {
+	var found bool
+	err := editFile("profiles", func(raw map[string]any) {
+		profiles, _ := raw["profiles"].(map[string]any)
+		if _, found = profiles[name]; !found {
+			return
+		}
+		delete(profiles, name)
+		if len(profiles) == 0 {
+			delete(raw, "profiles")
+		}
+		if raw["profile"] == name {
+			delete(raw, "profile")
+		}
+	})
+	if err == nil && !found {
+		return fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	return err
+}
+
+// UseProfile makes name the active profile in the config file.
+func UseProfile(name string) error {
+	if name == DefaultProfile {
+		return UnsetInFile("profile")
+	}
+	return SetInFile("profile", name)
+}
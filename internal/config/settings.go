@@ -0,0 +1,331 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Where a setting's value came from. Environment overrides are reported
+// as SourceEnvPrefix followed by the variable's name.
+const (
+	SourceDefault   = "default"
+	SourceFile      = "file"
+	SourceEnvPrefix = "env "
+)
+
+// Redacted stands in for a secret setting's value in Settings and
+// RedactFile. Get still returns the value when asked for it by name.
+const Redacted = "(redacted)"
+
+// secretKeys are the settings that must not be shown unless asked for.
+var secretKeys = []string{"replication_secret"}
+
+// Setting is one resolved config value and where it came from.
+type Setting struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+// keys returns the config file keys in declaration order.
+func keys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := jsonKey(t.Field(i)); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func jsonKey(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	key, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if key == "-" {
+		return ""
+	}
+	return key
+}
+
+// Source returns where the value of key came from.
+func (c *Config) Source(key string) string {
+	if source, ok := c.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// Settings returns every setting with its resolved value and source.
+// Secrets that are set show as Redacted.
+func (c *Config) Settings() []Setting {
+	var settings []Setting
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := jsonKey(v.Type().Field(i))
+		if key == "" {
+			continue
+		}
+		value := formatValue(v.Field(i))
+		if value != "" && slices.Contains(secretKeys, key) {
+			value = Redacted
+		}
+		settings = append(settings, Setting{Key: key, Value: value, Source: c.Source(key)})
+	}
+	return settings
+}
+
+// RedactFile returns the config file data with secrets replaced by
+// Redacted. Data without secrets is returned as it is.
+func RedactFile(data []byte) ([]byte, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	redacted := false
+	for _, key := range secretKeys {
+		if value, ok := raw[key]; ok && value != "" {
+			raw[key] = Redacted
+			redacted = true
+		}
+	}
+	if !redacted {
+		return data, nil
+	}
+	return marshalRaw(raw)
+}
+
+func formatValue(v reflect.Value) string {
+	if v.Kind() == reflect.Slice {
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	}
+	if v.Kind() == reflect.Map {
+		var items []string
+		for _, key := range v.MapKeys() {
+			items = append(items, fmt.Sprintf("%s=%v", key.Interface(), v.MapIndex(key).Interface()))
+		}
+		sort.Strings(items)
+		return strings.Join(items, ",")
+	}
+	return fmt.Sprint(v.Interface())
+}
+
+// envPrefix plus a setting's upper-cased key overrides it, e.g.
+// HOMEGIT_PORT or HOMEGIT_REPOS_DIR.
+const envPrefix = "HOMEGIT_"
+
+// EnvVar returns the environment variable that overrides key.
+func EnvVar(key string) string {
+	return envPrefix + strings.ToUpper(key)
+}
+
+func field(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if jsonKey(t.Field(i)) == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// ParseValue converts value to the type of setting key: a whole number,
+// true or false, a comma-separated list, or a string.
+func ParseValue(key, value string) (any, error) {
+	f, ok := field(key)
+	if !ok {
+		return nil, unknownSetting(key)
+	}
+	if key == "version" {
+		return nil, fmt.Errorf("version is managed by homegit")
+	}
+
+	switch f.Type.Kind() {
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes a whole number, got %q", key, value)
+		}
+		return n, nil
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s takes true or false, got %q", key, value)
+		}
+		return b, nil
+	case reflect.Map:
+		return nil, fmt.Errorf("%s is edited with 'homegit profile'", key)
+	case reflect.Slice:
+		items := []string{}
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	}
+	return value, nil
+}
+
+// ErrUnknownSetting is returned for a key that isn't a setting.
+var ErrUnknownSetting = errors.New("unknown setting")
+
+func unknownSetting(key string) error {
+	if suggestion := closest(key, keys()); suggestion != "" {
+		return fmt.Errorf("%w %q (did you mean %q?)", ErrUnknownSetting, key, suggestion)
+	}
+	return fmt.Errorf("%w %q", ErrUnknownSetting, key)
+}
+
+// applyEnv overrides settings from HOMEGIT_* environment variables and
+// returns a problem for each value of the wrong type.
+func (c *Config) applyEnv() []Problem {
+	var problems []Problem
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := jsonKey(v.Type().Field(i))
+		if key == "" || key == "version" {
+			continue
+		}
+		env := EnvVar(key)
+		value, ok := os.LookupEnv(env)
+		if !ok {
+			continue
+		}
+		parsed, err := ParseValue(key, value)
+		if err != nil {
+			problems = append(problems, Problem{Key: env, Message: err.Error()})
+			continue
+		}
+		v.Field(i).Set(reflect.ValueOf(parsed))
+		if c.sources == nil {
+			c.sources = make(map[string]string)
+		}
+		c.sources[key] = SourceEnvPrefix + env
+	}
+	return problems
+}
+
+// Get returns the resolved value of key, secrets included, since it was
+// asked for by name.
+func (c *Config) Get(key string) (string, error) {
+	v := reflect.ValueOf(c).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if jsonKey(v.Type().Field(i)) == key {
+			return formatValue(v.Field(i)), nil
+		}
+	}
+	return "", unknownSetting(key)
+}
+
+// SetInFile stores value for key in the config file after checking its
+// type. Environment overrides are not written. A value that would make
+// the setting invalid is refused.
+func SetInFile(key, value string) error {
+	parsed, err := ParseValue(key, value)
+	if err != nil {
+		return err
+	}
+	return editFile(key, func(raw map[string]any) { raw[key] = parsed })
+}
+
+// UnsetInFile removes key from the config file so its default applies.
+func UnsetInFile(key string) error {
+	if _, ok := field(key); !ok {
+		return unknownSetting(key)
+	}
+	if key == "version" {
+		return fmt.Errorf("version is managed by homegit")
+	}
+	return editFile(key, func(raw map[string]any) { delete(raw, key) })
+}
+
+func editFile(key string, edit func(raw map[string]any)) error {
+	path := Path()
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := Default().Save(); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	if _, err := migrate(raw); err != nil {
+		return fmt.Errorf("invalid config %s: %w", path, err)
+	}
+
+	edit(raw)
+
+	// Only refuse the edit over problems with the setting being changed,
+	// so one bad setting doesn't block fixing another
+	cfg, err := decode(raw)
+	if err != nil {
+		return err
+	}
+	for _, p := range append(cfg.Validate(), cfg.CheckDirs()...) {
+		if p.Key == key {
+			return &ValidationError{Path: path, Problems: []Problem{p}}
+		}
+	}
+
+	out, err := marshalRaw(raw)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, out)
+}
+
+// marshalRaw renders a config map as indented JSON with known settings in
+// declaration order, followed by any unknown keys.
+func marshalRaw(raw map[string]any) ([]byte, error) {
+	var ordered []string
+	for _, key := range keys() {
+		if _, ok := raw[key]; ok {
+			ordered = append(ordered, key)
+		}
+	}
+	var unknown []string
+	for key := range raw {
+		if !slices.Contains(ordered, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	ordered = append(ordered, unknown...)
+
+	var b bytes.Buffer
+	b.WriteString("{\n")
+	for i, key := range ordered {
+		k, _ := json.Marshal(key)
+		v, err := json.MarshalIndent(raw[key], "  ", "  ")
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "  %s: %s", k, v)
+		if i < len(ordered)-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+	return b.Bytes(), nil
+}
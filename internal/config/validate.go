@@ -0,0 +1,262 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// Problem is something wrong with a config setting. Warnings don't stop
+// the config from loading; errors do.
+type Problem struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+	Warning bool   `json:"warning"`
+}
+
+func (p Problem) String() string {
+	if p.Key == "" {
+		return p.Message
+	}
+	return p.Key + ": " + p.Message
+}
+
+// ValidationError is returned by Load when the config has errors.
+type ValidationError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, p := range e.Problems {
+		if !p.Warning {
+			msgs = append(msgs, p.String())
+		}
+	}
+	return fmt.Sprintf("invalid config %s: %s", e.Path, strings.Join(msgs, "; "))
+}
+
+// Validate checks the settings in c. The result includes warnings.
+func (c *Config) Validate() []Problem {
+	var problems []Problem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		add("port", "%d is not a valid port (1-65535)", c.Port)
+	}
+	if c.ServerHost == "" {
+		add("server_host", "must not be empty")
+	}
+	if c.DefaultBranch == "" {
+		add("default_branch", "must not be empty")
+	}
+
+	if len(c.HostKeyTypes) == 0 {
+		add("host_key_types", "must list at least one of ed25519, ecdsa and rsa")
+	}
+	for i, typ := range c.HostKeyTypes {
+		switch {
+		case typ != "ed25519" && typ != "ecdsa" && typ != "rsa":
+			add("host_key_types", "%q is not ed25519, ecdsa or rsa", typ)
+		case slices.Contains(c.HostKeyTypes[:i], typ):
+			add("host_key_types", "%q is listed twice", typ)
+		}
+	}
+	if c.HostKeyGrace < 0 {
+		add("host_key_grace", "must not be negative")
+	}
+
+	for _, addr := range c.Listen {
+		if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+			if path == "" {
+				add("listen", "%q has no socket path", addr)
+			}
+			continue
+		}
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+			add("listen", "%q is not host:port or unix:/path", addr)
+		}
+	}
+	if c.HTTPListen != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPListen); err != nil {
+			add("http_listen", "%q is not host:port", c.HTTPListen)
+		}
+	}
+
+	for _, addr := range c.Replicas {
+		if _, port, err := net.SplitHostPort(addr); err != nil || port == "" {
+			add("replicas", "%q is not host:port", addr)
+		}
+	}
+	if c.ReplicaOf != "" {
+		if _, port, err := net.SplitHostPort(c.ReplicaOf); err != nil || port == "" {
+			add("replica_of", "%q is not host:port", c.ReplicaOf)
+		}
+	}
+	if (len(c.Replicas) > 0 || c.ReplicaOf != "") && c.ReplicationSecret == "" {
+		add("replication_secret", "must be set when replicas or replica_of is")
+	}
+	if c.ReplicationInterval < 1 {
+		add("replication_interval", "must be at least 1 second")
+	}
+
+	for _, name := range c.ProfileNames() {
+		p := c.Profiles[name]
+		if err := checkProfileName(name); err != nil {
+			add("profiles", "%v", err)
+		}
+		if p.Host == "" {
+			add("profiles", "%s: host must not be empty", name)
+		}
+		if p.Port < 1 || p.Port > 65535 {
+			add("profiles", "%s: %d is not a valid port (1-65535)", name, p.Port)
+		}
+	}
+	if _, ok := c.Profiles[c.Profile]; c.Profile != "" && c.Profile != DefaultProfile && !ok {
+		add("profile", "no profile named %q", c.Profile)
+	}
+
+	switch strings.ToLower(c.LogLevel) {
+	case "debug", "info", "warn", "warning", "error":
+	default:
+		add("log_level", "%q is not one of debug, info, warn or error", c.LogLevel)
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		add("log_format", "%q is not text or json", c.LogFormat)
+	}
+
+	for key, v := range map[string]int{
+		"shutdown_timeout": c.ShutdownTimeout,
+		"log_max_size":     c.LogMaxSize,
+		"log_max_age":      c.LogMaxAge,
+		"log_max_backups":  c.LogMaxBackups,
+	} {
+		if v < 0 {
+			add(key, "must not be negative")
+		}
+	}
+
+	sortProblems(problems)
+	return problems
+}
+
+// CheckDirs checks that the directories the server writes to exist and
+// are writable, or can be created. Client commands don't use them, so
+// Load leaves this to the server and 'homegit config validate'.
+func (c *Config) CheckDirs() []Problem {
+	var problems []Problem
+	add := func(key, format string, args ...any) {
+		problems = append(problems, Problem{Key: key, Message: fmt.Sprintf(format, args...)})
+	}
+
+	dirs := []struct{ key, dir string }{
+		{"repos_dir", c.ReposDir},
+		{"backup_dir", c.BackupDir},
+		{"pid_file", filepath.Dir(c.PIDFile)},
+		{"host_key", filepath.Dir(c.HostKey)},
+		{"control_socket", filepath.Dir(c.ControlSocket)},
+	}
+	if c.AuditLog != "" {
+		dirs = append(dirs, struct{ key, dir string }{"audit_log", filepath.Dir(c.AuditLog)})
+	}
+	for _, d := range dirs {
+		if d.dir == "" || d.dir == "." {
+			add(d.key, "must be set to a path")
+			continue
+		}
+		if err := checkCreatable(d.dir); err != nil {
+			add(d.key, "%v", err)
+		}
+	}
+
+	sortProblems(problems)
+	return problems
+}
+
+// checkCreatable checks that dir exists and is writable, or could be
+// created, without creating anything.
+func checkCreatable(dir string) error {
+	path := dir
+	for {
+		info, err := os.Stat(path)
+		if err == nil {
+			if !info.IsDir() {
+				return fmt.Errorf("%s is not a directory", path)
+			}
+			if err := writable(path); err != nil {
+				return fmt.Errorf("%s is not writable", path)
+			}
+			return nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return fmt.Errorf("%s cannot be created", dir)
+		}
+		path = parent
+	}
+}
+
+// unknownKeys warns about keys in the file that don't match a setting,
+// suggesting the closest known key.
+func unknownKeys(raw map[string]any) []Problem {
+	known := keys()
+	var problems []Problem
+	for key := range raw {
+		if key == "version" || slices.Contains(known, key) {
+			continue
+		}
+		msg := "unknown setting, ignored"
+		if suggestion := closest(key, known); suggestion != "" {
+			msg += fmt.Sprintf(" (did you mean %q?)", suggestion)
+		}
+		problems = append(problems, Problem{Key: key, Message: msg, Warning: true})
+	}
+	sortProblems(problems)
+	return problems
+}
+
+// closest returns the known key within a small edit distance of key.
+func closest(key string, known []string) string {
+	best, bestDist := "", 3
+	for _, k := range known {
+		if d := editDistance(key, k); d < bestDist {
+			best, bestDist = k, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func sortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool { return problems[i].Key < problems[j].Key })
+}
@@ -0,0 +1,9 @@
+//go:build !windows
+
+package config
+
+import "golang.org/x/sys/unix"
+
+func writable(dir string) error {
+	return unix.Access(dir, unix.W_OK)
+}
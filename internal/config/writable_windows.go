@@ -0,0 +1,7 @@
+package config
+
+// writable can't be checked without writing on Windows; permission
+// problems surface when the directory is first used.
+func writable(dir string) error {
+	return nil
+}
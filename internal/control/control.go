@@ -0,0 +1,144 @@
+// Package control defines the RPC API served by a running homegit server on
+// its local control socket, and a client for it.
+//
+// The protocol is one JSON request per connection, answered by one JSON
+// response.
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Methods understood by the server.
+const (
+	MethodStatus      = "status"
+	MethodSessions    = "sessions"
+	MethodKill        = "kill"
+	MethodMaintenance = "maintenance"
+	MethodReload      = "reload"
+	MethodReplication = "replication"
+)
+
+// ErrNotRunning is returned when nothing is listening on the control socket.
+var ErrNotRunning = errors.New("server is not running")
+
+type Request struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+type Response struct {
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// Status is the result of MethodStatus.
+type Status struct {
+	Version     string    `json:"version"`
+	PID         int       `json:"pid"`
+	Started     time.Time `json:"started"`
+	Uptime      string    `json:"uptime"`
+	Listen      []string  `json:"listen"`
+	ReposDir    string    `json:"repos_dir"`
+	Maintenance bool      `json:"maintenance"`
+	Sessions    int       `json:"sessions"`
+}
+
+// Session describes a git operation in progress. MethodSessions returns a
+// list of them.
+type Session struct {
+	ID         uint64    `json:"id"`
+	RemoteAddr string    `json:"remote_addr"`
+	User       string    `json:"user"`
+	Repo       string    `json:"repo"`
+	Operation  string    `json:"operation"`
+	BytesIn    int64     `json:"bytes_in"`
+	BytesOut   int64     `json:"bytes_out"`
+	Started    time.Time `json:"started"`
+	Duration   string    `json:"duration"`
+}
+
+// KillParams selects the session for MethodKill.
+type KillParams struct {
+	ID uint64 `json:"id"`
+}
+
+// MaintenanceParams toggles maintenance mode, in which pushes are refused
+// and fetches keep working.
+type MaintenanceParams struct {
+	Enabled bool `json:"enabled"`
+}
+
+// Replication roles reported in ReplicationStatus.
+const (
+	RoleStandalone = "standalone"
+	RolePrimary    = "primary"
+	RoleReplica    = "replica"
+)
+
+// ReplicationStatus is the result of MethodReplication. A primary lists
+// its replicas; a replica names its primary and when each repository was
+// last updated from it. A replica can have replicas of its own.
+type ReplicationStatus struct {
+	Role     string           `json:"role"`
+	Primary  string           `json:"primary,omitempty"`
+	Interval int              `json:"interval"`
+	Replicas []ReplicaStatus  `json:"replicas,omitempty"`
+	Received []ReplicatedRepo `json:"received,omitempty"`
+}
+
+// ReplicaStatus is how far one replica is behind its primary.
+type ReplicaStatus struct {
+	Addr    string           `json:"addr"`
+	Checked time.Time        `json:"checked,omitzero"`
+	Error   string           `json:"error,omitempty"`
+	Repos   []ReplicatedRepo `json:"repos"`
+}
+
+// ReplicatedRepo is the replication state of one repository. Pending
+// repositories have changes the replica doesn't have yet; LagSeconds is
+// how long the oldest of them has been waiting.
+type ReplicatedRepo struct {
+	Repo       string    `json:"repo"`
+	Pending    bool      `json:"pending"`
+	LagSeconds float64   `json:"lag_seconds"`
+	Synced     time.Time `json:"synced,omitzero"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Call sends a request to the control socket at path and decodes the result
+// into result, which may be nil.
+func Call(path, method string, params, result any) error {
+	conn, err := net.DialTimeout("unix", path, 2*time.Second)
+	if err != nil {
+		return ErrNotRunning
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	req := Request{Method: method}
+	if params != nil {
+		if req.Params, err = json.Marshal(params); err != nil {
+			return err
+		}
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp Response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.Error != "" {
+		return errors.New(resp.Error)
+	}
+	if result != nil && resp.Result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+)
+
+// serveOnce answers a single request on a fresh socket with handler.
+func serveOnce(t *testing.T, handler func(Request) Response) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "control.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		var req Request
+		if err := json.NewDecoder(conn).Decode(&req); err != nil {
+			return
+		}
+		json.NewEncoder(conn).Encode(handler(req))
+	}()
+	return path
+}
+
+func TestCall(t *testing.T) {
+	path := serveOnce(t, func(req Request) Response {
+		var params KillParams
+		json.Unmarshal(req.Params, &params)
+		if req.Method != MethodKill || params.ID != 7 {
+			return Response{Error: "unexpected request"}
+		}
+		result, _ := json.Marshal(Status{Version: "1.2.3"})
+		return Response{Result: result}
+	})
+
+	var status Status
+	if err := Call(path, MethodKill, KillParams{ID: 7}, &status); err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	if status.Version != "1.2.3" {
+		t.Errorf("Expected version 1.2.3, got %s", status.Version)
+	}
+}
+
+func TestCallError(t *testing.T) {
+	path := serveOnce(t, func(req Request) Response {
+		return Response{Error: "no session with ID 3"}
+	})
+
+	err := Call(path, MethodKill, KillParams{ID: 3}, nil)
+	if err == nil || err.Error() != "no session with ID 3" {
+		t.Errorf("Expected server error, got %v", err)
+	}
+}
+
+func TestCallNotRunning(t *testing.T) {
+	err := Call(filepath.Join(t.TempDir(), "missing.sock"), MethodStatus, nil, nil)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Expected ErrNotRunning, got %v", err)
+	}
+}
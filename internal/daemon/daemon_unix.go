@@ -8,12 +8,19 @@ import (
 	"os/exec"
 	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/systemd"
 )
 
 func Start(cfg *config.Config) error {
+	if installed, user := systemdUnits(); installed {
+		return systemd.Systemctl(user, "start", systemd.SocketName, systemd.ServiceName)
+	}
+
 	if IsRunning(cfg) {
 		return fmt.Errorf("server is already running")
 	}
@@ -28,13 +35,16 @@ func Start(cfg *config.Config) error {
 		return err
 	}
 
-	logFile, err := os.OpenFile(filepath.Join(logDir, "server.log"), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	// The supervisor takes over writing and rotating the log once it is
+	// up; this catches anything it prints before then.
+	logFile, err := os.OpenFile(cfg.LogFile(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return err
 	}
 	defer logFile.Close()
 
-	cmd := exec.Command(exe, "serve")
+	// The supervisor locks the PID file and runs the server as its child
+	cmd := exec.Command(exe, "supervise")
 	cmd.Stdout = logFile
 	cmd.Stderr = logFile
 	cmd.Stdin = nil
@@ -46,58 +56,198 @@ func Start(cfg *config.Config) error {
 		return err
 	}
 
-	if err := os.WriteFile(cfg.PIDFile, []byte(fmt.Sprintf("%d", cmd.Process.Pid)), 0644); err != nil {
-		return err
-	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
 
-	cmd.Process.Release()
-	return nil
+	// Wait until the supervisor holds the PID file lock
+	deadline := time.After(5 * time.Second)
+	for {
+		if _, err := runningPID(cfg); err == nil {
+			return nil
+		}
+		select {
+		case err := <-exited:
+			return fmt.Errorf("server failed to start (%v), see: homegit logs", err)
+		case <-deadline:
+			return fmt.Errorf("server did not start within 5s, see: homegit logs")
+		case <-time.After(50 * time.Millisecond):
+		}
+	}
 }
 
 func Stop(cfg *config.Config) error {
-	pid, err := readPID(cfg.PIDFile)
-	if err != nil {
-		return fmt.Errorf("server is not running")
+	if installed, user := systemdUnits(); installed {
+		// Stop the socket too, or the next connection starts the server again
+		return systemd.Systemctl(user, "stop", systemd.ServiceName, systemd.SocketName)
 	}
 
-	process, err := os.FindProcess(pid)
+	pid, err := runningPID(cfg)
 	if err != nil {
-		os.Remove(cfg.PIDFile)
-		return fmt.Errorf("server is not running")
+		return err
 	}
 
-	if err := process.Signal(syscall.SIGTERM); err != nil {
-		os.Remove(cfg.PIDFile)
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil {
 		return fmt.Errorf("failed to stop server: %w", err)
 	}
 
-	os.Remove(cfg.PIDFile)
+	// The server drains in-flight operations for up to ShutdownTimeout
+	// before exiting, so allow for that plus some slack.
+	wait := time.Duration(cfg.ShutdownTimeout)*time.Second + 5*time.Second
+	deadline := time.Now().Add(wait)
+	for processAlive(pid) {
+		if time.Now().After(deadline) {
+			// The supervisor leads its own process group; take the server with it
+			syscall.Kill(-pid, syscall.SIGKILL)
+			os.Remove(cfg.PIDFile)
+			return fmt.Errorf("server did not exit within %s, killed PID %d", wait, pid)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// Reload asks the running server to re-read its config.
+func Reload(cfg *config.Config) error {
+	if installed, user := systemdUnits(); installed {
+		return systemd.Systemctl(user, "reload", systemd.ServiceName)
+	}
+
+	pid, err := runningPID(cfg)
+	if err != nil {
+		return err
+	}
+
+	// The supervisor passes the signal on to the server
+	if err := syscall.Kill(pid, syscall.SIGHUP); err != nil {
+		return fmt.Errorf("failed to reload server: %w", err)
+	}
 	return nil
 }
 
 func Status(cfg *config.Config) error {
-	if IsRunning(cfg) {
-		pid, _ := readPID(cfg.PIDFile)
-		fmt.Printf("Server is running (PID: %d)\n", pid)
-		return nil
+	st := GetState(cfg)
+	switch st.Manager {
+	case ManagerSystemdSystem:
+		fmt.Println("Server is managed by systemd (system units)")
+	case ManagerSystemdUser:
+		fmt.Println("Server is managed by systemd (user units)")
+	}
+
+	switch {
+	case st.State == StateIdle:
+		fmt.Println("Server is idle, waiting for connections on its socket")
+	case st.State == StateStopped:
+		fmt.Println("Server is not running")
+	case st.PID != 0:
+		fmt.Printf("Server is running (PID: %d)\n", st.PID)
+	default:
+		fmt.Println("Server is running")
+	}
+	if len(st.Listen) > 0 {
+		fmt.Println("Listening on:")
+		for _, addr := range st.Listen {
+			fmt.Printf("  %s\n", addr)
+		}
 	}
-	fmt.Println("Server is not running")
 	return nil
 }
 
-func IsRunning(cfg *config.Config) bool {
-	pid, err := readPID(cfg.PIDFile)
+// GetState reports whether the server is running and how.
+func GetState(cfg *config.Config) State {
+	if installed, user := systemdUnits(); installed {
+		st := State{State: StateStopped, Manager: ManagerSystemdSystem}
+		if user {
+			st.Manager = ManagerSystemdUser
+		}
+		switch {
+		case systemdActive(user, systemd.ServiceName):
+			st.State = StateRunning
+			st.Listen = listenAddrs(cfg)
+		case systemdActive(user, systemd.SocketName):
+			st.State = StateIdle
+		}
+		return st
+	}
+
+	if pid, err := runningPID(cfg); err == nil {
+		return State{State: StateRunning, Manager: ManagerHomegit, PID: pid, Listen: listenAddrs(cfg)}
+	}
+	return State{State: StateStopped, Manager: ManagerHomegit}
+}
+
+// listenAddrs returns the addresses the running server recorded.
+func listenAddrs(cfg *config.Config) []string {
+	data, err := os.ReadFile(cfg.ListenFile())
 	if err != nil {
-		return false
+		return nil
+	}
+	return strings.Fields(string(data))
+}
+
+func IsRunning(cfg *config.Config) bool {
+	if installed, user := systemdUnits(); installed {
+		return systemdActive(user, systemd.ServiceName)
 	}
 
-	process, err := os.FindProcess(pid)
+	_, err := runningPID(cfg)
+	return err == nil
+}
+
+// runningPID returns the PID of the supervisor holding the PID file lock.
+// A PID file that isn't locked, or whose PID belongs to some other program,
+// is stale and means the server is not running.
+func runningPID(cfg *config.Config) (int, error) {
+	notRunning := fmt.Errorf("server is not running")
+
+	f, err := os.Open(cfg.PIDFile)
 	if err != nil {
+		return 0, notRunning
+	}
+	defer f.Close()
+
+	// If we can take the lock, nobody holds it
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return 0, notRunning
+	}
+
+	pid, err := readPID(cfg.PIDFile)
+	if err != nil || pid <= 0 {
+		return 0, notRunning
+	}
+	if !isHomegitProcess(pid) {
+		return 0, fmt.Errorf("PID %d in %s is not a homegit process", pid, cfg.PIDFile)
+	}
+	return pid, nil
+}
+
+// isHomegitProcess checks that pid is running this binary's supervisor, so
+// a recycled PID never gets signalled.
+func isHomegitProcess(pid int) bool {
+	var args []string
+	if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		args = strings.Split(strings.TrimRight(string(data), "\x00"), "\x00")
+	} else {
+		out, err := exec.Command("ps", "-p", strconv.Itoa(pid), "-o", "command=").Output()
+		if err != nil {
+			return false
+		}
+		args = strings.Fields(string(out))
+	}
+	if len(args) < 2 || args[1] != "supervise" {
 		return false
 	}
 
-	err = process.Signal(syscall.Signal(0))
-	return err == nil
+	name := filepath.Base(args[0])
+	if exe, err := os.Executable(); err == nil && name == filepath.Base(exe) {
+		return true
+	}
+	return name == "homegit"
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, syscall.Signal(0)) == nil
 }
 
 func readPID(path string) (int, error) {
@@ -105,5 +255,5 @@ func readPID(path string) (int, error) {
 	if err != nil {
 		return 0, err
 	}
-	return strconv.Atoi(string(data))
+	return strconv.Atoi(strings.TrimSpace(string(data)))
 }
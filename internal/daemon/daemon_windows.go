@@ -12,16 +12,29 @@ func Start(cfg *config.Config) error {
 	return fmt.Errorf("daemon mode is not supported on Windows. Use 'homegit serve' instead")
 }
 
+func Supervise(cfg *config.Config) error {
+	return fmt.Errorf("daemon mode is not supported on Windows. Use 'homegit serve' instead")
+}
+
 func Stop(cfg *config.Config) error {
 	return fmt.Errorf("daemon mode is not supported on Windows")
 }
 
+func Reload(cfg *config.Config) error {
+	return fmt.Errorf("daemon mode is not supported on Windows. The server reloads its config automatically when the file changes")
+}
+
 func Status(cfg *config.Config) error {
 	fmt.Println("Daemon mode is not supported on Windows")
 	fmt.Println("Use 'homegit serve' to run in foreground")
 	return nil
 }
 
+// GetState reports the server as stopped; there is no daemon on Windows.
+func GetState(cfg *config.Config) State {
+	return State{State: StateStopped, Manager: ManagerHomegit}
+}
+
 func IsRunning(cfg *config.Config) bool {
 	return false
 }
@@ -0,0 +1,23 @@
+package daemon
+
+// State describes whether the server is running and what manages it.
+type State struct {
+	State   string   `json:"state"`
+	Manager string   `json:"manager"`
+	PID     int      `json:"pid,omitempty"`
+	Listen  []string `json:"listen,omitempty"`
+}
+
+// Values of State.State.
+const (
+	StateRunning = "running"
+	StateIdle    = "idle" // systemd holds the socket, the service starts on the first connection
+	StateStopped = "stopped"
+)
+
+// Values of State.Manager.
+const (
+	ManagerHomegit       = "homegit" // 'homegit start' and its supervisor
+	ManagerSystemdSystem = "systemd-system"
+	ManagerSystemdUser   = "systemd-user"
+)
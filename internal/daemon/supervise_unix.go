@@ -0,0 +1,195 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/logging"
+	"github.com/chris-roerig/homegit/internal/logrotate"
+)
+
+const (
+	// restartBackoffMin and restartBackoffMax bound the wait before
+	// restarting a crashed server. The wait doubles after each crash.
+	restartBackoffMin = time.Second
+	restartBackoffMax = 30 * time.Second
+
+	// A server that stays up this long resets the backoff.
+	restartStableAfter = time.Minute
+
+	// Give up after this many crashes within crashLoopWindow.
+	crashLoopLimit  = 5
+	crashLoopWindow = 5 * time.Minute
+)
+
+// Supervise holds an exclusive lock on the PID file and runs 'homegit serve'
+// as a child, restarting it with backoff if it exits unexpectedly. Its own
+// and the server's output go to the rotating server log. SIGTERM and SIGINT
+// stop the server and the supervisor; SIGHUP is passed through and also
+// reloads the log rotation settings.
+func Supervise(cfg *config.Config) error {
+	lock, err := lockPIDFile(cfg.PIDFile)
+	if err != nil {
+		return err
+	}
+	defer lock.release()
+
+	out, err := logrotate.Open(cfg.LogFile(), logrotate.ConfigPolicy(cfg))
+	if err != nil {
+		return fmt.Errorf("failed to open server log: %w", err)
+	}
+	defer out.Close()
+	if err := logging.Setup(out, cfg.LogLevel, cfg.LogFormat); err != nil {
+		return err
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGTERM, syscall.SIGINT, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	// Pick up rotation setting changes made without a SIGHUP
+	configCheck := time.NewTicker(30 * time.Second)
+	defer configCheck.Stop()
+	configModTime := modTime(config.Path())
+
+	backoff := restartBackoffMin
+	var crashes []time.Time
+
+	for {
+		cmd := exec.Command(exe, "serve")
+		cmd.Stdout = out
+		cmd.Stderr = out
+		if err := cmd.Start(); err != nil {
+			return fmt.Errorf("failed to start server: %w", err)
+		}
+		started := time.Now()
+		slog.Info("Supervisor started server", "pid", cmd.Process.Pid)
+
+		exited := make(chan error, 1)
+		go func() { exited <- cmd.Wait() }()
+
+		stopping := false
+		var exitErr error
+	wait:
+		for {
+			select {
+			case sig := <-sigChan:
+				cmd.Process.Signal(sig)
+				if sig == syscall.SIGHUP {
+					reloadRotation(out)
+				} else {
+					stopping = true
+				}
+			case <-configCheck.C:
+				if t := modTime(config.Path()); !t.Equal(configModTime) {
+					configModTime = t
+					reloadRotation(out)
+				}
+			case exitErr = <-exited:
+				break wait
+			}
+		}
+
+		if stopping {
+			return nil
+		}
+		if exitErr == nil {
+			slog.Info("Server exited cleanly, supervisor not restarting it")
+			return nil
+		}
+
+		now := time.Now()
+		if now.Sub(started) > restartStableAfter {
+			backoff = restartBackoffMin
+		}
+		crashes = append(crashes, now)
+		for len(crashes) > 0 && now.Sub(crashes[0]) > crashLoopWindow {
+			crashes = crashes[1:]
+		}
+		if len(crashes) >= crashLoopLimit {
+			slog.Error("Server is crash looping, supervisor giving up",
+				"crashes", len(crashes), "window", crashLoopWindow.String(), logging.KeyError, exitErr)
+			return fmt.Errorf("server is crash looping")
+		}
+
+		slog.Warn("Server exited unexpectedly, supervisor restarting it",
+			logging.KeyError, exitErr, "backoff", backoff.String(), "crashes", len(crashes), "limit", crashLoopLimit)
+
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				return nil
+			}
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, restartBackoffMax)
+	}
+}
+
+func reloadRotation(out *logrotate.Writer) {
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Supervisor failed to reload config", logging.KeyError, err)
+		return
+	}
+	out.SetPolicy(logrotate.ConfigPolicy(cfg))
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+type pidLock struct {
+	f *os.File
+}
+
+// lockPIDFile takes an exclusive lock on the PID file and writes our PID to
+// it. The lock is held until release, so a second supervisor can't start and
+// readers can tell a live PID file from a stale one.
+func lockPIDFile(path string) (*pidLock, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("server is already running")
+	}
+
+	if err := f.Truncate(0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if _, err := f.WriteAt([]byte(fmt.Sprintf("%d", os.Getpid())), 0); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &pidLock{f: f}, nil
+}
+
+func (l *pidLock) release() {
+	// Remove while still locked so nobody sees a stale unlocked file with our PID
+	os.Remove(l.f.Name())
+	l.f.Close()
+}
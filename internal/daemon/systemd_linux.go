@@ -0,0 +1,21 @@
+package daemon
+
+import (
+	"os/exec"
+
+	"github.com/chris-roerig/homegit/internal/systemd"
+)
+
+// systemdUnits reports whether homegit is installed as a systemd service,
+// in which case systemd rather than the PID file manages the server.
+func systemdUnits() (installed, user bool) {
+	return systemd.Installed()
+}
+
+func systemdActive(user bool, unit string) bool {
+	args := []string{"is-active", "--quiet", unit}
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...).Run() == nil
+}
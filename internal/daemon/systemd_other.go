@@ -0,0 +1,11 @@
+//go:build !linux && !windows
+
+package daemon
+
+func systemdUnits() (installed, user bool) {
+	return false, false
+}
+
+func systemdActive(user bool, unit string) bool {
+	return false
+}
@@ -1,13 +1,16 @@
 package git
 
 import (
+	"context"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 )
 
 var (
@@ -15,7 +18,7 @@ var (
 )
 
 type Command struct {
-	Type     string // "upload-pack" or "receive-pack"
+	Type     string // "upload-pack", "receive-pack" or "upload-archive"
 	RepoPath string
 }
 
@@ -31,6 +34,8 @@ func ParseCommand(cmdStr string) (*Command, error) {
 		cmdType = "upload-pack"
 	case "git-receive-pack":
 		cmdType = "receive-pack"
+	case "git-upload-archive":
+		cmdType = "upload-archive"
 	default:
 		return nil, fmt.Errorf("unsupported command: %s", parts[0])
 	}
@@ -39,18 +44,20 @@ func ParseCommand(cmdStr string) (*Command, error) {
 	return &Command{Type: cmdType, RepoPath: repoPath}, nil
 }
 
-func (c *Command) Execute(reposDir string, stdin io.Reader, stdout, stderr io.Writer) error {
+// ResolveRepo returns where the repository a client asked for as
+// repoPath lives under reposDir, refusing paths that would lead outside
+// it.
+func ResolveRepo(reposDir, repoPath string) (string, error) {
 	// Clean and validate repository path to prevent directory traversal
 	// Remove leading slash if present (Git sends paths like /repo.git)
-	repoPath := strings.TrimPrefix(c.RepoPath, "/")
-	cleanPath := filepath.Clean(repoPath)
+	cleanPath := filepath.Clean(strings.TrimPrefix(repoPath, "/"))
 
 	// Reject paths with .. or absolute paths after cleaning
 	if strings.Contains(cleanPath, "..") {
-		return fmt.Errorf("invalid repository path (contains ..): %s", c.RepoPath)
+		return "", fmt.Errorf("invalid repository path (contains ..): %s", repoPath)
 	}
 	if filepath.IsAbs(cleanPath) {
-		return fmt.Errorf("invalid repository path (absolute): %s -> %s", c.RepoPath, cleanPath)
+		return "", fmt.Errorf("invalid repository path (absolute): %s -> %s", repoPath, cleanPath)
 	}
 
 	fullPath := filepath.Join(reposDir, cleanPath)
@@ -58,18 +65,28 @@ func (c *Command) Execute(reposDir string, stdin io.Reader, stdout, stderr io.Wr
 	// Ensure the resolved path is still within repos directory
 	absReposDir, err := filepath.Abs(reposDir)
 	if err != nil {
-		return fmt.Errorf("failed to resolve repos directory: %w", err)
+		return "", fmt.Errorf("failed to resolve repos directory: %w", err)
 	}
 	absFullPath, err := filepath.Abs(fullPath)
 	if err != nil {
-		return fmt.Errorf("failed to resolve repository path: %w", err)
+		return "", fmt.Errorf("failed to resolve repository path: %w", err)
 	}
 	if !strings.HasPrefix(absFullPath, absReposDir) {
-		return fmt.Errorf("repository path outside repos directory: %s", c.RepoPath)
+		return "", fmt.Errorf("repository path outside repos directory: %s", repoPath)
+	}
+	return fullPath, nil
+}
+
+// Execute runs the git command against the repository under reposDir.
+// Cancelling ctx kills the underlying git process.
+func (c *Command) Execute(ctx context.Context, reposDir string, stdin io.Reader, stdout, stderr io.Writer) error {
+	fullPath, err := ResolveRepo(reposDir, c.RepoPath)
+	if err != nil {
+		return err
 	}
 
 	if c.Type == "receive-pack" {
-		if err := ensureRepo(fullPath); err != nil {
+		if err := EnsureRepo(fullPath); err != nil {
 			return err
 		}
 	}
@@ -78,15 +95,19 @@ func (c *Command) Execute(reposDir string, stdin io.Reader, stdout, stderr io.Wr
 		return fmt.Errorf("repository not found: %s", c.RepoPath)
 	}
 
-	cmd := exec.Command("git-"+c.Type, fullPath)
+	cmd := exec.CommandContext(ctx, "git-"+c.Type, fullPath)
 	cmd.Stdin = stdin
 	cmd.Stdout = stdout
 	cmd.Stderr = stderr
+	// Don't let a blocked stdin copy keep us waiting after the process is killed
+	cmd.WaitDelay = 5 * time.Second
 
 	return cmd.Run()
 }
 
-func ensureRepo(path string) error {
+// EnsureRepo creates an empty bare repository at path if there is none,
+// as a push to a new repository does.
+func EnsureRepo(path string) error {
 	// Lock to prevent race condition when multiple pushes try to create same repo
 	repoCreateMutex.Lock()
 	defer repoCreateMutex.Unlock()
@@ -104,6 +125,7 @@ func ensureRepo(path string) error {
 		if err := cmd.Run(); err != nil {
 			return fmt.Errorf("failed to set default branch: %w", err)
 		}
+		slog.Info("Created repository", "path", path)
 	}
 	return nil
 }
@@ -1,6 +1,11 @@
 package git
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -33,6 +38,13 @@ func TestParseCommand(t *testing.T) {
 			wantRepo:    "my-repo.git",
 			expectError: false,
 		},
+		{
+			name:        "upload-archive",
+			input:       "git-upload-archive 'my-repo.git'",
+			wantType:    "upload-archive",
+			wantRepo:    "my-repo.git",
+			expectError: false,
+		},
 		{
 			name:        "invalid command",
 			input:       "git-invalid my-repo.git",
@@ -71,3 +83,112 @@ func TestParseCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveRepo(t *testing.T) {
+	reposDir := t.TempDir()
+	got, err := ResolveRepo(reposDir, "/team/app.git")
+	if err != nil || got != filepath.Join(reposDir, "team", "app.git") {
+		t.Errorf("ResolveRepo = %q, %v", got, err)
+	}
+	for _, bad := range []string{"../other.git", "team/../../x.git"} {
+		if _, err := ResolveRepo(reposDir, bad); err == nil {
+			t.Errorf("ResolveRepo(%q) should fail", bad)
+		}
+	}
+}
+
+func pktLine(s string) string {
+	return fmt.Sprintf("%04x%s", len(s)+4, s)
+}
+
+func sniff(t *testing.T, input string) *Request {
+	t.Helper()
+	req := &Request{}
+	// Read in small chunks so pkt-lines get split across reads
+	r := Sniff(io.LimitReader(strings.NewReader(input), int64(len(input))), req)
+	buf := make([]byte, 7)
+	var out strings.Builder
+	for {
+		n, err := r.Read(buf)
+		out.Write(buf[:n])
+		if err != nil {
+			break
+		}
+	}
+	if out.String() != input {
+		t.Fatalf("Sniff changed the stream")
+	}
+	return req
+}
+
+func TestSniffPush(t *testing.T) {
+	oldID := strings.Repeat("a", 40)
+	newID := strings.Repeat("b", 40)
+	input := pktLine(oldID+" "+newID+" refs/heads/main\x00report-status side-band-64k\n") +
+		pktLine(ZeroID+" "+newID+" refs/heads/feature\n") +
+		"0000" + "PACK" + pktLine(oldID+" "+newID+" refs/heads/bogus\n")
+
+	refs := sniff(t, input).RefUpdates()
+	if len(refs) != 2 {
+		t.Fatalf("Expected 2 ref updates, got %v", refs)
+	}
+	if refs[0] != (RefUpdate{Ref: "refs/heads/main", Old: oldID, New: newID}) {
+		t.Errorf("Unexpected first update: %+v", refs[0])
+	}
+	if refs[1].Ref != "refs/heads/feature" || refs[1].Old != ZeroID {
+		t.Errorf("Unexpected second update: %+v", refs[1])
+	}
+}
+
+func TestSniffFetch(t *testing.T) {
+	id := strings.Repeat("c", 40)
+	clone := pktLine("want "+id+" multi_ack side-band-64k\n") + "0000" + pktLine("done\n")
+	if !sniff(t, clone).IsClone() {
+		t.Errorf("Expected a fetch without haves to be a clone")
+	}
+
+	fetch := pktLine("want "+id+"\n") + "0000" + pktLine("have "+id+"\n") + "0000" + pktLine("done\n")
+	if sniff(t, fetch).IsClone() {
+		t.Errorf("Expected a fetch with haves not to be a clone")
+	}
+
+	if sniff(t, "0000").IsClone() {
+		t.Errorf("Expected an up-to-date fetch not to be a clone")
+	}
+}
+
+func TestSniffReport(t *testing.T) {
+	id := strings.Repeat("d", 40)
+	advert := pktLine(id+" refs/heads/main\x00report-status side-band-64k\n") + "0000"
+	report := pktLine("unpack ok\n") + pktLine("ok refs/heads/main\n") +
+		pktLine("ng refs/heads/feature pre-receive hook declined\n") + "0000"
+	refs := []RefUpdate{{Ref: "refs/heads/main"}, {Ref: "refs/heads/feature"}, {Ref: "refs/heads/other"}}
+
+	tests := []struct {
+		name   string
+		output string
+	}{
+		{"plain", advert + report},
+		// Band 1 packets split the report at arbitrary points
+		{"side-band", advert + pktLine("\x01"+report[:13]) + pktLine("\x02progress\n") + pktLine("\x01"+report[13:]) + "0000"},
+	}
+	for _, tt := range tests {
+		var rep Report
+		var out bytes.Buffer
+		w := SniffReport(&out, &rep)
+		for i := 0; i < len(tt.output); i += 7 {
+			w.Write([]byte(tt.output[i:min(i+7, len(tt.output))]))
+		}
+		if out.String() != tt.output {
+			t.Fatalf("%s: SniffReport changed the stream", tt.name)
+		}
+
+		got := rep.Apply(append([]RefUpdate(nil), refs...))
+		if got[0].Status != RefOK || got[1].Status != RefRejected || got[1].Reason != "pre-receive hook declined" || got[2].Status != "" {
+			t.Errorf("%s: unexpected statuses %+v", tt.name, got)
+		}
+		if !rep.Rejected() {
+			t.Errorf("%s: expected the push to count as rejected", tt.name)
+		}
+	}
+}
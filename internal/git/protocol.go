@@ -0,0 +1,260 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ZeroID is the object ID git uses for a ref that doesn't exist, i.e. the
+// old value of a created ref or the new value of a deleted one.
+const ZeroID = "0000000000000000000000000000000000000000"
+
+// RefUpdate is one ref change requested by a push and, once the server
+// has reported on it, whether it was made.
+type RefUpdate struct {
+	Ref    string `json:"ref"`
+	Old    string `json:"old"`
+	New    string `json:"new"`
+	Status string `json:"status,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// Ref update statuses, as receive-pack reports them to the client.
+const (
+	RefOK       = "ok"
+	RefRejected = "rejected"
+)
+
+// Request records what a client asked for in the pkt-line negotiation at
+// the start of a session: the ref updates of a push, or the wants and haves
+// of a fetch.
+type Request struct {
+	mu    sync.Mutex
+	refs  []RefUpdate
+	wants int
+	haves int
+	done  bool
+
+	buf []byte
+}
+
+// Sniff returns a reader that passes r through unchanged while recording
+// the client's request into req. It stops parsing once the negotiation is
+// over, so pack data that follows isn't inspected.
+func Sniff(r io.Reader, req *Request) io.Reader {
+	return &sniffer{r: r, req: req}
+}
+
+type sniffer struct {
+	r   io.Reader
+	req *Request
+}
+
+func (s *sniffer) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if n > 0 {
+		s.req.feed(p[:n])
+	}
+	return n, err
+}
+
+// RefUpdates returns the ref updates a push asked for.
+func (req *Request) RefUpdates() []RefUpdate {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	return append([]RefUpdate(nil), req.refs...)
+}
+
+// IsClone reports whether a fetch asked for objects without offering any
+// it already has, which is what a fresh clone looks like.
+func (req *Request) IsClone() bool {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	return req.wants > 0 && req.haves == 0
+}
+
+// feed parses as many complete pkt-lines from data as it can.
+func (req *Request) feed(data []byte) {
+	req.mu.Lock()
+	defer req.mu.Unlock()
+	if req.done {
+		return
+	}
+	req.buf = append(req.buf, data...)
+
+	for !req.done && len(req.buf) >= 4 {
+		size, err := strconv.ParseUint(string(req.buf[:4]), 16, 16)
+		if err != nil {
+			// Not pkt-line framed; give up rather than guess
+			req.stop()
+			return
+		}
+		if size < 4 {
+			// Flush or delimiter packet. A push's commands end at the first
+			// flush; a fetch's negotiation carries on until "done".
+			req.buf = req.buf[4:]
+			if size == 0 && req.wants == 0 {
+				req.stop()
+			}
+			continue
+		}
+		if len(req.buf) < int(size) {
+			return
+		}
+		line := string(bytes.TrimSuffix(req.buf[4:size], []byte("\n")))
+		req.buf = req.buf[size:]
+		req.line(line)
+	}
+}
+
+func (req *Request) line(line string) {
+	// Capabilities follow the first line after a NUL
+	line, _, _ = strings.Cut(line, "\x00")
+
+	switch {
+	case strings.HasPrefix(line, "want "):
+		req.wants++
+	case strings.HasPrefix(line, "have "):
+		req.haves++
+	case line == "done":
+		req.stop()
+	case strings.HasPrefix(line, "shallow "), strings.HasPrefix(line, "deepen"), strings.HasPrefix(line, "filter "):
+	default:
+		// Push command: "<old> <new> <ref>"
+		fields := strings.Fields(line)
+		if len(fields) == 3 && len(fields[0]) == len(fields[1]) {
+			req.refs = append(req.refs, RefUpdate{Old: fields[0], New: fields[1], Ref: fields[2]})
+		}
+	}
+}
+
+func (req *Request) stop() {
+	req.done = true
+	req.buf = nil
+}
+
+// Report records what receive-pack told the client about each ref update,
+// from the report-status it sends once the push has been processed.
+type Report struct {
+	mu      sync.Mutex
+	results map[string]string // ref to "" if updated, otherwise why not
+	outer   []byte
+	inner   []byte
+	done    bool
+}
+
+// SniffReport returns a writer that passes receive-pack's output through to
+// w unchanged while recording its report-status into rep.
+func SniffReport(w io.Writer, rep *Report) io.Writer {
+	return &reportSniffer{w: w, rep: rep}
+}
+
+type reportSniffer struct {
+	w   io.Writer
+	rep *Report
+}
+
+func (s *reportSniffer) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	if n > 0 {
+		s.rep.feed(p[:n])
+	}
+	return n, err
+}
+
+// Apply fills in the status of each of refs that the report covers.
+func (rep *Report) Apply(refs []RefUpdate) []RefUpdate {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	for i, ref := range refs {
+		reason, ok := rep.results[ref.Ref]
+		switch {
+		case !ok:
+		case reason == "":
+			refs[i].Status = RefOK
+		default:
+			refs[i].Status, refs[i].Reason = RefRejected, reason
+		}
+	}
+	return refs
+}
+
+// Rejected reports whether receive-pack refused any ref update.
+func (rep *Report) Rejected() bool {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	for _, reason := range rep.results {
+		if reason != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// feed parses receive-pack's output. With side-band, the report is split
+// across band 1 packets as pkt-lines of its own; without, its lines are
+// sent directly.
+func (rep *Report) feed(data []byte) {
+	rep.mu.Lock()
+	defer rep.mu.Unlock()
+	if rep.done {
+		return
+	}
+	rep.outer = append(rep.outer, data...)
+	rep.outer = rep.split(rep.outer, func(payload []byte) {
+		switch {
+		case len(payload) == 0:
+		case payload[0] == 1:
+			rep.inner = rep.split(append(rep.inner, payload[1:]...), rep.line)
+		case payload[0] == 2 || payload[0] == 3:
+			// Progress and errors, which the client shows
+		default:
+			rep.line(payload)
+		}
+	})
+}
+
+// split calls fn with the payload of each complete pkt-line in buf and
+// returns what is left over.
+func (rep *Report) split(buf []byte, fn func(payload []byte)) []byte {
+	for !rep.done && len(buf) >= 4 {
+		size, err := strconv.ParseUint(string(buf[:4]), 16, 16)
+		if err != nil {
+			// Not pkt-line framed; give up rather than guess
+			rep.done = true
+			rep.outer, rep.inner = nil, nil
+			return nil
+		}
+		if size < 4 {
+			buf = buf[4:]
+			continue
+		}
+		if len(buf) < int(size) {
+			break
+		}
+		fn(buf[4:size])
+		buf = buf[size:]
+	}
+	return buf
+}
+
+// line handles one line of the report: "ok <ref>" or "ng <ref> <reason>".
+// The ref advertisement and "unpack" status are skipped.
+func (rep *Report) line(payload []byte) {
+	line := strings.TrimSuffix(string(payload), "\n")
+	status, rest, _ := strings.Cut(line, " ")
+	if status != "ok" && status != "ng" {
+		return
+	}
+	ref, reason, _ := strings.Cut(rest, " ")
+	if status == "ng" && reason == "" {
+		reason = "rejected"
+	}
+	if rep.results == nil {
+		rep.results = make(map[string]string)
+	}
+	rep.results[ref] = reason
+}
@@ -0,0 +1,45 @@
+package git
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ListReposCommand is the SSH command clients run to list the server's
+// repositories. The server answers with ListRepos, one path per line.
+const ListReposCommand = "homegit-list-repos"
+
+// ListRepos returns the repositories under reposDir as slash-separated
+// paths relative to it, such as "notes.git" or "team/website.git",
+// sorted. A repository is a directory named *.git; hidden directories
+// are skipped.
+func ListRepos(reposDir string) ([]string, error) {
+	var repos []string
+	err := filepath.WalkDir(reposDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == reposDir {
+				return err
+			}
+			return nil
+		}
+		if !entry.IsDir() || path == reposDir {
+			return nil
+		}
+		if strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if strings.HasSuffix(entry.Name(), ".git") {
+			rel, err := filepath.Rel(reposDir, path)
+			if err != nil {
+				return err
+			}
+			repos = append(repos, filepath.ToSlash(rel))
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	sort.Strings(repos)
+	return repos, err
+}
@@ -0,0 +1,37 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestListRepos(t *testing.T) {
+	dir := t.TempDir()
+	for _, path := range []string{
+		"notes.git/refs",
+		"team/website.git/objects",
+		"team/sub/deep.git",
+		"plain",
+		".trash/old.git",
+	} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	os.WriteFile(filepath.Join(dir, "stray.git"), nil, 0644)
+
+	repos, err := ListRepos(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"notes.git", "team/sub/deep.git", "team/website.git"}
+	if !reflect.DeepEqual(repos, want) {
+		t.Errorf("ListRepos = %q, want %q", repos, want)
+	}
+
+	if _, err := ListRepos(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,158 @@
+// Package health implements the checks behind the server's /healthz
+// endpoint and 'homegit doctor'. Every failed check carries a suggested
+// fix.
+package health
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type Status string
+
+const (
+	OK   Status = "ok"
+	Warn Status = "warn"
+	Fail Status = "fail"
+)
+
+// Free space thresholds for the repos directory.
+const (
+	diskWarnBytes = 1 << 30
+	diskFailBytes = 100 << 20
+)
+
+// Result is the outcome of one check.
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+func pass(name, detail string) Result {
+	return Result{Name: name, Status: OK, Detail: detail}
+}
+
+func warn(name, detail, fix string) Result {
+	return Result{Name: name, Status: Warn, Detail: detail, Fix: fix}
+}
+
+func fail(name, detail, fix string) Result {
+	return Result{Name: name, Status: Fail, Detail: detail, Fix: fix}
+}
+
+// Healthy reports whether none of the results failed. Warnings don't count.
+func Healthy(results []Result) bool {
+	for _, r := range results {
+		if r.Status == Fail {
+			return false
+		}
+	}
+	return true
+}
+
+// Server runs the checks that apply to the machine hosting the repos,
+// checking each of its host keys.
+func Server(reposDir string, hostKeys []string) []Result {
+	results := []Result{
+		CheckReposDir(reposDir),
+		CheckGit(),
+		CheckDiskSpace(reposDir),
+	}
+	for _, path := range hostKeys {
+		results = append(results, CheckHostKey(path))
+	}
+	return results
+}
+
+// CheckReposDir checks that the repos directory exists, or can be created,
+// and that new repositories can be written to it.
+func CheckReposDir(dir string) Result {
+	const name = "repos dir"
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fail(name, fmt.Sprintf("cannot create %s: %v", dir, err),
+			fmt.Sprintf("create it with 'mkdir -p %s' as the user running homegit, or set repos_dir in the config", dir))
+	}
+	f, err := os.CreateTemp(dir, ".homegit-health-*")
+	if err != nil {
+		return fail(name, fmt.Sprintf("%s is not writable: %v", dir, err),
+			fmt.Sprintf("give the user running homegit write access, e.g. 'chown -R $USER %s'", dir))
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return pass(name, dir+" is writable")
+}
+
+// CheckGit checks that git and the pack helpers the server runs are on
+// the PATH.
+func CheckGit() Result {
+	const name = "git"
+	out, err := exec.Command("git", "--version").Output()
+	if err != nil {
+		return fail(name, "git not found on PATH",
+			"install git (e.g. 'sudo apt install git' or 'brew install git')")
+	}
+	version := strings.TrimPrefix(strings.TrimSpace(string(out)), "git version ")
+
+	for _, helper := range []string{"git-upload-pack", "git-receive-pack"} {
+		if _, err := exec.LookPath(helper); err != nil {
+			return fail(name, fmt.Sprintf("git %s found but %s is not on PATH", version, helper),
+				"add git's exec path to PATH for the server: export PATH=\"$PATH:$(git --exec-path)\"")
+		}
+	}
+	return pass(name, "git "+version)
+}
+
+// CheckDiskSpace checks the free space on the filesystem holding dir.
+func CheckDiskSpace(dir string) Result {
+	const name = "disk space"
+	free, err := freeSpace(dir)
+	if err != nil {
+		return warn(name, fmt.Sprintf("cannot determine free space: %v", err), "")
+	}
+	detail := fmt.Sprintf("%s free on %s", formatBytes(free), dir)
+	switch {
+	case free < diskFailBytes:
+		return fail(name, detail, "free up space or move repos_dir to a larger disk; pushes will fail when it fills up")
+	case free < diskWarnBytes:
+		return warn(name, detail, "free up space or move repos_dir to a larger disk")
+	}
+	return pass(name, detail)
+}
+
+// CheckHostKey checks that the server's host key can be read and parsed.
+// A missing key is only a warning since the server generates one.
+func CheckHostKey(path string) Result {
+	const name = "host key"
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return warn(name, path+" does not exist yet",
+			"start the server once to generate it: homegit start")
+	}
+	if err != nil {
+		return fail(name, fmt.Sprintf("cannot read %s: %v", path, err),
+			fmt.Sprintf("make it readable by the user running homegit: chmod 600 %s", path))
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return fail(name, fmt.Sprintf("%s is not a valid private key: %v", path, err),
+			fmt.Sprintf("move it aside (mv %s %s.bad) and restart so a new key is generated; clients will see a changed host key", path, path))
+	}
+	return pass(name, fmt.Sprintf("%s %s", signer.PublicKey().Type(), ssh.FingerprintSHA256(signer.PublicKey())))
+}
+
+func formatBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	default:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+}
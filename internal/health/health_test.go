@@ -0,0 +1,61 @@
+package health
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestCheckReposDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "repos")
+	if r := CheckReposDir(dir); r.Status != OK {
+		t.Errorf("Expected a creatable repos dir to pass, got %+v", r)
+	}
+
+	// A path below a regular file can never be created
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0644)
+	r := CheckReposDir(filepath.Join(file, "repos"))
+	if r.Status != Fail || r.Fix == "" {
+		t.Errorf("Expected failure with a fix, got %+v", r)
+	}
+}
+
+func TestCheckHostKey(t *testing.T) {
+	dir := t.TempDir()
+
+	if r := CheckHostKey(filepath.Join(dir, "missing")); r.Status != Warn {
+		t.Errorf("Expected a missing key to warn, got %+v", r)
+	}
+
+	bad := filepath.Join(dir, "bad")
+	os.WriteFile(bad, []byte("not a key"), 0600)
+	if r := CheckHostKey(bad); r.Status != Fail || r.Fix == "" {
+		t.Errorf("Expected an invalid key to fail with a fix, got %+v", r)
+	}
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	block, err := ssh.MarshalPrivateKey(priv, "")
+	if err != nil {
+		t.Fatalf("Failed to marshal key: %v", err)
+	}
+	good := filepath.Join(dir, "good")
+	os.WriteFile(good, pem.EncodeToMemory(block), 0600)
+	if r := CheckHostKey(good); r.Status != OK {
+		t.Errorf("Expected a valid key to pass, got %+v", r)
+	}
+}
+
+func TestHealthy(t *testing.T) {
+	if !Healthy([]Result{{Status: OK}, {Status: Warn}}) {
+		t.Errorf("Expected warnings to count as healthy")
+	}
+	if Healthy([]Result{{Status: OK}, {Status: Fail}}) {
+		t.Errorf("Expected a failure to be unhealthy")
+	}
+}
@@ -0,0 +1,106 @@
+package hostkey
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// OpenSSH's host key update extension: after authentication the server
+// sends every host key it has in an AnnounceRequest, so clients with
+// UpdateHostKeys can learn new keys and forget retired ones. Clients ask
+// the server to prove it holds the keys they didn't know with a
+// ProveRequest, before adding them to known_hosts.
+const (
+	AnnounceRequest = "hostkeys-00@openssh.com"
+	ProveRequest    = "hostkeys-prove-00@openssh.com"
+)
+
+// Announcement is the payload of an AnnounceRequest for keys.
+func Announcement(keys []ssh.PublicKey) []byte {
+	var buf []byte
+	for _, key := range keys {
+		buf = appendString(buf, key.Marshal())
+	}
+	return buf
+}
+
+// Prove answers a ProveRequest for the connection with sessionID. The
+// payload lists the keys to prove; each must be one of signers. RSA keys
+// sign with the host key algorithm agreed in the handshake, hostKeyAlgo,
+// if it was an RSA one, as OpenSSH clients expect.
+func Prove(payload, sessionID []byte, signers []ssh.Signer, hostKeyAlgo string) ([]byte, error) {
+	blobs, err := readStrings(payload)
+	if err != nil {
+		return nil, err
+	}
+	if len(blobs) == 0 {
+		return nil, errors.New("no keys to prove")
+	}
+
+	var reply []byte
+	for _, blob := range blobs {
+		signer := findSigner(signers, blob)
+		if signer == nil {
+			return nil, errors.New("asked to prove a key this server doesn't have")
+		}
+
+		data := appendString(nil, []byte(ProveRequest))
+		data = appendString(data, sessionID)
+		data = appendString(data, blob)
+
+		var sig *ssh.Signature
+		algorithmSigner, ok := signer.(ssh.AlgorithmSigner)
+		if ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+			algo := ssh.KeyAlgoRSASHA512
+			if strings.HasPrefix(hostKeyAlgo, "rsa-sha2-") {
+				algo = hostKeyAlgo
+			}
+			sig, err = algorithmSigner.SignWithAlgorithm(rand.Reader, data, algo)
+		} else {
+			sig, err = signer.Sign(rand.Reader, data)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to sign with %s key: %w", signer.PublicKey().Type(), err)
+		}
+		reply = appendString(reply, ssh.Marshal(sig))
+	}
+	return reply, nil
+}
+
+func findSigner(signers []ssh.Signer, blob []byte) ssh.Signer {
+	for _, s := range signers {
+		if bytes.Equal(s.PublicKey().Marshal(), blob) {
+			return s
+		}
+	}
+	return nil
+}
+
+// appendString appends b as an SSH string: its length, then its bytes.
+func appendString(buf, b []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(b)))
+	return append(buf, b...)
+}
+
+// readStrings splits a sequence of SSH strings.
+func readStrings(buf []byte) ([][]byte, error) {
+	var out [][]byte
+	for len(buf) > 0 {
+		if len(buf) < 4 {
+			return nil, errors.New("truncated string")
+		}
+		n := binary.BigEndian.Uint32(buf)
+		if uint64(n) > uint64(len(buf)-4) {
+			return nil, errors.New("truncated string")
+		}
+		out = append(out, buf[4:4+n])
+		buf = buf[4+n:]
+	}
+	return out, nil
+}
@@ -0,0 +1,56 @@
+package hostkey
+
+import (
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestProve(t *testing.T) {
+	var signers []ssh.Signer
+	for _, typ := range []string{ED25519, RSA} {
+		key, err := Generate(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromSigner(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, signer)
+	}
+	pub := []ssh.PublicKey{signers[0].PublicKey(), signers[1].PublicKey()}
+	sessionID := []byte("session")
+
+	reply, err := Prove(Announcement(pub), sessionID, signers, ssh.KeyAlgoRSASHA256)
+	if err != nil {
+		t.Fatalf("Prove() error = %v", err)
+	}
+	sigs, err := readStrings(reply)
+	if err != nil || len(sigs) != 2 {
+		t.Fatalf("Expected two signatures, got %d, %v", len(sigs), err)
+	}
+	wantFormats := []string{ssh.KeyAlgoED25519, ssh.KeyAlgoRSASHA256}
+	for i, key := range pub {
+		var sig ssh.Signature
+		if err := ssh.Unmarshal(sigs[i], &sig); err != nil {
+			t.Fatal(err)
+		}
+		if sig.Format != wantFormats[i] {
+			t.Errorf("Expected a %s signature, got %s", wantFormats[i], sig.Format)
+		}
+		data := appendString(nil, []byte(ProveRequest))
+		data = appendString(data, sessionID)
+		data = appendString(data, key.Marshal())
+		if err := key.Verify(data, &sig); err != nil {
+			t.Errorf("Expected the %s signature to verify: %v", key.Type(), err)
+		}
+	}
+
+	if _, err := Prove(Announcement(pub), sessionID, signers[:1], ""); err == nil {
+		t.Error("Expected Prove to refuse a key it doesn't hold")
+	}
+	if _, err := Prove([]byte{0, 0, 0, 9, 1}, sessionID, signers, ""); err == nil {
+		t.Error("Expected Prove to refuse a truncated payload")
+	}
+}
@@ -0,0 +1,205 @@
+// Package hostkey manages SSH host keys: generating and rotating the
+// server's keys, describing them the way OpenSSH does, and pinning them
+// in known_hosts for trust on first use.
+package hostkey
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Describe returns the key's type and size as ssh-keygen prints them,
+// e.g. "ED25519 256".
+func Describe(key ssh.PublicKey) string {
+	name, bits := "", 0
+	if crypto, ok := key.(ssh.CryptoPublicKey); ok {
+		switch k := crypto.CryptoPublicKey().(type) {
+		case *rsa.PublicKey:
+			name, bits = "RSA", k.N.BitLen()
+		case *ecdsa.PublicKey:
+			name, bits = "ECDSA", k.Curve.Params().BitSize
+		}
+	}
+	switch key.Type() {
+	case ssh.KeyAlgoED25519:
+		name, bits = "ED25519", 256
+	case ssh.KeyAlgoSKED25519:
+		name, bits = "ED25519-SK", 256
+	case ssh.KeyAlgoSKECDSA256:
+		name, bits = "ECDSA-SK", 256
+	}
+	if name == "" {
+		return key.Type()
+	}
+	return fmt.Sprintf("%s %d", name, bits)
+}
+
+// Randomart draws the key's SHA256 fingerprint as ssh-keygen -lv does,
+// which is easier to compare by eye than the fingerprint itself.
+func Randomart(key ssh.PublicKey) string {
+	const (
+		width   = 17
+		height  = 9
+		symbols = " .o+=*BOX@%&#/^SE"
+		start   = len(symbols) - 2
+		end     = len(symbols) - 1
+	)
+	var field [width][height]int
+	x, y := width/2, height/2
+
+	// The "drunken bishop" walks the field two bits at a time
+	digest := sha256.Sum256(key.Marshal())
+	for _, b := range digest {
+		for range 4 {
+			if b&1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if b&2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = min(max(x, 0), width-1)
+			y = min(max(y, 0), height-1)
+			if field[x][y] < start-1 {
+				field[x][y]++
+			}
+			b >>= 2
+		}
+	}
+	field[width/2][height/2] = start
+	field[x][y] = end
+
+	var sb strings.Builder
+	sb.WriteString(border("["+Describe(key)+"]", width) + "\n")
+	for row := range height {
+		sb.WriteByte('|')
+		for col := range width {
+			sb.WriteByte(symbols[field[col][row]])
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(border("[SHA256]", width))
+	return sb.String()
+}
+
+// border is a +----+ line of the given inner width with title centred.
+func border(title string, width int) string {
+	if len(title) > width {
+		title = title[:width]
+	}
+	left := (width - len(title)) / 2
+	return "+" + strings.Repeat("-", left) + title + strings.Repeat("-", width-left-len(title)) + "+"
+}
+
+// KnownHostsFile is the user's OpenSSH known_hosts file.
+func KnownHostsFile(home string) string {
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
+
+// Line returns the known_hosts line for key at addr, a host:port. Ports
+// other than 22 use OpenSSH's [host]:port form.
+func Line(addr string, key ssh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+}
+
+// Pin states, as returned by Check.
+const (
+	Unpinned = "unpinned"
+	Pinned   = "pinned"
+	Changed  = "changed"
+)
+
+// Check looks addr up in the known_hosts file at path. For Changed, it
+// also returns the keys pinned for addr instead.
+func Check(path, addr string, key ssh.PublicKey) (string, []knownhosts.KnownKey, error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return Unpinned, nil, nil
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	err = callback(addr, placeholderAddr{}, key)
+	var keyErr *knownhosts.KeyError
+	switch {
+	case err == nil:
+		return Pinned, nil, nil
+	case errors.As(err, &keyErr) && len(keyErr.Want) > 0:
+		return Changed, keyErr.Want, nil
+	case errors.As(err, &keyErr):
+		return Unpinned, nil, nil
+	}
+	return "", nil, err
+}
+
+// Pin adds key for addr to the known_hosts file at path, creating it if
+// needed. A different key already pinned for addr is an error, since
+// replacing it silently would defeat the point of pinning.
+func Pin(path, addr string, key ssh.PublicKey) error {
+	state, want, err := Check(path, addr, key)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case Pinned:
+		return nil
+	case Changed:
+		return &ChangedError{Addr: addr, Key: key, Pinned: want}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(f, Line(addr, key))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// ChangedError is returned by Pin when known_hosts has another key for
+// the address.
+type ChangedError struct {
+	Addr   string
+	Key    ssh.PublicKey
+	Pinned []knownhosts.KnownKey
+}
+
+func (e *ChangedError) Error() string {
+	old := e.Pinned[0]
+	return fmt.Sprintf("host key for %s changed: the server presented %s, but %s line %d pins %s",
+		knownhosts.Normalize(e.Addr), ssh.FingerprintSHA256(e.Key), old.Filename, old.Line, ssh.FingerprintSHA256(old.Key))
+}
+
+// RemoveCommand is the command that removes the keys pinned for addr, for
+// when a server's key changed on purpose.
+func RemoveCommand(addr string) string {
+	return fmt.Sprintf("ssh-keygen -R '%s'", knownhosts.Normalize(addr))
+}
+
+// placeholderAddr satisfies the known_hosts callback, which prefers the
+// host name it is given over the remote address.
+type placeholderAddr struct{}
+
+func (placeholderAddr) Network() string { return "tcp" }
+func (placeholderAddr) String() string  { return "0.0.0.0:0" }
@@ -0,0 +1,101 @@
+package hostkey
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func testKey(t *testing.T, seed byte) ssh.PublicKey {
+	t.Helper()
+	s := make([]byte, ed25519.SeedSize)
+	s[0] = seed
+	pub, err := ssh.NewPublicKey(ed25519.NewKeyFromSeed(s).Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pub
+}
+
+func TestRandomart(t *testing.T) {
+	// From ssh-keygen -lv for the same key
+	want := strings.Join([]string{
+		"+--[ED25519 256]--+",
+		"|+++ .++X+*.+o    |",
+		"|.+ + .B.+.O ..   |",
+		"|  . .o+=o+.*     |",
+		"|    .oo=*o+ +    |",
+		"|    ..ooSo   +   |",
+		"|     oE .   .    |",
+		"|      .          |",
+		"|                 |",
+		"|                 |",
+		"+----[SHA256]-----+",
+	}, "\n")
+	if got := Randomart(testKey(t, 0)); got != want {
+		t.Errorf("Randomart() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestLine(t *testing.T) {
+	key := testKey(t, 0)
+	wantKey := "ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIDtqJ7zOtqQtYqOo0CpvDXNlMhV3HeJDpjrASKGLWdop"
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{"nas.lan:2222", "[nas.lan]:2222 " + wantKey},
+		{"nas.lan:22", "nas.lan " + wantKey},
+		{"[fd00::10]:2222", "[fd00::10]:2222 " + wantKey},
+	}
+	for _, tt := range tests {
+		if got := Line(tt.addr, key); got != tt.want {
+			t.Errorf("Line(%q) = %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestPin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".ssh", "known_hosts")
+	key, other := testKey(t, 0), testKey(t, 1)
+
+	if state, _, err := Check(path, "nas.lan:2222", key); err != nil || state != Unpinned {
+		t.Fatalf("Check() before pinning = %q, %v", state, err)
+	}
+	if err := Pin(path, "nas.lan:2222", key); err != nil {
+		t.Fatalf("Pin() error = %v", err)
+	}
+	// Pinning again is a no-op
+	if err := Pin(path, "nas.lan:2222", key); err != nil {
+		t.Fatalf("Pin() again error = %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 1 {
+		t.Errorf("known_hosts has %d lines, want 1:\n%s", n, data)
+	}
+
+	if state, _, err := Check(path, "nas.lan:2222", key); err != nil || state != Pinned {
+		t.Errorf("Check() = %q, %v, want pinned", state, err)
+	}
+	// Another port is another host to OpenSSH
+	if state, _, err := Check(path, "nas.lan:2300", key); err != nil || state != Unpinned {
+		t.Errorf("Check() on another port = %q, %v, want unpinned", state, err)
+	}
+
+	state, want, err := Check(path, "nas.lan:2222", other)
+	if err != nil || state != Changed || len(want) != 1 || want[0].Line != 1 {
+		t.Errorf("Check() with another key = %q, %v, %v, want changed", state, want, err)
+	}
+	var changed *ChangedError
+	if err := Pin(path, "nas.lan:2222", other); !errors.As(err, &changed) {
+		t.Errorf("Pin() with another key error = %v, want ChangedError", err)
+	}
+}
@@ -0,0 +1,162 @@
+package hostkey
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Host key types a server can present.
+const (
+	ED25519 = "ed25519"
+	ECDSA   = "ecdsa"
+	RSA     = "rsa"
+)
+
+// Types lists the host key types in the order servers offer them.
+var Types = []string{ED25519, ECDSA, RSA}
+
+// Algorithms are the host key algorithms for each type, in the order
+// clients should ask for them so they get the key servers advertise.
+var Algorithms = []string{
+	ssh.KeyAlgoED25519,
+	ssh.KeyAlgoECDSA256,
+	ssh.KeyAlgoRSASHA512,
+	ssh.KeyAlgoRSASHA256,
+}
+
+// rsaBits is the size of generated RSA keys.
+const rsaBits = 3072
+
+// Generate creates a private key of the given type.
+func Generate(typ string) (crypto.Signer, error) {
+	switch typ {
+	case ED25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	case ECDSA:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case RSA:
+		return rsa.GenerateKey(rand.Reader, rsaBits)
+	}
+	return nil, fmt.Errorf("unknown host key type %q", typ)
+}
+
+// Load reads the private key at path. RSA keys only sign with SHA-2
+// (rsa-sha2-256 and rsa-sha2-512), never with SHA-1.
+func Load(path string) (ssh.Signer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if algorithmSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		return ssh.NewSignerWithAlgorithms(algorithmSigner, []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256})
+	}
+	return signer, nil
+}
+
+// LoadOrGenerate reads the private key at path, first creating one of
+// the given type if there is none. generated reports whether it did.
+func LoadOrGenerate(path, typ string) (signer ssh.Signer, generated bool, err error) {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		if err := write(path, typ); err != nil {
+			return nil, false, err
+		}
+		generated = true
+	}
+	signer, err = Load(path)
+	return signer, generated, err
+}
+
+// write generates a key of typ and saves it at path, readable only by
+// its owner.
+func write(path, typ string) error {
+	key, err := Generate(typ)
+	if err != nil {
+		return err
+	}
+	block, err := ssh.MarshalPrivateKey(key, "")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, pem.EncodeToMemory(block), 0600)
+}
+
+// NextFile is where the key replacing the one at path waits.
+func NextFile(path string) string { return path + ".next" }
+
+// RetiredFile is where the key at path goes once it has been replaced.
+func RetiredFile(path string) string { return path + ".retired" }
+
+// Rotate generates the key that will replace the one at path, the first
+// of two steps. The new key waits at NextFile, where the server announces
+// it to clients without using it. Once they have had time to learn it,
+// Retire swaps it in. Rotate fails if a rotation of that key is already
+// under way.
+func Rotate(path, typ string) (ssh.Signer, error) {
+	next := NextFile(path)
+	if _, err := os.Stat(next); err == nil {
+		return nil, fmt.Errorf("a new key is already waiting at %s", next)
+	}
+	if err := write(next, typ); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", next, err)
+	}
+	return Load(next)
+}
+
+// Pending reports when the rotation of the key at path started, from
+// the time the next key was written. ok is false if there is none.
+func Pending(path string) (started time.Time, ok bool) {
+	info, err := os.Stat(NextFile(path))
+	if err != nil {
+		return time.Time{}, false
+	}
+	return info.ModTime(), true
+}
+
+// Retire finishes the rotation of the key at path: the next key takes
+// its place and the old one is kept at RetiredFile.
+func Retire(path string) error {
+	next := NextFile(path)
+	if _, err := Load(next); err != nil {
+		return fmt.Errorf("the new key can't be used: %w", err)
+	}
+	if err := os.Rename(path, RetiredFile(path)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to retire %s: %w", path, err)
+	}
+	if err := os.Rename(next, path); err != nil {
+		// Put the old key back rather than leave none, which would
+		// make the server generate an unknown one
+		os.Rename(RetiredFile(path), path)
+		return fmt.Errorf("failed to move %s into place: %w", next, err)
+	}
+	return nil
+}
+
+// RetireDue finishes the rotation of the key at path if it started at
+// least grace ago. done reports whether it did.
+func RetireDue(path string, grace time.Duration) (done bool, err error) {
+	started, ok := Pending(path)
+	if !ok || time.Since(started) < grace {
+		return false, nil
+	}
+	return true, Retire(path)
+}
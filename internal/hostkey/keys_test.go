@@ -0,0 +1,88 @@
+package hostkey
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestLoadOrGenerate(t *testing.T) {
+	for _, typ := range Types {
+		path := filepath.Join(t.TempDir(), "host_key")
+		signer, generated, err := LoadOrGenerate(path, typ)
+		if err != nil || !generated {
+			t.Fatalf("LoadOrGenerate(%s) = %v, %v", typ, generated, err)
+		}
+		again, generated, err := LoadOrGenerate(path, typ)
+		if err != nil || generated {
+			t.Fatalf("LoadOrGenerate(%s) again = %v, %v", typ, generated, err)
+		}
+		if string(again.PublicKey().Marshal()) != string(signer.PublicKey().Marshal()) {
+			t.Errorf("Expected the %s key to be loaded the second time, got a new one", typ)
+		}
+		if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("Expected the %s key to be private, got %v, %v", typ, info.Mode(), err)
+		}
+	}
+}
+
+func TestLoadRSAWithoutSHA1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host_key_rsa")
+	signer, _, err := LoadOrGenerate(path, RSA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := signer.(ssh.AlgorithmSigner).SignWithAlgorithm(nil, []byte("data"), ssh.KeyAlgoRSA); err == nil {
+		t.Error("Expected RSA keys to refuse ssh-rsa (SHA-1) signatures")
+	}
+}
+
+func TestRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host_key")
+	old, _, err := LoadOrGenerate(path, ED25519)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := Pending(path); ok {
+		t.Fatal("Expected no rotation before Rotate")
+	}
+
+	next, err := Rotate(path, ED25519)
+	if err != nil {
+		t.Fatalf("Rotate() error = %v", err)
+	}
+	if _, err := Rotate(path, ED25519); err == nil {
+		t.Error("Expected a second rotation to fail while one is under way")
+	}
+	if _, ok := Pending(path); !ok {
+		t.Error("Expected a rotation to be pending")
+	}
+
+	if done, err := RetireDue(path, time.Hour); err != nil || done {
+		t.Fatalf("RetireDue() within the grace period = %v, %v", done, err)
+	}
+	if done, err := RetireDue(path, 0); err != nil || !done {
+		t.Fatalf("RetireDue() after the grace period = %v, %v", done, err)
+	}
+
+	current, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(current.PublicKey().Marshal()) != string(next.PublicKey().Marshal()) {
+		t.Error("Expected the next key to replace the current one")
+	}
+	retired, err := Load(RetiredFile(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(retired.PublicKey().Marshal()) != string(old.PublicKey().Marshal()) {
+		t.Error("Expected the old key to be kept as retired")
+	}
+	if _, ok := Pending(path); ok {
+		t.Error("Expected no rotation after retiring")
+	}
+}
@@ -0,0 +1,179 @@
+// Package logging configures the structured logger shared by the server,
+// the supervisor and git execution, and parses its output back for
+// 'homegit logs'.
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field names used consistently across log records.
+const (
+	KeyConnID     = "conn_id"
+	KeyRemoteAddr = "remote_addr"
+	KeyUser       = "user"
+	KeyRepo       = "repo"
+	KeyOp         = "op"
+	KeyDuration   = "duration"
+	KeyBytes      = "bytes"
+	KeyExitCode   = "exit_code"
+	KeyError      = "error"
+)
+
+var level = new(slog.LevelVar)
+
+// Setup installs the default logger writing to w in the given format
+// ("text" or "json") at the given level. It can be called again to apply
+// a config reload; the level changes for existing loggers immediately.
+func Setup(w io.Writer, levelName, format string) error {
+	lvl, err := ParseLevel(levelName)
+	if err != nil {
+		return err
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	switch format {
+	case "", "text":
+		handler = slog.NewTextHandler(w, opts)
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q (want text or json)", format)
+	}
+
+	level.Set(lvl)
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
+
+// SetupStderr is Setup for the server's usual destination. When run as a
+// daemon, stderr is redirected into server.log.
+func SetupStderr(levelName, format string) error {
+	return Setup(os.Stderr, levelName, format)
+}
+
+// ParseLevel accepts debug, info, warn or error, case-insensitively.
+func ParseLevel(name string) (slog.Level, error) {
+	var lvl slog.Level
+	if name == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := lvl.UnmarshalText([]byte(name)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q (want debug, info, warn or error)", name)
+	}
+	return lvl, nil
+}
+
+// Entry is a parsed log line.
+type Entry struct {
+	Time   time.Time
+	Level  slog.Level
+	Msg    string
+	Fields map[string]string
+}
+
+// ParseLine parses a line written by either the text or JSON handler. It
+// returns false for lines that aren't structured log records, such as
+// output from older versions.
+func ParseLine(line string) (Entry, bool) {
+	line = strings.TrimSpace(line)
+	var fields map[string]string
+	if strings.HasPrefix(line, "{") {
+		fields = parseJSON(line)
+	} else {
+		fields = parseLogfmt(line)
+	}
+	if fields == nil {
+		return Entry{}, false
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, fields["time"])
+	if err != nil {
+		return Entry{}, false
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(fields["level"])); err != nil {
+		return Entry{}, false
+	}
+
+	e := Entry{Time: t, Level: lvl, Msg: fields["msg"], Fields: fields}
+	delete(fields, "time")
+	delete(fields, "level")
+	delete(fields, "msg")
+	return e, true
+}
+
+func parseJSON(line string) map[string]string {
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(line), &raw); err != nil {
+		return nil
+	}
+	fields := make(map[string]string, len(raw))
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			fields[k] = s
+		} else {
+			fields[k] = fmt.Sprint(v)
+		}
+	}
+	return fields
+}
+
+// parseLogfmt splits key=value pairs as written by slog.TextHandler, where
+// values containing spaces or quotes are Go-quoted.
+func parseLogfmt(line string) map[string]string {
+	fields := make(map[string]string)
+	for len(line) > 0 {
+		eq := strings.IndexByte(line, '=')
+		if eq <= 0 || strings.ContainsAny(line[:eq], " \"") {
+			return nil
+		}
+		key := line[:eq]
+		line = line[eq+1:]
+
+		var value string
+		if strings.HasPrefix(line, "\"") {
+			end := closingQuote(line)
+			if end < 0 {
+				return nil
+			}
+			unquoted, err := strconv.Unquote(line[:end+1])
+			if err != nil {
+				return nil
+			}
+			value = unquoted
+			line = line[end+1:]
+		} else if sp := strings.IndexByte(line, ' '); sp >= 0 {
+			value = line[:sp]
+			line = line[sp:]
+		} else {
+			value = line
+			line = ""
+		}
+		fields[key] = value
+		line = strings.TrimLeft(line, " ")
+	}
+	return fields
+}
+
+// closingQuote returns the index of the quote ending the string that
+// starts at s[0], skipping escaped quotes.
+func closingQuote(s string) int {
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,58 @@
+package logging
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLine(t *testing.T) {
+	for _, format := range []string{"text", "json"} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Setup(&buf, "debug", format); err != nil {
+				t.Fatalf("Setup failed: %v", err)
+			}
+			slog.Warn("Operation failed", KeyRepo, "my repo.git", KeyExitCode, 128, KeyError, `exit "status" 128`)
+
+			entry, ok := ParseLine(strings.TrimSpace(buf.String()))
+			if !ok {
+				t.Fatalf("Failed to parse %q", buf.String())
+			}
+			if entry.Level != slog.LevelWarn {
+				t.Errorf("Expected level WARN, got %v", entry.Level)
+			}
+			if entry.Msg != "Operation failed" {
+				t.Errorf("Expected message 'Operation failed', got %q", entry.Msg)
+			}
+			if entry.Fields[KeyRepo] != "my repo.git" {
+				t.Errorf("Expected repo 'my repo.git', got %q", entry.Fields[KeyRepo])
+			}
+			if entry.Fields[KeyExitCode] != "128" {
+				t.Errorf("Expected exit_code 128, got %q", entry.Fields[KeyExitCode])
+			}
+			if entry.Fields[KeyError] != `exit "status" 128` {
+				t.Errorf("Expected quoted error to round-trip, got %q", entry.Fields[KeyError])
+			}
+		})
+	}
+}
+
+func TestParseLineUnstructured(t *testing.T) {
+	for _, line := range []string{"", "SSH server listening on port 2222", "Shutting down server..."} {
+		if _, ok := ParseLine(line); ok {
+			t.Errorf("Expected %q not to parse", line)
+		}
+	}
+}
+
+func TestSetupRejectsUnknownSettings(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Setup(&buf, "loud", "text"); err == nil {
+		t.Error("Expected error for unknown level")
+	}
+	if err := Setup(&buf, "info", "xml"); err == nil {
+		t.Error("Expected error for unknown format")
+	}
+}
@@ -0,0 +1,392 @@
+// Package logrotate provides a log file writer that rotates itself by size
+// and age, optionally gzipping and pruning old segments.
+package logrotate
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/logging"
+)
+
+// timeFormat stamps rotated segments with the time they were rotated, so
+// names sort chronologically.
+const timeFormat = "20060102-150405"
+
+// Policy controls when the log rotates and what is kept. Zero values
+// disable the corresponding limit.
+type Policy struct {
+	MaxSize    int64         // rotate once the file reaches this many bytes
+	MaxAge     time.Duration // rotate once the file's first entry is this old
+	MaxBackups int           // rotated segments to keep
+	Compress   bool          // gzip rotated segments
+	Perm       os.FileMode   // mode of new log files, 0644 if zero
+}
+
+// ConfigPolicy is the rotation policy the config sets for the server's
+// logs: server.log and the audit log.
+func ConfigPolicy(cfg *config.Config) Policy {
+	return Policy{
+		MaxSize:    int64(cfg.LogMaxSize) << 20,
+		MaxAge:     time.Duration(cfg.LogMaxAge) * 24 * time.Hour,
+		MaxBackups: cfg.LogMaxBackups,
+		Compress:   cfg.LogCompress,
+	}
+}
+
+// Writer appends to a log file, rotating it according to its policy.
+// Rotation only happens between lines so records never span segments.
+type Writer struct {
+	mu       sync.Mutex
+	path     string
+	policy   Policy
+	f        *os.File // nil after a failed reopen, retried on the next Write
+	size     int64
+	started  time.Time
+	lineDone bool
+	closed   bool
+
+	// Rotated segments waiting to be compressed. A single goroutine
+	// compresses and prunes, so two rotations never tidy at once.
+	pending []string
+	tidy    chan struct{}
+	tidied  chan struct{}
+}
+
+// Open opens path for appending, creating it if needed.
+func Open(path string, policy Policy) (*Writer, error) {
+	w := &Writer{
+		path:   path,
+		policy: policy,
+		tidy:   make(chan struct{}, 1),
+		tidied: make(chan struct{}),
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	go w.tidyLoop()
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	if err := os.MkdirAll(filepath.Dir(w.path), 0755); err != nil {
+		return err
+	}
+	perm := w.policy.Perm
+	if perm == 0 {
+		perm = 0644
+	}
+	f, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, perm)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	w.f = f
+	w.size = info.Size()
+	w.started = firstEntryTime(w.path, info)
+	w.lineDone = true
+	return nil
+}
+
+// SetPolicy changes the rotation policy, e.g. after a config reload.
+func (w *Writer) SetPolicy(policy Policy) {
+	w.mu.Lock()
+	w.policy = policy
+	w.mu.Unlock()
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, os.ErrClosed
+	}
+	if w.f == nil {
+		if err := w.open(); err != nil {
+			return 0, err
+		}
+	}
+	if w.lineDone && w.due(len(p)) {
+		if err := w.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "log rotation failed: %v\n", err)
+			if w.f == nil {
+				return 0, err
+			}
+		}
+	}
+
+	n, err := w.f.Write(p)
+	w.size += int64(n)
+	if n > 0 {
+		w.lineDone = p[n-1] == '\n'
+	}
+	return n, err
+}
+
+// due reports whether writing n more bytes should first rotate the file.
+func (w *Writer) due(n int) bool {
+	if w.size == 0 {
+		return false
+	}
+	if w.policy.MaxSize > 0 && w.size+int64(n) > w.policy.MaxSize {
+		return true
+	}
+	return w.policy.MaxAge > 0 && time.Since(w.started) > w.policy.MaxAge
+}
+
+// Rotate starts a new segment now, regardless of policy.
+func (w *Writer) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+// rotate renames the log aside and opens a new one. If the new one can't
+// be opened, w.f is left nil and Write tries again.
+func (w *Writer) rotate() error {
+	if w.f != nil {
+		if err := w.f.Close(); err != nil {
+			return err
+		}
+		w.f = nil
+	}
+
+	rotated := w.path + "." + time.Now().Format(timeFormat)
+	// Two rotations in the same second get distinct names
+	for i := 1; exists(rotated) || exists(rotated+".gz"); i++ {
+		rotated = fmt.Sprintf("%s.%s-%d", w.path, time.Now().Format(timeFormat), i)
+	}
+	renameErr := os.Rename(w.path, rotated)
+
+	if err := w.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+
+	// Compressing and pruning can be slow; don't hold up logging
+	if w.policy.Compress {
+		w.pending = append(w.pending, rotated)
+	}
+	select {
+	case w.tidy <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// tidyLoop compresses and prunes rotated segments after each rotation
+// until the writer is closed. It logs without holding w.mu, since the
+// log may be this writer.
+func (w *Writer) tidyLoop() {
+	defer close(w.tidied)
+	for range w.tidy {
+		w.mu.Lock()
+		pending, keep := w.pending, w.policy.MaxBackups
+		w.pending = nil
+		w.mu.Unlock()
+
+		for _, rotated := range pending {
+			// A quick later rotation may already have pruned it
+			if err := compress(rotated); err != nil && !os.IsNotExist(err) {
+				slog.Warn("Failed to compress rotated log", "path", rotated, logging.KeyError, err)
+			}
+		}
+		if err := prune(w.path, keep); err != nil {
+			slog.Warn("Failed to prune rotated logs", "path", w.path, logging.KeyError, err)
+		}
+	}
+}
+
+// Close closes the log, after waiting for compression and pruning
+// already under way to finish.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	w.closed = true
+	var err error
+	if w.f != nil {
+		err = w.f.Close()
+	}
+	close(w.tidy)
+	w.mu.Unlock()
+
+	<-w.tidied
+	return err
+}
+
+// Segments returns the rotated segments of the log at path, oldest first,
+// followed by path itself if it exists.
+func Segments(path string) ([]string, error) {
+	matches, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	for _, m := range matches {
+		if !strings.HasSuffix(m, ".tmp") {
+			segments = append(segments, m)
+		}
+	}
+	sort.Strings(segments)
+	if exists(path) {
+		segments = append(segments, path)
+	}
+	return segments, nil
+}
+
+// RotatedAt returns when a rotated segment of the log at path was closed,
+// which is also the time of its newest entry. The live log returns false.
+func RotatedAt(path, segment string) (time.Time, bool) {
+	name := strings.TrimSuffix(filepath.Base(segment), ".gz")
+	stamp, ok := strings.CutPrefix(name, filepath.Base(path)+".")
+	if !ok || len(stamp) < len(timeFormat) {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(timeFormat, stamp[:len(timeFormat)], time.Local)
+	return t, err == nil
+}
+
+// OpenSegment opens a segment for reading, decompressing gzipped ones.
+func OpenSegment(segment string) (io.ReadCloser, error) {
+	f, err := os.Open(segment)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(segment, ".gz") {
+		return f, nil
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &gzipFile{Reader: zr, f: f}, nil
+}
+
+type gzipFile struct {
+	*gzip.Reader
+	f *os.File
+}
+
+func (g *gzipFile) Close() error {
+	g.Reader.Close()
+	return g.f.Close()
+}
+
+func compress(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Keep the segment's mode, so a private log stays private
+	tmp := path + ".gz.tmp"
+	dst, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path+".gz"); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
+// prune deletes the oldest rotated segments beyond keep.
+func prune(path string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	segments, err := Segments(path)
+	if err != nil {
+		return err
+	}
+	if len(segments) > 0 && segments[len(segments)-1] == path {
+		segments = segments[:len(segments)-1]
+	}
+	for len(segments) > keep {
+		if err := os.Remove(segments[0]); err != nil {
+			return err
+		}
+		segments = segments[1:]
+	}
+	return nil
+}
+
+// firstEntryTime returns the timestamp of the log's first record, in the
+// server log's format or a JSON object with a "time" field, falling back
+// to the file's modification time for unstructured logs.
+func firstEntryTime(path string, info os.FileInfo) time.Time {
+	if info.Size() == 0 {
+		return time.Now()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for i := 0; i < 10 && scanner.Scan(); i++ {
+		if entry, ok := logging.ParseLine(scanner.Text()); ok {
+			return entry.Time
+		}
+		var record struct {
+			Time time.Time `json:"time"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &record) == nil && !record.Time.IsZero() {
+			return record.Time
+		}
+	}
+	return info.ModTime()
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
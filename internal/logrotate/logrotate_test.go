@@ -0,0 +1,175 @@
+package logrotate
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err := Open(path, Policy{MaxSize: 20, MaxBackups: 2})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("first line ok\n"))
+	w.Write([]byte("second line\n"))
+
+	segments, err := Segments(path)
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if len(segments) != 2 {
+		t.Fatalf("Expected one rotated segment plus the live log, got %v", segments)
+	}
+	if segments[1] != path {
+		t.Errorf("Expected live log last, got %v", segments)
+	}
+	if _, ok := RotatedAt(path, segments[0]); !ok {
+		t.Errorf("Expected rotation time in %s", segments[0])
+	}
+	if got := readAll(t, segments[0]); got != "first line ok\n" {
+		t.Errorf("Expected first line in rotated segment, got %q", got)
+	}
+	if got := readAll(t, path); got != "second line\n" {
+		t.Errorf("Expected second line in live log, got %q", got)
+	}
+}
+
+func TestRotateOnlyBetweenLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err := Open(path, Policy{MaxSize: 10})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("a long partial "))
+	w.Write([]byte("line\n"))
+
+	if got := readAll(t, path); got != "a long partial line\n" {
+		t.Errorf("Expected line kept whole, got %q", got)
+	}
+}
+
+func TestCompressAndPrune(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err := Open(path, Policy{MaxBackups: 1, Compress: true})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer w.Close()
+
+	w.Write([]byte("one\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		segments, _ := Segments(path)
+		return len(segments) == 2 && strings.HasSuffix(segments[0], ".gz")
+	})
+
+	// Force a distinct rotation timestamp
+	time.Sleep(1100 * time.Millisecond)
+	w.Write([]byte("two\n"))
+	if err := w.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	waitFor(t, func() bool {
+		segments, _ := Segments(path)
+		return len(segments) == 2 && strings.HasSuffix(segments[0], ".gz") && readAll(t, segments[0]) == "two\n"
+	})
+}
+
+func TestReopenAfterFailedRotate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.log")
+	w, err := Open(path, Policy{})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	defer w.Close()
+	w.Write([]byte("before\n"))
+
+	// A path under a regular file can't be renamed to or opened, even by root
+	blocker := filepath.Join(dir, "blocker")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	w.path = filepath.Join(blocker, "server.log")
+	if err := w.Rotate(); err == nil {
+		t.Fatal("Expected rotation into an unusable path to fail")
+	}
+	if _, err := w.Write([]byte("lost\n")); err == nil {
+		t.Error("Expected a write to fail while the log can't be reopened")
+	}
+
+	w.path = path
+	if _, err := w.Write([]byte("after\n")); err != nil {
+		t.Fatalf("Write after the path recovered failed: %v", err)
+	}
+	if got := readAll(t, path); got != "before\nafter\n" {
+		t.Errorf("Expected the log reopened and appended to, got %q", got)
+	}
+}
+
+func TestCloseWaitsForCompression(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	w, err := Open(path, Policy{MaxBackups: 3, Compress: true})
+	if err != nil {
+		t.Fatalf("Failed to open log: %v", err)
+	}
+	for _, line := range []string{"one\n", "two\n", "three\n"} {
+		w.Write([]byte(line))
+		if err := w.Rotate(); err != nil {
+			t.Fatalf("Rotate failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	segments, err := Segments(path)
+	if err != nil {
+		t.Fatalf("Failed to list segments: %v", err)
+	}
+	if len(segments) != 4 {
+		t.Fatalf("Expected three rotated segments plus the live log, got %v", segments)
+	}
+	for _, segment := range segments[:3] {
+		if !strings.HasSuffix(segment, ".gz") {
+			t.Errorf("Expected %s compressed by the time Close returned", segment)
+		}
+	}
+}
+
+func readAll(t *testing.T, segment string) string {
+	t.Helper()
+	r, err := OpenSegment(segment)
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", segment, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", segment, err)
+	}
+	return string(data)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			segments, _ := Segments(filepath.Join(t.TempDir(), "server.log"))
+			t.Fatalf("Timed out waiting for rotation, segments: %v", segments)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,188 @@
+package mdns
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ttl is how long, in seconds, other hosts may cache an advertisement.
+// Legacy unicast replies use legacyTTL, as RFC 6762 section 6.7 asks.
+const (
+	ttl       = 120
+	legacyTTL = 10
+)
+
+// Responder answers queries for one Entry.
+type Responder struct {
+	conn   net.PacketConn
+	group  net.Addr
+	closed atomic.Bool
+
+	mu    sync.Mutex
+	entry Entry
+}
+
+// Advertise announces entry on the local network and answers queries for
+// it until the Responder is closed.
+func Advertise(entry Entry) (*Responder, error) {
+	group, err := net.ResolveUDPAddr("udp4", Group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return nil, err
+	}
+	r := NewResponder(conn, group, entry)
+	r.Announce()
+	go r.Serve()
+	return r, nil
+}
+
+// NewResponder answers queries for entry read from conn. Multicast
+// answers are sent to group. Call Serve to start answering.
+func NewResponder(conn net.PacketConn, group net.Addr, entry Entry) *Responder {
+	if len(entry.Instance) > 63 {
+		entry.Instance = entry.Instance[:63]
+	}
+	entry.Instance = strings.ReplaceAll(entry.Instance, ".", "-")
+	return &Responder{conn: conn, group: group, entry: entry}
+}
+
+// Announce sends the advertisement unasked, so browsers already listening
+// see the server straight away.
+func (r *Responder) Announce() error {
+	_, err := r.conn.WriteTo(r.response(0, nil, ttl), r.group)
+	return err
+}
+
+// SetFingerprint changes the host key fingerprint advertised, after the
+// server's key was replaced, and announces the change.
+func (r *Responder) SetFingerprint(fingerprint string) error {
+	r.mu.Lock()
+	r.entry.Fingerprint = fingerprint
+	r.mu.Unlock()
+	return r.Announce()
+}
+
+func (r *Responder) response(id uint16, questions []question, ttl uint32) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entry.response(id, questions, ttl)
+}
+
+// Serve answers queries until the Responder is closed.
+func (r *Responder) Serve() error {
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := r.conn.ReadFrom(buf)
+		if err != nil {
+			if r.closed.Load() {
+				return nil
+			}
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				continue
+			}
+			return err
+		}
+		m, err := parse(buf[:n])
+		if err != nil || m.flags&flagResponse != 0 || !r.asked(m.questions) {
+			continue
+		}
+
+		switch {
+		case udpPort(from) != Port:
+			r.conn.WriteTo(r.response(m.id, m.questions, legacyTTL), from)
+		case unicastRequested(m.questions):
+			r.conn.WriteTo(r.response(0, nil, ttl), from)
+		default:
+			r.conn.WriteTo(r.response(0, nil, ttl), r.group)
+		}
+	}
+}
+
+// Close withdraws the advertisement and stops answering.
+func (r *Responder) Close() error {
+	if r.closed.Swap(true) {
+		return nil
+	}
+	r.conn.WriteTo(r.response(0, nil, 0), r.group)
+	return r.conn.Close()
+}
+
+// asked reports whether any of questions is about the entry.
+func (r *Responder) asked(questions []question) bool {
+	for _, q := range questions {
+		typ := q.typ
+		switch {
+		case strings.EqualFold(q.name, Service):
+			if typ == typePTR || typ == typeANY {
+				return true
+			}
+		case strings.EqualFold(q.name, r.entry.name()):
+			if typ == typeSRV || typ == typeTXT || typ == typeANY {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func unicastRequested(questions []question) bool {
+	for _, q := range questions {
+		if q.class&unicastQU == 0 {
+			return false
+		}
+	}
+	return len(questions) > 0
+}
+
+func udpPort(addr net.Addr) int {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		return udp.Port
+	}
+	return 0
+}
+
+// HostEntry describes this machine as serving on port: its host name
+// and its non-loopback addresses.
+func HostEntry(port int) Entry {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "homegit"
+	}
+	label, _, _ := strings.Cut(hostname, ".")
+	return Entry{
+		Instance: label,
+		Host:     label + ".local.",
+		Port:     port,
+		Addrs:    LocalAddrs(),
+	}
+}
+
+// LocalAddrs returns this machine's addresses other hosts can reach:
+// IPv4 first, without loopback and link-local ones.
+func LocalAddrs() []net.IP {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	var v4, v6 []net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.IsLoopback() || ipnet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		if ipnet.IP.To4() != nil {
+			v4 = append(v4, ipnet.IP.To4())
+		} else {
+			v6 = append(v6, ipnet.IP)
+		}
+	}
+	return append(v4, v6...)
+}
@@ -0,0 +1,132 @@
+package mdns
+
+import (
+	"errors"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Browse asks the local network for homegit servers and returns those that
+// answer within timeout.
+func Browse(timeout time.Duration) ([]Entry, error) {
+	group, err := net.ResolveUDPAddr("udp4", Group)
+	if err != nil {
+		return nil, err
+	}
+	// Querying from a port other than 5353 gets answers sent straight
+	// back, so this works alongside a system mDNS daemon
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return BrowseOn(conn, group, timeout)
+}
+
+// BrowseOn sends a query to group from conn and collects the answers that
+// arrive within timeout.
+func BrowseOn(conn net.PacketConn, group net.Addr, timeout time.Duration) ([]Entry, error) {
+	id := uint16(rand.IntN(0xffff) + 1)
+	if _, err := conn.WriteTo(query(id), group); err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]*Entry)
+	var order []string
+	buf := make([]byte, 9000)
+	for {
+		n, from, err := conn.ReadFrom(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		m, err := parse(buf[:n])
+		if err != nil || m.flags&flagResponse == 0 {
+			continue
+		}
+		for _, e := range entries(m.records, sourceIP(from)) {
+			key := strings.ToLower(e.name())
+			prev, ok := found[key]
+			if !ok {
+				found[key] = &e
+				order = append(order, key)
+				continue
+			}
+			for _, ip := range e.Addrs {
+				if !slices.ContainsFunc(prev.Addrs, ip.Equal) {
+					prev.Addrs = append(prev.Addrs, ip)
+				}
+			}
+		}
+	}
+
+	result := make([]Entry, 0, len(order))
+	for _, key := range order {
+		result = append(result, *found[key])
+	}
+	return result, nil
+}
+
+// entries assembles the servers advertised by records. The address the
+// answer came from is put first, as it is known to be reachable.
+func entries(records []record, from net.IP) []Entry {
+	var result []Entry
+	for _, ptr := range records {
+		if ptr.typ != typePTR || ptr.ttl == 0 || !strings.EqualFold(ptr.name, Service) {
+			continue
+		}
+		e := Entry{Instance: strings.TrimSuffix(ptr.target, "."+Service)}
+		if from != nil {
+			e.Addrs = append(e.Addrs, from)
+		}
+		for _, r := range records {
+			if r.typ == typeSRV && strings.EqualFold(r.name, ptr.target) {
+				e.Host, e.Port = r.target, int(r.port)
+			}
+			if r.typ == typeTXT && strings.EqualFold(r.name, ptr.target) {
+				for _, kv := range r.txt {
+					key, value, _ := strings.Cut(kv, "=")
+					switch strings.ToLower(key) {
+					case "version":
+						e.Version = value
+					case "fingerprint":
+						e.Fingerprint = value
+					}
+				}
+			}
+		}
+		if e.Port == 0 {
+			continue
+		}
+		for _, r := range records {
+			if (r.typ == typeA || r.typ == typeAAAA) && strings.EqualFold(r.name, e.Host) && !slices.ContainsFunc(e.Addrs, r.ip.Equal) {
+				e.Addrs = append(e.Addrs, r.ip)
+			}
+		}
+		result = append(result, e)
+	}
+	return result
+}
+
+func sourceIP(addr net.Addr) net.IP {
+	if udp, ok := addr.(*net.UDPAddr); ok {
+		if ip4 := udp.IP.To4(); ip4 != nil {
+			return ip4
+		}
+		return udp.IP
+	}
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return nil
+	}
+	return net.ParseIP(host)
+}
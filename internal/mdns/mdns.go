@@ -0,0 +1,325 @@
+// Package mdns advertises homegit servers on the local network and finds
+// them, with multicast DNS service discovery (RFC 6762 and RFC 6763).
+//
+// A server is advertised as an instance of Service with an SRV record for
+// its port, A and AAAA records for its addresses and a TXT record with its
+// version and host key fingerprint.
+package mdns
+
+import (
+	"encoding/binary"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Service is the DNS-SD service type homegit servers advertise.
+	Service = "_homegit._tcp.local."
+	// Group is the mDNS IPv4 multicast group and port.
+	Group = "224.0.0.251:5353"
+
+	// Port is the mDNS port. Queries from any other port are "legacy
+	// unicast" queries, answered directly to the sender.
+	Port = 5353
+)
+
+// Entry is one advertised homegit server.
+type Entry struct {
+	// Instance is the server's name, usually its host name.
+	Instance string
+	// Host is the server's .local host name.
+	Host  string
+	Port  int
+	Addrs []net.IP
+
+	Version     string
+	Fingerprint string
+}
+
+// Addr returns the host:port clients should connect to: the first
+// address, or the host name if there are none.
+func (e Entry) Addr() string {
+	host := strings.TrimSuffix(e.Host, ".")
+	if len(e.Addrs) > 0 {
+		host = e.Addrs[0].String()
+	}
+	return net.JoinHostPort(host, strconv.Itoa(e.Port))
+}
+
+// String describes the entry on one line for a picker.
+func (e Entry) String() string {
+	s := e.Instance + "  " + e.Addr()
+	if e.Version != "" {
+		s += "  homegit " + e.Version
+	}
+	if e.Fingerprint != "" {
+		s += "  " + e.Fingerprint
+	}
+	return s
+}
+
+func (e Entry) name() string {
+	return e.Instance + "." + Service
+}
+
+// DNS record types and classes used by DNS-SD.
+const (
+	typeA    = 1
+	typePTR  = 12
+	typeTXT  = 16
+	typeAAAA = 28
+	typeSRV  = 33
+	typeANY  = 255
+
+	classIN = 1
+	// cacheFlush marks a record as replacing cached ones; unicastQU asks
+	// for the answer to a question to be sent straight back.
+	cacheFlush = 0x8000
+	unicastQU  = 0x8000
+
+	flagResponse      = 0x8000
+	flagAuthoritative = 0x0400
+)
+
+type question struct {
+	name  string
+	typ   uint16
+	class uint16
+}
+
+type record struct {
+	name string
+	typ  uint16
+	ttl  uint32
+
+	target string // PTR and SRV
+	port   uint16 // SRV
+	txt    []string
+	ip     net.IP
+}
+
+type message struct {
+	id        uint16
+	flags     uint16
+	questions []question
+	records   []record // answers, authority and additional alike
+}
+
+// builder appends a DNS message to buf. Names are written without
+// compression, which every decoder accepts.
+type builder struct {
+	buf []byte
+}
+
+func (b *builder) u16(v uint16) { b.buf = binary.BigEndian.AppendUint16(b.buf, v) }
+func (b *builder) u32(v uint32) { b.buf = binary.BigEndian.AppendUint32(b.buf, v) }
+
+func (b *builder) name(name string) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		if len(label) > 63 {
+			label = label[:63]
+		}
+		b.buf = append(b.buf, byte(len(label)))
+		b.buf = append(b.buf, label...)
+	}
+	b.buf = append(b.buf, 0)
+}
+
+func (b *builder) header(id, flags uint16, questions, answers, additional int) {
+	b.u16(id)
+	b.u16(flags)
+	b.u16(uint16(questions))
+	b.u16(uint16(answers))
+	b.u16(0)
+	b.u16(uint16(additional))
+}
+
+func (b *builder) question(q question) {
+	b.name(q.name)
+	b.u16(q.typ)
+	b.u16(q.class)
+}
+
+// record writes a resource record whose data is written by data.
+func (b *builder) record(name string, typ, class uint16, ttl uint32, data func()) {
+	b.name(name)
+	b.u16(typ)
+	b.u16(class)
+	b.u32(ttl)
+	at := len(b.buf)
+	b.u16(0)
+	data()
+	binary.BigEndian.PutUint16(b.buf[at:], uint16(len(b.buf)-at-2))
+}
+
+// query is a DNS-SD browse for Service.
+func query(id uint16) []byte {
+	var b builder
+	b.header(id, 0, 1, 0, 0)
+	b.question(question{name: Service, typ: typePTR, class: classIN})
+	return b.buf
+}
+
+// response advertises e with the given TTL, 0 to withdraw it. The
+// questions are echoed, as legacy unicast replies require.
+func (e Entry) response(id uint16, questions []question, ttl uint32) []byte {
+	var b builder
+	b.header(id, flagResponse|flagAuthoritative, len(questions), 1, 2+len(e.Addrs))
+	for _, q := range questions {
+		b.question(q)
+	}
+
+	b.record(Service, typePTR, classIN, ttl, func() { b.name(e.name()) })
+	b.record(e.name(), typeSRV, classIN|cacheFlush, ttl, func() {
+		b.u16(0) // priority
+		b.u16(0) // weight
+		b.u16(uint16(e.Port))
+		b.name(e.Host)
+	})
+	b.record(e.name(), typeTXT, classIN|cacheFlush, ttl, func() {
+		for _, s := range e.txt() {
+			b.buf = append(b.buf, byte(len(s)))
+			b.buf = append(b.buf, s...)
+		}
+	})
+	for _, ip := range e.Addrs {
+		if ip4 := ip.To4(); ip4 != nil {
+			b.record(e.Host, typeA, classIN|cacheFlush, ttl, func() { b.buf = append(b.buf, ip4...) })
+		} else {
+			b.record(e.Host, typeAAAA, classIN|cacheFlush, ttl, func() { b.buf = append(b.buf, ip.To16()...) })
+		}
+	}
+	return b.buf
+}
+
+func (e Entry) txt() []string {
+	txt := []string{"txtvers=1"}
+	if e.Version != "" {
+		txt = append(txt, "version="+e.Version)
+	}
+	if e.Fingerprint != "" {
+		txt = append(txt, "fingerprint="+e.Fingerprint)
+	}
+	return txt
+}
+
+var errMalformed = errors.New("malformed DNS message")
+
+// parse decodes a DNS message, keeping the record types DNS-SD uses.
+func parse(msg []byte) (*message, error) {
+	if len(msg) < 12 {
+		return nil, errMalformed
+	}
+	m := &message{
+		id:    binary.BigEndian.Uint16(msg[0:]),
+		flags: binary.BigEndian.Uint16(msg[2:]),
+	}
+	qd := int(binary.BigEndian.Uint16(msg[4:]))
+	rr := int(binary.BigEndian.Uint16(msg[6:])) + int(binary.BigEndian.Uint16(msg[8:])) + int(binary.BigEndian.Uint16(msg[10:]))
+
+	off := 12
+	for range qd {
+		name, next, err := readName(msg, off)
+		if err != nil || next+4 > len(msg) {
+			return nil, errMalformed
+		}
+		m.questions = append(m.questions, question{
+			name:  name,
+			typ:   binary.BigEndian.Uint16(msg[next:]),
+			class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for range rr {
+		name, next, err := readName(msg, off)
+		if err != nil || next+10 > len(msg) {
+			return nil, errMalformed
+		}
+		r := record{
+			name: name,
+			typ:  binary.BigEndian.Uint16(msg[next:]),
+			ttl:  binary.BigEndian.Uint32(msg[next+4:]),
+		}
+		length := int(binary.BigEndian.Uint16(msg[next+8:]))
+		start := next + 10
+		end := start + length
+		if end > len(msg) {
+			return nil, errMalformed
+		}
+		data := msg[start:end]
+
+		switch r.typ {
+		case typePTR:
+			if r.target, _, err = readName(msg, start); err != nil {
+				return nil, errMalformed
+			}
+		case typeSRV:
+			if length < 7 {
+				return nil, errMalformed
+			}
+			r.port = binary.BigEndian.Uint16(data[4:])
+			if r.target, _, err = readName(msg, start+6); err != nil {
+				return nil, errMalformed
+			}
+		case typeTXT:
+			for i := 0; i < len(data); {
+				n := int(data[i])
+				if i+1+n > len(data) {
+					return nil, errMalformed
+				}
+				r.txt = append(r.txt, string(data[i+1:i+1+n]))
+				i += 1 + n
+			}
+		case typeA, typeAAAA:
+			if length != net.IPv4len && length != net.IPv6len {
+				return nil, errMalformed
+			}
+			r.ip = net.IP(append([]byte(nil), data...))
+		}
+		m.records = append(m.records, r)
+		off = end
+	}
+	return m, nil
+}
+
+// readName decodes the possibly compressed name at off in msg, returning
+// it with a trailing dot and the offset just past it.
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1
+	for hops := 0; ; hops++ {
+		if off >= len(msg) || hops > 64 {
+			return "", 0, errMalformed
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xc0 == 0xc0:
+			if off+1 >= len(msg) {
+				return "", 0, errMalformed
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+		case n&0xc0 != 0:
+			return "", 0, errMalformed
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errMalformed
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package mdns
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// listenLoopback stands in for the multicast group: queries sent to it
+// come from an ephemeral port, so they're answered directly, as legacy
+// unicast queries on a real network are.
+func listenLoopback(t *testing.T) net.PacketConn {
+	t.Helper()
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("no loopback UDP: %v", err)
+	}
+	return conn
+}
+
+func TestBrowse(t *testing.T) {
+	server := listenLoopback(t)
+	entry := Entry{
+		Instance:    "nas",
+		Host:        "nas.local.",
+		Port:        2222,
+		Addrs:       []net.IP{net.ParseIP("192.168.1.10").To4(), net.ParseIP("fd00::10")},
+		Version:     "1.4.0",
+		Fingerprint: "SHA256:abc",
+	}
+	r := NewResponder(server, server.LocalAddr(), entry)
+	go r.Serve()
+	defer r.Close()
+
+	client := listenLoopback(t)
+	defer client.Close()
+	found, err := BrowseOn(client, server.LocalAddr(), 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("BrowseOn() error = %v", err)
+	}
+	if len(found) != 1 {
+		t.Fatalf("BrowseOn() found %d servers, want 1", len(found))
+	}
+
+	got := found[0]
+	if got.Instance != "nas" || got.Host != "nas.local." || got.Port != 2222 {
+		t.Errorf("BrowseOn() = %+v", got)
+	}
+	if got.Version != "1.4.0" || got.Fingerprint != "SHA256:abc" {
+		t.Errorf("BrowseOn() version %q, fingerprint %q", got.Version, got.Fingerprint)
+	}
+	// The address the answer came from goes first
+	want := []string{"127.0.0.1", "192.168.1.10", "fd00::10"}
+	if len(got.Addrs) != len(want) {
+		t.Fatalf("BrowseOn() addrs = %v, want %v", got.Addrs, want)
+	}
+	for i, ip := range got.Addrs {
+		if ip.String() != want[i] {
+			t.Errorf("BrowseOn() addrs = %v, want %v", got.Addrs, want)
+			break
+		}
+	}
+	if addr := got.Addr(); addr != "127.0.0.1:2222" {
+		t.Errorf("Addr() = %q", addr)
+	}
+}
+
+func TestBrowseNothing(t *testing.T) {
+	silent := listenLoopback(t)
+	defer silent.Close()
+	client := listenLoopback(t)
+	defer client.Close()
+
+	found, err := BrowseOn(client, silent.LocalAddr(), 100*time.Millisecond)
+	if err != nil || len(found) != 0 {
+		t.Errorf("BrowseOn() = %v, %v, want nothing", found, err)
+	}
+}
+
+func TestResponderIgnoresOtherServices(t *testing.T) {
+	r := NewResponder(nil, nil, Entry{Instance: "nas.lan", Host: "nas.local.", Port: 2222})
+	if r.entry.Instance != "nas-lan" {
+		t.Errorf("Instance = %q, want dots replaced", r.entry.Instance)
+	}
+
+	tests := []struct {
+		q    question
+		want bool
+	}{
+		{question{name: Service, typ: typePTR, class: classIN}, true},
+		{question{name: "_HOMEGIT._tcp.local.", typ: typeANY, class: classIN}, true},
+		{question{name: "nas-lan." + Service, typ: typeSRV, class: classIN}, true},
+		{question{name: "_ssh._tcp.local.", typ: typePTR, class: classIN}, false},
+		{question{name: Service, typ: typeA, class: classIN}, false},
+	}
+	for _, tt := range tests {
+		if got := r.asked([]question{tt.q}); got != tt.want {
+			t.Errorf("asked(%+v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestParseCompressed(t *testing.T) {
+	// A PTR answer whose target points back into the question's name
+	msg := []byte{
+		0, 0, 0x84, 0, 0, 1, 0, 1, 0, 0, 0, 0,
+		8, '_', 'h', 'o', 'm', 'e', 'g', 'i', 't', 4, '_', 't', 'c', 'p', 5, 'l', 'o', 'c', 'a', 'l', 0,
+		0, typePTR, 0, classIN,
+		0xc0, 12, 0, typePTR, 0, classIN, 0, 0, 0, 120, 0, 6,
+		3, 'n', 'a', 's', 0xc0, 12,
+	}
+	m, err := parse(msg)
+	if err != nil {
+		t.Fatalf("parse() error = %v", err)
+	}
+	if len(m.records) != 1 || m.records[0].name != Service || m.records[0].target != "nas."+Service {
+		t.Errorf("parse() records = %+v", m.records)
+	}
+
+	for _, bad := range [][]byte{msg[:20], append(append([]byte(nil), msg[:len(msg)-2]...), 0xc0, 0xff)} {
+		if _, err := parse(bad); err == nil {
+			t.Errorf("parse(%v) accepted a malformed message", bad)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Package metrics is a small Prometheus-compatible metrics registry. It
+// supports labelled counters, gauges and histograms and renders them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram bucket upper bounds in seconds, suited to
+// git operations that take from milliseconds to minutes.
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// Registry holds metric families and renders them on scrape.
+type Registry struct {
+	mu       sync.Mutex
+	families []*family
+	onScrape []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// OnScrape registers fn to run before every scrape, to refresh gauges that
+// are cheaper to compute on demand than to keep up to date.
+func (r *Registry) OnScrape(fn func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.onScrape = append(r.onScrape, fn)
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labels, nil)}
+}
+
+func (r *Registry) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labels, nil)}
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{r.register(name, help, "histogram", labels, buckets)}
+}
+
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *family {
+	f := &family{
+		name:    name,
+		help:    help,
+		typ:     typ,
+		labels:  labels,
+		buckets: buckets,
+		series:  make(map[string]*series),
+	}
+	r.mu.Lock()
+	r.families = append(r.families, f)
+	r.mu.Unlock()
+	return f
+}
+
+// Write renders every metric in the text exposition format.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	hooks := append([]func(){}, r.onScrape...)
+	families := append([]*family{}, r.families...)
+	r.mu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// Counter is a value that only goes up.
+type Counter struct{ f *family }
+
+// Inc adds one to the series with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	c.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct{ f *family }
+
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value = v })
+}
+
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.f.update(labelValues, func(s *series) { s.value += v })
+}
+
+// Reset drops every series, so labels that no longer exist stop being
+// reported.
+func (g *Gauge) Reset() {
+	g.f.mu.Lock()
+	g.f.series = make(map[string]*series)
+	g.f.mu.Unlock()
+}
+
+// Histogram counts observations into buckets.
+type Histogram struct{ f *family }
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	h.f.update(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.counts = make([]uint64, len(h.f.buckets))
+		}
+		for i, bound := range h.f.buckets {
+			if v <= bound {
+				s.counts[i]++
+			}
+		}
+		s.count++
+		s.value += v
+	})
+}
+
+type family struct {
+	name    string
+	help    string
+	typ     string
+	labels  []string
+	buckets []float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labelValues []string
+	value       float64 // counter or gauge value, histogram sum
+	counts      []uint64
+	count       uint64
+}
+
+func (f *family) update(labelValues []string, fn func(*series)) {
+	if len(labelValues) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, got %d", f.name, len(f.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...)}
+		f.series[key] = s
+	}
+	fn(s)
+}
+
+func (f *family) write(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.series))
+	for key := range f.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := f.series[key]
+		if f.typ != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, f.labelString(s.labelValues, ""), formatValue(s.value))
+			continue
+		}
+		for i, bound := range f.buckets {
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, formatValue(bound)), s.counts[i])
+		}
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, f.labelString(s.labelValues, "+Inf"), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n", f.name, f.labelString(s.labelValues, ""), formatValue(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n", f.name, f.labelString(s.labelValues, ""), s.count)
+	}
+}
+
+// labelString renders {name="value",...}, adding a histogram's le label
+// when le is set.
+func (f *family) labelString(values []string, le string) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name, escape(values[i])))
+	}
+	if le != "" {
+		pairs = append(pairs, fmt.Sprintf("le=\"%s\"", le))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
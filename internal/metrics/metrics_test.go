@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterAndGauge(t *testing.T) {
+	r := NewRegistry()
+	ops := r.NewCounter("test_operations_total", "Operations run.", "op", "repo")
+	active := r.NewGauge("test_sessions_active", "Sessions in flight.")
+
+	ops.Inc("push", "app.git")
+	ops.Inc("push", "app.git")
+	ops.Add(3, "fetch", `we"ird`)
+	active.Set(2)
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out := b.String()
+
+	for _, want := range []string{
+		"# HELP test_operations_total Operations run.\n",
+		"# TYPE test_operations_total counter\n",
+		`test_operations_total{op="push",repo="app.git"} 2` + "\n",
+		`test_operations_total{op="fetch",repo="we\"ird"} 3` + "\n",
+		"# TYPE test_sessions_active gauge\n",
+		"test_sessions_active 2\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("test_duration_seconds", "Duration.", []float64{0.1, 1}, "op")
+	h.Observe(0.05, "fetch")
+	h.Observe(0.5, "fetch")
+	h.Observe(5, "fetch")
+
+	var b strings.Builder
+	r.Write(&b)
+	out := b.String()
+
+	for _, want := range []string{
+		`test_duration_seconds_bucket{op="fetch",le="0.1"} 1`,
+		`test_duration_seconds_bucket{op="fetch",le="1"} 2`,
+		`test_duration_seconds_bucket{op="fetch",le="+Inf"} 3`,
+		`test_duration_seconds_sum{op="fetch"} 5.55`,
+		`test_duration_seconds_count{op="fetch"} 3`,
+	} {
+		if !strings.Contains(out, want+"\n") {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestOnScrapeAndReset(t *testing.T) {
+	r := NewRegistry()
+	repos := r.NewGauge("test_repo_size_bytes", "Repo size.", "repo")
+	current := map[string]float64{"a.git": 10, "b.git": 20}
+	r.OnScrape(func() {
+		repos.Reset()
+		for repo, size := range current {
+			repos.Set(size, repo)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(rec.Body.String(), `test_repo_size_bytes{repo="b.git"} 20`) {
+		t.Errorf("Expected b.git in first scrape, got:\n%s", rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Expected text/plain content type, got %q", ct)
+	}
+
+	delete(current, "b.git")
+	rec = httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if strings.Contains(rec.Body.String(), "b.git") {
+		t.Errorf("Expected b.git to be gone after reset, got:\n%s", rec.Body.String())
+	}
+}
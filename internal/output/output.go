@@ -0,0 +1,239 @@
+// Package output renders command results as a table for people, or as
+// JSON or YAML for scripts. The structured forms are encoded from the
+// same values, so their fields and order are identical.
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is how a command prints its result.
+type Format string
+
+const (
+	Table Format = "table"
+	JSON  Format = "json"
+	YAML  Format = "yaml"
+)
+
+// Formats lists the accepted --output values.
+var Formats = []string{string(Table), string(JSON), string(YAML)}
+
+// String and Set make *Format a flag.Value.
+func (f *Format) String() string {
+	if *f == "" {
+		return string(Table)
+	}
+	return string(*f)
+}
+
+func (f *Format) Set(value string) error {
+	switch Format(value) {
+	case Table, JSON, YAML:
+		*f = Format(value)
+		return nil
+	}
+	return fmt.Errorf("unknown output format %q (%s)", value, strings.Join(Formats, ", "))
+}
+
+// Structured reports whether f is meant for scripts rather than people.
+func (f Format) Structured() bool {
+	return f == JSON || f == YAML
+}
+
+// Print writes v as JSON or YAML, or calls table for the table format.
+func Print(w io.Writer, f Format, v any, table func() error) error {
+	switch f {
+	case JSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "%s\n", data)
+		return err
+	case YAML:
+		return WriteYAML(w, v)
+	}
+	return table()
+}
+
+// PrintLine writes v as a single line for streamed output such as logs:
+// a JSON object per line, or a YAML list item.
+func PrintLine(w io.Writer, f Format, v any) error {
+	if f == YAML {
+		return WriteYAML(w, []any{v})
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// WriteYAML writes v as YAML. v is encoded as JSON first, so json tags
+// and omitempty apply and fields keep their declaration order.
+func WriteYAML(w io.Writer, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	node, err := decodeOrdered(dec)
+	if err != nil {
+		return err
+	}
+	var b strings.Builder
+	writeNode(&b, node, 0, false)
+	_, err = io.WriteString(w, b.String())
+	return err
+}
+
+// object is a JSON object with its keys in their original order.
+type object struct {
+	keys   []string
+	values []any
+}
+
+func decodeOrdered(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := &object{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.keys = append(obj.keys, key.(string))
+			obj.values = append(obj.values, value)
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+// writeNode writes node at the given indent. inline is set when the node
+// follows "- " or "key: " on the current line.
+func writeNode(b *strings.Builder, node any, indent int, inline bool) {
+	pad := strings.Repeat("  ", indent)
+	switch n := node.(type) {
+	case *object:
+		if len(n.keys) == 0 {
+			b.WriteString("{}\n")
+			return
+		}
+		for i, key := range n.keys {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString(scalar(key) + ":")
+			writeValue(b, n.values[i], indent+1)
+		}
+	case []any:
+		if len(n) == 0 {
+			b.WriteString("[]\n")
+			return
+		}
+		for i, item := range n {
+			if i > 0 || !inline {
+				b.WriteString(pad)
+			}
+			b.WriteString("- ")
+			writeNode(b, item, indent+1, true)
+		}
+	default:
+		b.WriteString(scalar(n) + "\n")
+	}
+}
+
+// writeValue writes the value of a mapping key, on the same line when
+// it's a scalar or empty and on the following lines otherwise.
+func writeValue(b *strings.Builder, value any, indent int) {
+	switch v := value.(type) {
+	case *object:
+		if len(v.keys) > 0 {
+			b.WriteString("\n")
+			writeNode(b, v, indent, false)
+			return
+		}
+	case []any:
+		if len(v) > 0 {
+			// Lists sit at the key's indent, as is conventional
+			b.WriteString("\n")
+			writeNode(b, v, indent-1, false)
+			return
+		}
+	}
+	b.WriteString(" ")
+	writeNode(b, value, indent, true)
+}
+
+// scalar formats a JSON scalar as YAML, quoting strings that YAML would
+// otherwise read as another type or that contain special characters.
+func scalar(v any) string {
+	switch s := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if s {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return s.String()
+	case string:
+		if needsQuotes(s) {
+			data, _ := json.Marshal(s)
+			return string(data)
+		}
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+func needsQuotes(s string) bool {
+	if s == "" || strings.TrimSpace(s) != s {
+		return true
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~", "y", "n":
+		return true
+	}
+	if strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`0123456789.+") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") {
+		return true
+	}
+	for _, r := range s {
+		if r < ' ' || r == 0x7f {
+			return true
+		}
+	}
+	return false
+}
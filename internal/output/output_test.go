@@ -0,0 +1,81 @@
+package output
+
+import (
+	"bytes"
+	"testing"
+)
+
+type testRepo struct {
+	Name string   `json:"name"`
+	Path string   `json:"path,omitempty"`
+	Tags []string `json:"tags,omitempty"`
+}
+
+type testList struct {
+	Server string     `json:"server"`
+	Empty  []string   `json:"empty"`
+	Repos  []testRepo `json:"repos"`
+	Extra  struct {
+		Count int  `json:"count"`
+		OK    bool `json:"ok"`
+	} `json:"extra"`
+}
+
+func TestWriteYAML(t *testing.T) {
+	v := testList{Server: "nas.lan:2222", Empty: []string{}, Repos: []testRepo{
+		{Name: "notes.git", Path: "/srv/notes.git", Tags: []string{"a", "yes"}},
+		{Name: "2024"},
+	}}
+	v.Extra.Count = 2
+	v.Extra.OK = true
+
+	var b bytes.Buffer
+	if err := WriteYAML(&b, v); err != nil {
+		t.Fatal(err)
+	}
+	want := `server: nas.lan:2222
+empty: []
+repos:
+- name: notes.git
+  path: /srv/notes.git
+  tags:
+  - a
+  - "yes"
+- name: "2024"
+extra:
+  count: 2
+  ok: true
+`
+	if b.String() != want {
+		t.Errorf("YAML mismatch:\ngot:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestPrint(t *testing.T) {
+	var b bytes.Buffer
+	tableCalled := false
+	if err := Print(&b, Table, nil, func() error { tableCalled = true; return nil }); err != nil || !tableCalled {
+		t.Errorf("Expected the table format to call table, err %v", err)
+	}
+
+	b.Reset()
+	if err := Print(&b, JSON, testRepo{Name: "a.git"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n  \"name\": \"a.git\"\n}\n"; b.String() != want {
+		t.Errorf("Expected %q, got %q", want, b.String())
+	}
+}
+
+func TestFormatSet(t *testing.T) {
+	var f Format
+	if f.String() != "table" {
+		t.Errorf("Expected table by default, got %s", f.String())
+	}
+	if err := f.Set("yaml"); err != nil || f != YAML {
+		t.Errorf("Expected yaml, got %s, %v", f, err)
+	}
+	if err := f.Set("xml"); err == nil {
+		t.Errorf("Expected an error for xml")
+	}
+}
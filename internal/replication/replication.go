@@ -0,0 +1,400 @@
+// Package replication keeps standby homegit servers in step with a
+// primary. The primary mirror-pushes each repository to its replicas over
+// the homegit SSH protocol, right after every push it receives and in a
+// periodic sweep that also catches repositories created, renamed and
+// removed on disk.
+package replication
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/logging"
+)
+
+const (
+	// SecretEnv carries the replication secret from primary to replica.
+	// ssh sends it as an environment variable, so it never shows up in a
+	// command line.
+	SecretEnv = "HOMEGIT_REPLICATION_SECRET"
+
+	// MetaCommand creates a repository on a replica if needed and sets its
+	// default branch and description from the Meta on its stdin.
+	MetaCommand = "homegit-replica-meta"
+	// DeleteCommand removes a repository from a replica.
+	DeleteCommand = "homegit-replica-delete"
+)
+
+// Meta is what a replica gets about a repository besides its refs.
+type Meta struct {
+	Head        string `json:"head"`
+	Description string `json:"description"`
+}
+
+// sshOptions make replication fail rather than prompt. A replica's host
+// key must already be pinned in known_hosts, so the secret is never sent
+// to a server that only claims to be the replica.
+var sshOptions = []string{
+	"-o", "BatchMode=yes",
+	"-o", "ConnectTimeout=10",
+	"-o", "StrictHostKeyChecking=yes",
+	"-o", "SendEnv=" + SecretEnv,
+}
+
+// Replicator pushes a primary's repositories to its replicas.
+type Replicator struct {
+	config func() *config.Config
+	notify chan string
+
+	mu       sync.Mutex
+	replicas map[string]*replicaState
+}
+
+type replicaState struct {
+	checked time.Time
+	err     string
+	repos   map[string]*repoState
+}
+
+type repoState struct {
+	synced   string // fingerprint of what the replica has
+	syncedAt time.Time
+	pending  time.Time // when a change the replica lacks was first seen
+	err      string
+}
+
+// New returns a Replicator that takes the replicas and repos directory
+// from config, which it calls each time so reloads take effect.
+func New(config func() *config.Config) *Replicator {
+	return &Replicator{
+		config:   config,
+		notify:   make(chan string, 64),
+		replicas: make(map[string]*replicaState),
+	}
+}
+
+// Notify tells the replicator that repo, e.g. "team/app.git", changed. It
+// never blocks; if too many changes are queued, the next sweep catches up.
+func (r *Replicator) Notify(repo string) {
+	r.mu.Lock()
+	now := time.Now()
+	for _, rs := range r.replicas {
+		if st := rs.repo(repo); st.pending.IsZero() {
+			st.pending = now
+		}
+	}
+	r.mu.Unlock()
+
+	select {
+	case r.notify <- repo:
+	default:
+	}
+}
+
+// Run replicates until ctx is done: notified repositories at once, and
+// everything every replication_interval seconds.
+func (r *Replicator) Run(ctx context.Context) {
+	sweep := time.After(0)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case repo := <-r.notify:
+			cfg := r.config()
+			for _, addr := range cfg.Replicas {
+				r.replicate(ctx, cfg, addr, repo, false)
+			}
+		case <-sweep:
+			cfg := r.config()
+			r.sweep(ctx, cfg)
+			sweep = time.After(time.Duration(cfg.ReplicationInterval) * time.Second)
+		}
+	}
+}
+
+// Status reports each replica configured in cfg.
+func (r *Replicator) Status(cfg *config.Config) []control.ReplicaStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	statuses := []control.ReplicaStatus{}
+	for _, addr := range cfg.Replicas {
+		status := control.ReplicaStatus{Addr: addr, Repos: []control.ReplicatedRepo{}}
+		if rs, ok := r.replicas[addr]; ok {
+			status.Checked, status.Error = rs.checked, rs.err
+			for repo, st := range rs.repos {
+				rr := control.ReplicatedRepo{Repo: repo, Synced: st.syncedAt, Error: st.err}
+				if !st.pending.IsZero() {
+					rr.Pending = true
+					rr.LagSeconds = now.Sub(st.pending).Round(time.Second).Seconds()
+				}
+				status.Repos = append(status.Repos, rr)
+			}
+			sort.Slice(status.Repos, func(i, j int) bool { return status.Repos[i].Repo < status.Repos[j].Repo })
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// sweep brings every replica in line with the repos directory: it pushes
+// what changed since the last push and deletes what is gone.
+func (r *Replicator) sweep(ctx context.Context, cfg *config.Config) {
+	r.mu.Lock()
+	for addr := range r.replicas {
+		if !slices.Contains(cfg.Replicas, addr) {
+			delete(r.replicas, addr)
+		}
+	}
+	r.mu.Unlock()
+	if len(cfg.Replicas) == 0 {
+		return
+	}
+
+	local, err := git.ListRepos(cfg.ReposDir)
+	if err != nil {
+		slog.Error("Replication: failed to list repositories", logging.KeyError, err)
+		return
+	}
+	for _, addr := range cfg.Replicas {
+		remote, err := listRepos(ctx, cfg, addr)
+		r.mu.Lock()
+		rs := r.replica(addr)
+		rs.checked, rs.err = time.Now(), errString(err)
+		r.mu.Unlock()
+		if err != nil {
+			slog.Warn("Replication: replica unreachable", "replica", addr, logging.KeyError, err)
+			continue
+		}
+
+		for _, repo := range local {
+			r.replicate(ctx, cfg, addr, repo, !slices.Contains(remote, repo))
+		}
+
+		// An empty repos directory is more likely a missing mount than
+		// the end of every repository
+		if len(local) == 0 {
+			if len(remote) > 0 {
+				slog.Warn("Replication: no local repositories, not deleting the replica's", "replica", addr, "count", len(remote))
+			}
+			continue
+		}
+		for _, repo := range remote {
+			if slices.Contains(local, repo) {
+				continue
+			}
+			if _, err := runSSH(ctx, cfg, addr, fmt.Sprintf("%s '%s'", DeleteCommand, repo), nil); err != nil {
+				slog.Warn("Replication: failed to delete repository", "replica", addr, logging.KeyRepo, repo, logging.KeyError, err)
+				continue
+			}
+			slog.Info("Replication: deleted repository", "replica", addr, logging.KeyRepo, repo)
+			r.mu.Lock()
+			delete(rs.repos, repo)
+			r.mu.Unlock()
+		}
+	}
+}
+
+// replicate pushes repo to the replica at addr unless it already has the
+// current state. missing is set when the replica is known not to have
+// repo at all.
+func (r *Replicator) replicate(ctx context.Context, cfg *config.Config, addr, repo string, missing bool) {
+	path := filepath.Join(cfg.ReposDir, filepath.FromSlash(repo))
+	if _, err := os.Stat(path); err != nil {
+		// Removed since; the sweep deletes it from the replica
+		return
+	}
+	fp, meta, hasRefs, err := fingerprint(ctx, path)
+
+	r.mu.Lock()
+	st := r.replica(addr).repo(repo)
+	if err == nil && !missing && st.synced == fp {
+		st.pending = time.Time{}
+		r.mu.Unlock()
+		return
+	}
+	if st.pending.IsZero() {
+		st.pending = time.Now()
+	}
+	r.mu.Unlock()
+
+	if err == nil && hasRefs {
+		host, port, _ := net.SplitHostPort(addr)
+		url := "ssh://" + net.JoinHostPort(host, port) + "/" + repo
+		_, err = runGit(ctx, cfg, path, "push", "--quiet", "--mirror", url)
+	}
+	if err == nil {
+		data, _ := json.Marshal(meta)
+		_, err = runSSH(ctx, cfg, addr, fmt.Sprintf("%s '%s'", MetaCommand, repo), data)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		if ctx.Err() == nil {
+			slog.Warn("Replication failed", "replica", addr, logging.KeyRepo, repo, logging.KeyError, err)
+		}
+		st.err = err.Error()
+		return
+	}
+	slog.Debug("Replicated", "replica", addr, logging.KeyRepo, repo)
+	st.synced, st.syncedAt, st.pending, st.err = fp, time.Now(), time.Time{}, ""
+}
+
+// fingerprint identifies the replicated state of the repository at path:
+// its refs, default branch and description.
+func fingerprint(ctx context.Context, path string) (fp string, meta Meta, hasRefs bool, err error) {
+	refs, err := runGit(ctx, nil, path, "for-each-ref", "--format=%(objectname) %(refname)")
+	if err != nil {
+		return "", meta, false, err
+	}
+	meta.Head, _ = runGit(ctx, nil, path, "symbolic-ref", "HEAD")
+	if data, err := os.ReadFile(filepath.Join(path, "description")); err == nil {
+		meta.Description = strings.TrimSpace(string(data))
+	}
+	sum := sha256.Sum256([]byte(refs + "\x00" + meta.Head + "\x00" + meta.Description))
+	return hex.EncodeToString(sum[:]), meta, refs != "", nil
+}
+
+// ReadMeta decodes the Meta a primary sends with MetaCommand.
+func ReadMeta(r io.Reader) (Meta, error) {
+	var meta Meta
+	if err := json.NewDecoder(io.LimitReader(r, 1<<20)).Decode(&meta); err != nil {
+		return meta, errors.New("invalid repository metadata")
+	}
+	return meta, nil
+}
+
+// ApplyMeta is the replica's side of MetaCommand for the repository at
+// path.
+func ApplyMeta(path string, meta Meta) error {
+	if err := git.EnsureRepo(path); err != nil {
+		return err
+	}
+	if strings.HasPrefix(meta.Head, "refs/heads/") {
+		if out, err := exec.Command("git", "-C", path, "symbolic-ref", "HEAD", meta.Head).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to set default branch: %s", strings.TrimSpace(string(out)))
+		}
+	}
+	if meta.Description != "" {
+		if err := os.WriteFile(filepath.Join(path, "description"), []byte(meta.Description+"\n"), 0644); err != nil {
+			return fmt.Errorf("failed to set description: %w", err)
+		}
+	}
+	return nil
+}
+
+// listRepos asks the replica at addr for its repositories.
+func listRepos(ctx context.Context, cfg *config.Config, addr string) ([]string, error) {
+	out, err := runSSH(ctx, cfg, addr, git.ListReposCommand, nil)
+	if err != nil {
+		return nil, err
+	}
+	var repos []string
+	for _, line := range strings.Split(out, "\n") {
+		if line = strings.TrimSpace(line); strings.HasSuffix(line, ".git") {
+			repos = append(repos, line)
+		}
+	}
+	return repos, nil
+}
+
+// runSSH runs command on the server at addr with stdin as its input.
+func runSSH(ctx context.Context, cfg *config.Config, addr, command string, stdin []byte) (string, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	args := append(slices.Clone(sshOptions), "-p", port, host, command)
+	cmd := exec.CommandContext(ctx, "ssh", args...)
+	cmd.Env = append(os.Environ(), SecretEnv+"="+cfg.ReplicationSecret)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	return output(cmd, "ssh")
+}
+
+// runGit runs git in dir. With cfg, ssh is set up to authenticate as the
+// primary.
+func runGit(ctx context.Context, cfg *config.Config, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", dir}, args...)...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if cfg != nil {
+		cmd.Env = append(cmd.Env,
+			"GIT_SSH_COMMAND=ssh "+strings.Join(sshOptions, " "),
+			SecretEnv+"="+cfg.ReplicationSecret)
+	}
+	return output(cmd, "git "+args[0])
+}
+
+// output runs cmd and returns its trimmed stdout. The error includes the
+// first ssh, fatal or error line cmd printed to stderr, or failing that
+// the last line.
+func output(cmd *exec.Cmd, name string) (string, error) {
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if strings.Contains(stderr.String(), "Host key verification failed") {
+			return "", errors.New("the replica's host key isn't pinned or has changed; check it with 'homegit replication pin'")
+		}
+		lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+		msg := strings.TrimSpace(lines[len(lines)-1])
+		for _, line := range lines {
+			if strings.HasPrefix(line, "ssh: ") || strings.HasPrefix(line, "fatal: ") || strings.HasPrefix(line, "error: ") {
+				msg = strings.TrimSpace(line)
+				break
+			}
+		}
+		if msg != "" {
+			return "", fmt.Errorf("%s: %s", name, strings.TrimPrefix(msg, name+": "))
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+func (r *Replicator) replica(addr string) *replicaState {
+	rs, ok := r.replicas[addr]
+	if !ok {
+		rs = &replicaState{repos: make(map[string]*repoState)}
+		r.replicas[addr] = rs
+	}
+	return rs
+}
+
+func (rs *replicaState) repo(repo string) *repoState {
+	st, ok := rs.repos[repo]
+	if !ok {
+		st = &repoState{}
+		rs.repos[repo] = st
+	}
+	return st
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,50 @@
+package replication
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApplyMeta(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "team", "app.git")
+	want := Meta{Head: "refs/heads/trunk", Description: "App desc"}
+
+	meta, err := ReadMeta(strings.NewReader(`{"head":"refs/heads/trunk","description":"App desc"}`))
+	if err != nil {
+		t.Fatalf("ReadMeta() error = %v", err)
+	}
+	if meta != want {
+		t.Fatalf("ReadMeta() = %+v, want %+v", meta, want)
+	}
+	if err := ApplyMeta(path, meta); err != nil {
+		t.Fatalf("ApplyMeta() error = %v", err)
+	}
+
+	fp, got, hasRefs, err := fingerprint(context.Background(), path)
+	if err != nil {
+		t.Fatalf("fingerprint() error = %v", err)
+	}
+	if got != want || hasRefs {
+		t.Errorf("fingerprint() = %+v, hasRefs %v, want %+v without refs", got, hasRefs, want)
+	}
+
+	if err := os.WriteFile(filepath.Join(path, "description"), []byte("Changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	changed, _, _, err := fingerprint(context.Background(), path)
+	if err != nil {
+		t.Fatalf("fingerprint() error = %v", err)
+	}
+	if changed == fp {
+		t.Error("fingerprint() didn't change with the description")
+	}
+}
+
+func TestReadMetaInvalid(t *testing.T) {
+	if _, err := ReadMeta(strings.NewReader("not json")); err == nil {
+		t.Error("ReadMeta() accepted invalid input")
+	}
+}
@@ -0,0 +1,129 @@
+package ssh
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/logging"
+)
+
+// listenControl opens the control socket, usable only by the server's
+// user since it can kill sessions. A directory created for it is private
+// too.
+func listenControl(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	return listenPrivate(path)
+}
+
+// serveControl answers control requests until l is closed.
+func (s *Server) serveControl(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			// Start closes the socket without shutting down if it fails
+			if s.isClosing() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Error("Failed to accept control connection", logging.KeyError, err)
+			continue
+		}
+		go s.handleControl(conn)
+	}
+}
+
+func (s *Server) handleControl(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	var req control.Request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp control.Response
+	result, err := s.dispatchControl(req)
+	if err != nil {
+		resp.Error = err.Error()
+	} else if result != nil {
+		if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = err.Error()
+		}
+	}
+	json.NewEncoder(conn).Encode(resp)
+}
+
+func (s *Server) dispatchControl(req control.Request) (any, error) {
+	switch req.Method {
+	case control.MethodStatus:
+		return s.status(), nil
+
+	case control.MethodSessions:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		sessions := []control.Session{}
+		for _, sess := range s.activeSessions() {
+			sessions = append(sessions, sess.info())
+		}
+		return sessions, nil
+
+	case control.MethodKill:
+		var params control.KillParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+		slog.Info("Killing session via control socket", "session_id", params.ID)
+		return nil, s.killSession(params.ID)
+
+	case control.MethodMaintenance:
+		var params control.MaintenanceParams
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+		s.mu.Lock()
+		s.readOnly = params.Enabled
+		s.mu.Unlock()
+		slog.Info("Maintenance mode changed via control socket", "enabled", params.Enabled)
+		return s.status(), nil
+
+	case control.MethodReload:
+		return nil, s.Reload()
+
+	case control.MethodReplication:
+		return s.replicationStatus(), nil
+
+	default:
+		return nil, fmt.Errorf("unknown method: %s", req.Method)
+	}
+}
+
+func (s *Server) status() control.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listen := make([]string, len(s.listeners))
+	for i, l := range s.listeners {
+		listen[i] = listenerAddr(l)
+	}
+	return control.Status{
+		Version:     s.Version,
+		PID:         os.Getpid(),
+		Started:     s.started,
+		Uptime:      time.Since(s.started).Round(time.Second).String(),
+		Listen:      listen,
+		ReposDir:    s.cfg.ReposDir,
+		Maintenance: s.readOnly,
+		Sessions:    len(s.sessions),
+	}
+}
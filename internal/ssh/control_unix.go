@@ -0,0 +1,20 @@
+//go:build !windows
+
+package ssh
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// listenPrivate listens on a unix socket only its owner can connect to.
+// The umask is process-wide, so it is narrowed for the bind alone; that
+// way the socket is never created with looser permissions than 0600, even
+// briefly, and files created elsewhere meanwhile are barely affected.
+func listenPrivate(path string) (net.Listener, error) {
+	old := unix.Umask(0177)
+	l, err := net.Listen("unix", path)
+	unix.Umask(old)
+	return l, err
+}
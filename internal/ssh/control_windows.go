@@ -0,0 +1,20 @@
+package ssh
+
+import (
+	"net"
+	"os"
+)
+
+// listenPrivate listens on a unix socket. Windows has no umask; access
+// follows the directory's ACL, and the mode is set for consistency.
+func listenPrivate(path string) (net.Listener, error) {
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
@@ -0,0 +1,57 @@
+package ssh
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/chris-roerig/homegit/internal/health"
+)
+
+// healthResponse is the body of /healthz and /readyz.
+type healthResponse struct {
+	Status health.Status   `json:"status"`
+	Checks []health.Result `json:"checks"`
+}
+
+// handleHealthz runs the server checks. It answers 503 if any fail.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	cfg := s.config()
+	checks := append([]health.Result{s.checkListeners()}, health.Server(cfg.ReposDir, cfg.HostKeyFiles())...)
+	writeHealth(w, checks)
+}
+
+// handleReadyz answers 200 only while the server is accepting connections.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(w, []health.Result{s.checkListeners()})
+}
+
+func (s *Server) checkListeners() health.Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case s.closing:
+		return health.Result{Name: "listener", Status: health.Fail, Detail: "server is shutting down"}
+	case len(s.listeners) == 0:
+		return health.Result{Name: "listener", Status: health.Fail, Detail: "server is not listening yet"}
+	}
+	return health.Result{Name: "listener", Status: health.OK, Detail: fmt.Sprintf("accepting on %d listener(s)", len(s.listeners))}
+}
+
+func writeHealth(w http.ResponseWriter, checks []health.Result) {
+	resp := healthResponse{Status: health.OK, Checks: checks}
+	for _, c := range checks {
+		if c.Status == health.Warn && resp.Status == health.OK {
+			resp.Status = health.Warn
+		}
+	}
+	code := http.StatusOK
+	if !health.Healthy(checks) {
+		resp.Status = health.Fail
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
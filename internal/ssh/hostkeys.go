@@ -0,0 +1,182 @@
+package ssh
+
+import (
+	"errors"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/hostkey"
+	"github.com/chris-roerig/homegit/internal/logging"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostKeyCheckInterval is how often the server looks for a key rotation
+// whose grace period is over.
+const hostKeyCheckInterval = time.Hour
+
+// hostKeys are the server's host keys. The active ones are offered in the
+// handshake; the next ones, waiting to replace them, are only announced.
+type hostKeys struct {
+	active []ssh.Signer
+	next   []ssh.Signer
+}
+
+// all returns every key the server can prove it holds.
+func (k hostKeys) all() []ssh.Signer {
+	return append(slices.Clone(k.active), k.next...)
+}
+
+// fingerprint identifies the server by the key clients pick first.
+func (k hostKeys) fingerprint() string {
+	return ssh.FingerprintSHA256(k.active[0].PublicKey())
+}
+
+func (k hostKeys) equal(other hostKeys) bool {
+	return slices.Equal(fingerprints(k.active), fingerprints(other.active)) &&
+		slices.Equal(fingerprints(k.next), fingerprints(other.next))
+}
+
+func fingerprints(signers []ssh.Signer) []string {
+	out := make([]string, len(signers))
+	for i, s := range signers {
+		out[i] = ssh.FingerprintSHA256(s.PublicKey())
+	}
+	return out
+}
+
+// loadHostKeys loads a key of each configured type, generating any that
+// are missing, after finishing rotations whose grace period is over.
+func loadHostKeys(cfg *config.Config) (hostKeys, error) {
+	grace := time.Duration(cfg.HostKeyGrace) * 24 * time.Hour
+	var keys hostKeys
+	for _, typ := range hostkey.Types {
+		if !slices.Contains(cfg.HostKeyTypes, typ) {
+			continue
+		}
+		path := cfg.HostKeyFile(typ)
+
+		retired, err := hostkey.RetireDue(path, grace)
+		if err != nil {
+			slog.Error("Failed to finish host key rotation", "path", path, logging.KeyError, err)
+		} else if retired {
+			slog.Info("Finished host key rotation", "path", path, "retired", hostkey.RetiredFile(path))
+		}
+
+		signer, generated, err := hostkey.LoadOrGenerate(path, typ)
+		if err != nil {
+			return hostKeys{}, err
+		}
+		if generated {
+			// Clients compare this with what they're offered on first connect
+			slog.Info("Generated a new host key", "path", path, "fingerprint", ssh.FingerprintSHA256(signer.PublicKey()))
+		}
+		keys.active = append(keys.active, signer)
+
+		if _, ok := hostkey.Pending(path); ok {
+			next, err := hostkey.Load(hostkey.NextFile(path))
+			if err != nil {
+				slog.Warn("Not announcing the next host key", "path", hostkey.NextFile(path), logging.KeyError, err)
+				continue
+			}
+			keys.next = append(keys.next, next)
+		}
+	}
+	if len(keys.active) == 0 {
+		return hostKeys{}, errors.New("no host key types configured")
+	}
+	return keys, nil
+}
+
+// setHostKeys makes keys the ones new connections see.
+func (s *Server) setHostKeys(keys hostKeys) {
+	sshCfg := &ssh.ServerConfig{
+		NoClientAuth: true,
+	}
+	for _, k := range keys.active {
+		sshCfg.AddHostKey(k)
+	}
+
+	s.mu.Lock()
+	s.hostKeys = keys
+	s.sshCfg = sshCfg
+	s.mu.Unlock()
+}
+
+// reloadHostKeys picks up keys added, rotated or retired since they were
+// last loaded. The current keys stay if the new ones can't be loaded.
+func (s *Server) reloadHostKeys() {
+	keys, err := loadHostKeys(s.config())
+	if err != nil {
+		slog.Error("Failed to load host keys, keeping current ones", logging.KeyError, err)
+		return
+	}
+
+	s.mu.Lock()
+	old, responder := s.hostKeys, s.responder
+	s.mu.Unlock()
+	if keys.equal(old) {
+		return
+	}
+	s.setHostKeys(keys)
+	slog.Info("Host keys changed", "active", fingerprints(keys.active), "next", fingerprints(keys.next))
+
+	if responder != nil && keys.fingerprint() != old.fingerprint() {
+		if err := responder.SetFingerprint(keys.fingerprint()); err != nil {
+			slog.Warn("Failed to advertise the new host key", logging.KeyError, err)
+		}
+	}
+}
+
+// watchHostKeys finishes rotations once their grace period is over, until
+// stop is closed.
+func (s *Server) watchHostKeys(stop <-chan struct{}) {
+	ticker := time.NewTicker(hostKeyCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.reloadHostKeys()
+		}
+	}
+}
+
+// announceHostKeys tells the client every key the server has, so OpenSSH
+// clients with UpdateHostKeys learn keys being rotated in and forget
+// retired ones.
+func announceHostKeys(conn *ssh.ServerConn, keys hostKeys) error {
+	all := keys.all()
+	pub := make([]ssh.PublicKey, len(all))
+	for i, k := range all {
+		pub[i] = k.PublicKey()
+	}
+	_, _, err := conn.SendRequest(hostkey.AnnounceRequest, false, hostkey.Announcement(pub))
+	return err
+}
+
+// handleGlobalRequests answers the client's requests outside any channel
+// until the connection closes. Only proving host keys is supported.
+func handleGlobalRequests(conn *ssh.ServerConn, reqs <-chan *ssh.Request, keys hostKeys, log *slog.Logger) {
+	for req := range reqs {
+		if req.Type != hostkey.ProveRequest {
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+			continue
+		}
+		var algo string
+		if meta, ok := conn.Conn.(ssh.AlgorithmsConnMetadata); ok {
+			algo = meta.Algorithms().HostKey
+		}
+		proof, err := hostkey.Prove(req.Payload, conn.SessionID(), keys.all(), algo)
+		if err != nil {
+			log.Warn("Failed to prove host keys", logging.KeyError, err)
+			req.Reply(false, nil)
+			continue
+		}
+		req.Reply(true, proof)
+	}
+}
@@ -0,0 +1,32 @@
+package ssh
+
+import (
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/logging"
+)
+
+// serveHTTP serves /metrics, /healthz and /readyz on addr until the
+// listener is closed.
+func (s *Server) serveHTTP(addr string) (net.Listener, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics.registry.Handler())
+	mux.HandleFunc("/healthz", s.handleHealthz)
+	mux.HandleFunc("/readyz", s.handleReadyz)
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(l); err != nil && !errors.Is(err, net.ErrClosed) {
+			slog.Error("HTTP server stopped", logging.KeyError, err)
+		}
+	}()
+	return l, nil
+}
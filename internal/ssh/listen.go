@@ -0,0 +1,83 @@
+package ssh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// listenAll opens a listener for every address. Addresses are host:port
+// pairs ("192.168.1.10:2222", "[::1]:2222", ":2222") or "unix:" followed by
+// a socket path. If any address fails, the listeners already opened are
+// closed.
+func listenAll(addrs []string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, addr := range addrs {
+		l, err := listen(addr)
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	return net.Listen("unix", path)
+}
+
+// removeStaleSocket deletes a socket file left behind by a server that
+// didn't shut down cleanly. A socket that still accepts connections is left
+// alone so the listen fails with "address already in use".
+func removeStaleSocket(path string) error {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	conn, err := net.DialTimeout("unix", path, time.Second)
+	if err == nil {
+		conn.Close()
+		return nil
+	}
+	return os.Remove(path)
+}
+
+// listenerAddr formats a listener's address the way it is written in the
+// config's listen list.
+func listenerAddr(l net.Listener) string {
+	if l.Addr().Network() == "unix" {
+		return "unix:" + l.Addr().String()
+	}
+	return l.Addr().String()
+}
+
+func writeListenFile(path string, addrs []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(strings.Join(addrs, "\n")+"\n"), 0644)
+}
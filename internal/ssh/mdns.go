@@ -0,0 +1,46 @@
+package ssh
+
+import (
+	"log/slog"
+	"net"
+
+	"github.com/chris-roerig/homegit/internal/mdns"
+)
+
+// advertise announces the server on the local network with its port,
+// version and host key fingerprint. It advertises nothing, returning nil,
+// when every listener is loopback or a Unix socket, since other computers
+// couldn't connect anyway.
+func (s *Server) advertise(listeners []net.Listener) (*mdns.Responder, error) {
+	port := 0
+	var addrs []net.IP
+	for _, l := range listeners {
+		tcp, ok := l.Addr().(*net.TCPAddr)
+		if !ok || tcp.IP.IsLoopback() || (port != 0 && tcp.Port != port) {
+			continue
+		}
+		port = tcp.Port
+		if !tcp.IP.IsUnspecified() {
+			addrs = append(addrs, tcp.IP)
+		}
+	}
+	if port == 0 {
+		slog.Debug("Not advertising with mDNS, no listener other computers can reach")
+		return nil, nil
+	}
+
+	entry := mdns.HostEntry(port)
+	if len(addrs) > 0 {
+		entry.Addrs = addrs
+	}
+	entry.Version = s.Version
+	s.mu.Lock()
+	entry.Fingerprint = s.hostKeys.fingerprint()
+	s.mu.Unlock()
+	responder, err := mdns.Advertise(entry)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Advertising on the local network", "service", mdns.Service, "name", entry.Instance, "port", port)
+	return responder, nil
+}
@@ -0,0 +1,209 @@
+package ssh
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/audit"
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/metrics"
+)
+
+// otherRepo is the repo label of operations on paths that aren't an
+// existing repository, so clients can't add a series per made-up name.
+const otherRepo = "other"
+
+// reposScanInterval is how long the repository count and disk usage are
+// reused between scrapes, since finding them walks every repository.
+const reposScanInterval = time.Minute
+
+// serverMetrics are the server's Prometheus metrics.
+type serverMetrics struct {
+	registry *metrics.Registry
+	config   func() *config.Config
+
+	scanMu  sync.Mutex
+	scanned time.Time
+
+	connections       *metrics.Counter
+	connectionsActive *metrics.Gauge
+	handshakeFailures *metrics.Counter
+	sessionsActive    *metrics.Gauge
+	operations        *metrics.Counter
+	operationDuration *metrics.Histogram
+	bytes             *metrics.Counter
+	pushRejections    *metrics.Counter
+
+	repos          *metrics.Gauge
+	reposSize      *metrics.Gauge
+	backupLast     *metrics.Gauge
+	backupAge      *metrics.Gauge
+	backupsPresent *metrics.Gauge
+}
+
+func newServerMetrics(s *Server) *serverMetrics {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: r,
+		config:   s.config,
+
+		connections:       r.NewCounter("homegit_connections_total", "SSH connections accepted."),
+		connectionsActive: r.NewGauge("homegit_connections_active", "SSH connections currently open."),
+		handshakeFailures: r.NewCounter("homegit_handshake_failures_total", "SSH connections that failed the handshake."),
+		sessionsActive:    r.NewGauge("homegit_sessions_active", "Git operations currently running."),
+		operations:        r.NewCounter("homegit_operations_total", "Git operations by type, repository and result.", "op", "repo", "result"),
+		operationDuration: r.NewHistogram("homegit_operation_duration_seconds", "Git operation duration.", metrics.DefaultBuckets, "op", "repo"),
+		bytes:             r.NewCounter("homegit_bytes_total", "Bytes transferred by git operations.", "op", "repo", "direction"),
+		pushRejections:    r.NewCounter("homegit_push_rejections_total", "Pushes refused or failed, by reason.", "reason"),
+
+		repos:          r.NewGauge("homegit_repositories", "Repositories under repos_dir."),
+		reposSize:      r.NewGauge("homegit_repositories_size_bytes", "Total disk space used by repositories."),
+		backupLast:     r.NewGauge("homegit_backup_last_success_timestamp_seconds", "Unix time of the newest backup of each repository.", "repo"),
+		backupAge:      r.NewGauge("homegit_backup_age_seconds", "Age of the newest backup of each repository.", "repo"),
+		backupsPresent: r.NewGauge("homegit_backups", "Backup archives kept for each repository.", "repo"),
+	}
+
+	// Gauges that are cheaper to compute when scraped than to keep current
+	r.OnScrape(func() {
+		s.mu.Lock()
+		m.connectionsActive.Set(float64(len(s.conns)))
+		m.sessionsActive.Set(float64(len(s.sessions)))
+		s.mu.Unlock()
+
+		cfg := s.config()
+		m.collectRepos(cfg.ReposDir)
+		m.collectBackups(cfg.BackupDir)
+	})
+	return m
+}
+
+// observe records a finished session.
+func (m *serverMetrics) observe(sess *session, result string) {
+	op, repo := sess.resolvedOperation(), m.repoLabel(sess.repo)
+	m.operations.Inc(op, repo, result)
+	m.operationDuration.Observe(time.Since(sess.started).Seconds(), op, repo)
+	m.bytes.Add(float64(sess.bytesIn.Load()), op, repo, "in")
+	m.bytes.Add(float64(sess.bytesOut.Load()), op, repo, "out")
+	switch {
+	case op != audit.OpPush:
+	case result == audit.ResultFailed:
+		m.pushRejections.Inc("error")
+	case result == audit.ResultRejected:
+		m.pushRejections.Inc("refs")
+	}
+}
+
+// refused records a session turned away before it ran.
+func (m *serverMetrics) refused(sess *session, err error) {
+	m.operations.Inc(sess.operation(), m.repoLabel(sess.repo), audit.ResultRefused)
+	if sess.typ != "receive-pack" {
+		return
+	}
+	switch {
+	case errors.Is(err, errMaintenance):
+		m.pushRejections.Inc("maintenance")
+	case errors.Is(err, errShuttingDown):
+		m.pushRejections.Inc("shutting_down")
+	case errors.Is(err, errReplica):
+		m.pushRejections.Inc("replica")
+	default:
+		m.pushRejections.Inc("error")
+	}
+}
+
+// repoLabel is the repo label for the path a client asked for: the
+// repository's path if it exists, otherwise otherRepo.
+func (m *serverMetrics) repoLabel(repo string) string {
+	reposDir := m.config().ReposDir
+	path, err := git.ResolveRepo(reposDir, repo)
+	if err != nil || !strings.HasSuffix(path, ".git") {
+		return otherRepo
+	}
+	if info, err := os.Stat(path); err != nil || !info.IsDir() {
+		return otherRepo
+	}
+	rel, err := filepath.Rel(reposDir, path)
+	if err != nil {
+		return otherRepo
+	}
+	return filepath.ToSlash(rel)
+}
+
+// collectRepos walks reposDir for bare repositories and their disk usage,
+// at most once per reposScanInterval.
+func (m *serverMetrics) collectRepos(reposDir string) {
+	m.scanMu.Lock()
+	defer m.scanMu.Unlock()
+	if time.Since(m.scanned) < reposScanInterval {
+		return
+	}
+	m.scanned = time.Now()
+
+	var count, size int64
+	filepath.WalkDir(reposDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() && strings.HasSuffix(d.Name(), ".git") && path != reposDir {
+			count++
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	m.repos.Set(float64(count))
+	m.reposSize.Set(float64(size))
+}
+
+// collectBackups reports the newest archive per repository in backupDir.
+// Archives are named <repo>-<YYYYMMDD-HHMMSS>.tar.gz by 'homegit backup'
+// and only appear once the backup has completed.
+func (m *serverMetrics) collectBackups(backupDir string) {
+	m.backupLast.Reset()
+	m.backupAge.Reset()
+	m.backupsPresent.Reset()
+
+	entries, err := os.ReadDir(backupDir)
+	if err != nil {
+		return
+	}
+	newest := make(map[string]time.Time)
+	counts := make(map[string]int)
+	for _, entry := range entries {
+		repo, taken, ok := parseBackupName(entry.Name())
+		if !ok {
+			continue
+		}
+		counts[repo]++
+		if taken.After(newest[repo]) {
+			newest[repo] = taken
+		}
+	}
+	for repo, taken := range newest {
+		m.backupLast.Set(float64(taken.Unix()), repo)
+		m.backupAge.Set(time.Since(taken).Seconds(), repo)
+		m.backupsPresent.Set(float64(counts[repo]), repo)
+	}
+}
+
+func parseBackupName(name string) (repo string, taken time.Time, ok bool) {
+	const stampLen = len("20060102-150405")
+	base, found := strings.CutSuffix(name, ".tar.gz")
+	if !found || len(base) < stampLen+2 || base[len(base)-stampLen-1] != '-' {
+		return "", time.Time{}, false
+	}
+	taken, err := time.ParseInLocation("20060102-150405", base[len(base)-stampLen:], time.Local)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	return base[:len(base)-stampLen-1] + ".git", taken, true
+}
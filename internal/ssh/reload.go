@@ -0,0 +1,169 @@
+package ssh
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/logging"
+)
+
+// configPollInterval is how often the config file is checked for changes.
+const configPollInterval = 2 * time.Second
+
+// Reload re-reads the config file. Settings that can change live apply to
+// new sessions; settings that need a restart keep their current values and
+// are logged.
+func (s *Server) Reload() error {
+	notify("RELOADING=1")
+	defer notify("READY=1")
+
+	stamp := configStamp()
+	cfg, err := config.Load()
+	if err == nil {
+		if problems := cfg.CheckDirs(); len(problems) > 0 {
+			err = &config.ValidationError{Path: config.Path(), Problems: problems}
+		}
+	}
+	if err != nil {
+		s.mu.Lock()
+		s.cfgStamp = stamp
+		s.mu.Unlock()
+		return fmt.Errorf("failed to reload config: %w", err)
+	}
+
+	s.mu.Lock()
+	old := s.cfg
+	keepRestartOnly(old, cfg)
+	s.cfg = cfg
+	s.cfgStamp = stamp
+	s.mu.Unlock()
+
+	if cfg.LogLevel != old.LogLevel || cfg.LogFormat != old.LogFormat {
+		if err := logging.SetupStderr(cfg.LogLevel, cfg.LogFormat); err != nil {
+			slog.Error("Invalid logging settings, keeping current ones", logging.KeyError, err)
+		}
+	}
+
+	changed := logConfigChanges(old, cfg)
+	slog.Info("Config reloaded", "changed", changed)
+
+	// Also picks up a rotation started with 'homegit hostkey rotate'
+	s.reloadHostKeys()
+	return nil
+}
+
+// config returns the current config. Callers should fetch it once per
+// session so a reload mid-session doesn't change settings under them.
+func (s *Server) config() *config.Config {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cfg
+}
+
+// keepRestartOnly copies settings that can't change while the server is
+// running from old into cfg, logging any that were edited.
+func keepRestartOnly(old, cfg *config.Config) {
+	if cfg.Port != old.Port {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "port", "current", old.Port, "configured", cfg.Port)
+		cfg.Port = old.Port
+	}
+	if !slices.Equal(cfg.ListenAddrs(), old.ListenAddrs()) {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "listen", "current", strings.Join(old.ListenAddrs(), ","), "configured", strings.Join(cfg.ListenAddrs(), ","))
+		cfg.Listen = old.Listen
+	}
+	if cfg.HTTPListen != old.HTTPListen {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "http_listen", "current", old.HTTPListen, "configured", cfg.HTTPListen)
+		cfg.HTTPListen = old.HTTPListen
+	}
+	if cfg.ControlSocket != old.ControlSocket {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "control_socket", "current", old.ControlSocket, "configured", cfg.ControlSocket)
+		cfg.ControlSocket = old.ControlSocket
+	}
+	if cfg.MDNS != old.MDNS {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "mdns", "current", old.MDNS, "configured", cfg.MDNS)
+		cfg.MDNS = old.MDNS
+	}
+	if cfg.PIDFile != old.PIDFile {
+		slog.Warn("Setting requires a restart, keeping current value", "setting", "pid_file", "current", old.PIDFile, "configured", cfg.PIDFile)
+		cfg.PIDFile = old.PIDFile
+	}
+}
+
+// logConfigChanges logs the live settings that differ between old and cfg
+// and returns how many there were.
+func logConfigChanges(old, cfg *config.Config) int {
+	changes := []struct {
+		name     string
+		old, new any
+	}{
+		{"repos_dir", old.ReposDir, cfg.ReposDir},
+		{"default_branch", old.DefaultBranch, cfg.DefaultBranch},
+		{"backup_dir", old.BackupDir, cfg.BackupDir},
+		{"host_key", old.HostKey, cfg.HostKey},
+		{"host_key_types", strings.Join(old.HostKeyTypes, ","), strings.Join(cfg.HostKeyTypes, ",")},
+		{"host_key_grace", old.HostKeyGrace, cfg.HostKeyGrace},
+		{"shutdown_timeout", old.ShutdownTimeout, cfg.ShutdownTimeout},
+		{"log_level", old.LogLevel, cfg.LogLevel},
+		{"log_format", old.LogFormat, cfg.LogFormat},
+		{"audit_log", old.AuditLog, cfg.AuditLog},
+		{"replicas", strings.Join(old.Replicas, ","), strings.Join(cfg.Replicas, ",")},
+		{"replica_of", old.ReplicaOf, cfg.ReplicaOf},
+		{"replication_interval", old.ReplicationInterval, cfg.ReplicationInterval},
+	}
+
+	n := 0
+	for _, c := range changes {
+		if c.old != c.new {
+			slog.Info("Setting changed", "setting", c.name, "old", c.old, "new", c.new)
+			n++
+		}
+	}
+	return n
+}
+
+// configStamp identifies the current version of the config file by its
+// modification time and size. It is empty if the file can't be read.
+func configStamp() string {
+	info, err := os.Stat(config.Path())
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", info.ModTime().UnixNano(), info.Size())
+}
+
+// watchConfig reloads the config whenever the file changes since it was
+// last loaded, until stop is closed.
+func (s *Server) watchConfig(stop <-chan struct{}) {
+	s.mu.Lock()
+	s.cfgStamp = configStamp()
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		stamp := configStamp()
+		s.mu.Lock()
+		unchanged := stamp == s.cfgStamp
+		s.mu.Unlock()
+		// A missing file is usually an editor mid-save; wait for it to return
+		if stamp == "" || unchanged {
+			continue
+		}
+
+		if err := s.Reload(); err != nil {
+			slog.Error("Reload failed", logging.KeyError, err)
+		}
+	}
+}
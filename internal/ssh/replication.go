@@ -0,0 +1,125 @@
+package ssh
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/logging"
+	"github.com/chris-roerig/homegit/internal/replication"
+	"golang.org/x/crypto/ssh"
+)
+
+var errNotPrimary = errors.New("replication commands are only accepted from this replica's primary")
+
+func isReplicaCommand(cmdStr string) bool {
+	name, _, _ := strings.Cut(cmdStr, " ")
+	return name == replication.MetaCommand || name == replication.DeleteCommand
+}
+
+// fromPrimary reports whether secret, sent by a client as
+// replication.SecretEnv, is this replica's replication secret.
+func (s *Server) fromPrimary(secret string) bool {
+	cfg := s.config()
+	return cfg.ReplicaOf != "" && cfg.ReplicationSecret != "" &&
+		subtle.ConstantTimeCompare([]byte(secret), []byte(cfg.ReplicationSecret)) == 1
+}
+
+// handleReplicaCommand runs a replication.MetaCommand or DeleteCommand
+// from the primary.
+func (s *Server) handleReplicaCommand(channel ssh.Channel, cmdStr string, fromPrimary bool, log *slog.Logger) {
+	name, arg, _ := strings.Cut(cmdStr, " ")
+	repo := strings.TrimPrefix(strings.Trim(strings.TrimSpace(arg), "'\""), "/")
+	log = log.With(logging.KeyRepo, repo)
+	fail := func(err error) {
+		log.Warn("Refused replication command", "command", name, logging.KeyError, err)
+		fmt.Fprintf(channel.Stderr(), "Error: %v\n", err)
+		channel.SendRequest("exit-status", false, []byte{0, 0, 0, 1})
+	}
+
+	if !fromPrimary {
+		fail(errNotPrimary)
+		return
+	}
+	path, err := git.ResolveRepo(s.config().ReposDir, repo)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if !strings.HasSuffix(repo, ".git") {
+		fail(fmt.Errorf("not a repository: %s", repo))
+		return
+	}
+
+	switch name {
+	case replication.MetaCommand:
+		meta, err := replication.ReadMeta(channel)
+		if err == nil {
+			err = replication.ApplyMeta(path, meta)
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+	case replication.DeleteCommand:
+		if err := os.RemoveAll(path); err != nil {
+			fail(fmt.Errorf("failed to delete repository: %w", err))
+			return
+		}
+		log.Info("Deleted repository, as the primary no longer has it")
+	}
+
+	s.mu.Lock()
+	if name == replication.DeleteCommand {
+		delete(s.received, repo)
+	} else {
+		s.received[repo] = time.Now()
+	}
+	s.mu.Unlock()
+	s.replicator.Notify(repo)
+	channel.SendRequest("exit-status", false, []byte{0, 0, 0, 0})
+}
+
+// pushed passes a successful push on to this server's own replicas and,
+// on a replica, records the update from the primary.
+func (s *Server) pushed(sess *session) {
+	repo := sess.repo
+	if !strings.HasSuffix(repo, ".git") {
+		repo += ".git"
+	}
+	if sess.fromPrimary {
+		s.mu.Lock()
+		s.received[repo] = time.Now()
+		s.mu.Unlock()
+	}
+	s.replicator.Notify(repo)
+}
+
+func (s *Server) replicationStatus() control.ReplicationStatus {
+	cfg := s.config()
+	status := control.ReplicationStatus{Role: control.RoleStandalone, Interval: cfg.ReplicationInterval}
+	if len(cfg.Replicas) > 0 {
+		status.Role = control.RolePrimary
+		status.Replicas = s.replicator.Status(cfg)
+	}
+	if cfg.ReplicaOf != "" {
+		status.Role = control.RoleReplica
+		status.Primary = cfg.ReplicaOf
+
+		s.mu.Lock()
+		status.Received = []control.ReplicatedRepo{}
+		for repo, t := range s.received {
+			status.Received = append(status.Received, control.ReplicatedRepo{Repo: repo, Synced: t})
+		}
+		s.mu.Unlock()
+		sort.Slice(status.Received, func(i, j int) bool { return status.Received[i].Repo < status.Received[j].Repo })
+	}
+	return status
+}
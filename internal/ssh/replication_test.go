@@ -0,0 +1,138 @@
+package ssh
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/replication"
+)
+
+// testServer returns a server for cfg that isn't listening.
+func testServer(cfg *config.Config) *Server {
+	s := &Server{
+		cfg:      cfg,
+		sessions: make(map[*session]struct{}),
+		received: make(map[string]time.Time),
+	}
+	s.replicator = replication.New(s.config)
+	return s
+}
+
+func replicaConfig(t *testing.T) *config.Config {
+	cfg := config.Default()
+	cfg.ReposDir = t.TempDir()
+	cfg.ReplicaOf = "primary.lan:2222"
+	cfg.ReplicationSecret = "s3cret"
+	return cfg
+}
+
+// fakeChannel is an ssh.Channel that reads stdin and records what the
+// server sends back.
+type fakeChannel struct {
+	stdin  io.Reader
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	status []byte
+}
+
+func (c *fakeChannel) Read(p []byte) (int, error)  { return c.stdin.Read(p) }
+func (c *fakeChannel) Write(p []byte) (int, error) { return c.stdout.Write(p) }
+func (c *fakeChannel) Close() error                { return nil }
+func (c *fakeChannel) CloseWrite() error           { return nil }
+func (c *fakeChannel) Stderr() io.ReadWriter       { return &c.stderr }
+
+func (c *fakeChannel) SendRequest(name string, wantReply bool, payload []byte) (bool, error) {
+	if name == "exit-status" {
+		c.status = payload
+	}
+	return true, nil
+}
+
+func TestFromPrimary(t *testing.T) {
+	tests := []struct {
+		name      string
+		replicaOf string
+		secret    string
+		sent      string
+		want      bool
+	}{
+		{"matching secret", "primary.lan:2222", "s3cret", "s3cret", true},
+		{"wrong secret", "primary.lan:2222", "s3cret", "guess", false},
+		{"no secret sent", "primary.lan:2222", "s3cret", "", false},
+		{"no secret configured", "primary.lan:2222", "", "", false},
+		{"not a replica", "", "s3cret", "s3cret", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.Default()
+			cfg.ReplicaOf, cfg.ReplicationSecret = tt.replicaOf, tt.secret
+			if got := testServer(cfg).fromPrimary(tt.sent); got != tt.want {
+				t.Errorf("fromPrimary(%q) = %v, want %v", tt.sent, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleReplicaCommandRefusesWithoutSecret(t *testing.T) {
+	cfg := replicaConfig(t)
+	s := testServer(cfg)
+	repo := filepath.Join(cfg.ReposDir, "app.git")
+	if err := os.MkdirAll(repo, 0755); err != nil {
+		t.Fatal(err)
+	}
+	log := slog.New(slog.DiscardHandler)
+
+	for _, command := range []string{replication.DeleteCommand, replication.MetaCommand} {
+		ch := &fakeChannel{stdin: strings.NewReader(`{"head":"refs/heads/main"}`)}
+		s.handleReplicaCommand(ch, command+" 'app.git'", s.fromPrimary("guess"), log)
+		if !bytes.Equal(ch.status, []byte{0, 0, 0, 1}) {
+			t.Errorf("%s: exit status = %v, want 1", command, ch.status)
+		}
+		if !strings.Contains(ch.stderr.String(), errNotPrimary.Error()) {
+			t.Errorf("%s: stderr = %q, want %q", command, ch.stderr.String(), errNotPrimary)
+		}
+	}
+	if _, err := os.Stat(repo); err != nil {
+		t.Errorf("Repository removed without the secret: %v", err)
+	}
+	if len(s.received) != 0 {
+		t.Errorf("Recorded updates without the secret: %v", s.received)
+	}
+
+	ch := &fakeChannel{stdin: strings.NewReader("")}
+	s.handleReplicaCommand(ch, replication.DeleteCommand+" 'app.git'", s.fromPrimary("s3cret"), log)
+	if !bytes.Equal(ch.status, []byte{0, 0, 0, 0}) {
+		t.Errorf("Exit status with the secret = %v, want 0 (stderr %q)", ch.status, ch.stderr.String())
+	}
+	if _, err := os.Stat(repo); !os.IsNotExist(err) {
+		t.Errorf("Repository not removed with the secret: %v", err)
+	}
+}
+
+func TestReplicaRefusesDirectPush(t *testing.T) {
+	s := testServer(replicaConfig(t))
+
+	push := &session{typ: "receive-pack", repo: "app.git"}
+	if err := s.startSession(push); !errors.Is(err, errReplica) {
+		t.Errorf("startSession(push) error = %v, want %v", err, errReplica)
+	}
+
+	for _, sess := range []*session{
+		{typ: "upload-pack", repo: "app.git"},
+		{typ: "receive-pack", repo: "app.git", fromPrimary: true},
+	} {
+		if err := s.startSession(sess); err != nil {
+			t.Errorf("startSession(%s, fromPrimary %v) error = %v", sess.typ, sess.fromPrimary, err)
+			continue
+		}
+		s.finishSession(sess)
+	}
+}
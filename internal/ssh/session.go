@@ -0,0 +1,246 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os/exec"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/chris-roerig/homegit/internal/audit"
+	"github.com/chris-roerig/homegit/internal/control"
+	"github.com/chris-roerig/homegit/internal/git"
+	"github.com/chris-roerig/homegit/internal/logging"
+	"github.com/chris-roerig/homegit/internal/logrotate"
+)
+
+var (
+	errShuttingDown = errors.New("server is shutting down, try again shortly")
+	errMaintenance  = errors.New("server is in maintenance mode, pushes are disabled")
+	errReplica      = errors.New("server is a read-only replica")
+)
+
+// session is a git command currently running on behalf of a client.
+type session struct {
+	id      uint64
+	repo    string
+	typ     string
+	remote  string
+	user    string
+	started time.Time
+	stderr  io.Writer
+	cancel  context.CancelFunc
+	conn    net.Conn
+	log     *slog.Logger
+
+	bytesIn  atomic.Int64
+	bytesOut atomic.Int64
+
+	// request is what the client asked for, filled in as its input is read
+	request git.Request
+	// report is what receive-pack told the client about each ref update
+	report git.Report
+
+	// fromPrimary is set when the client proved it is this replica's primary
+	fromPrimary bool
+}
+
+func (sess *session) operation() string {
+	switch sess.typ {
+	case "receive-pack":
+		return audit.OpPush
+	case "upload-archive":
+		return audit.OpArchive
+	}
+	return audit.OpFetch
+}
+
+// resolvedOperation is operation refined by what the client asked for,
+// which tells a clone apart from a fetch once the session has run.
+func (sess *session) resolvedOperation() string {
+	op := sess.operation()
+	if op == audit.OpFetch && sess.request.IsClone() {
+		return audit.OpClone
+	}
+	return op
+}
+
+// attrs returns the log fields describing the session so far.
+func (sess *session) attrs() []any {
+	return []any{
+		logging.KeyRepo, sess.repo,
+		logging.KeyOp, sess.operation(),
+		logging.KeyDuration, time.Since(sess.started).Round(time.Millisecond).String(),
+		logging.KeyBytes, sess.bytesIn.Load() + sess.bytesOut.Load(),
+	}
+}
+
+// logResult records how the session's git command ended.
+func (sess *session) logResult(err error) {
+	exitCode := 0
+	if err != nil {
+		exitCode = -1
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			exitCode = exitErr.ExitCode()
+		}
+	}
+	attrs := append(sess.attrs(), logging.KeyExitCode, exitCode)
+	if err != nil {
+		sess.log.Warn("Operation failed", append(attrs, logging.KeyError, err)...)
+		return
+	}
+	sess.log.Info("Operation finished", attrs...)
+}
+
+// recordAudit appends the session's outcome to the audit log.
+func (s *Server) recordAudit(sess *session, result string, err error) {
+	path := s.config().AuditLog
+	if path == "" {
+		return
+	}
+
+	rec := audit.Record{
+		Time:       sess.started,
+		RemoteAddr: sess.remote,
+		SSHUser:    sess.user,
+		Repo:       sess.repo,
+		Operation:  sess.resolvedOperation(),
+		Refs:       sess.report.Apply(sess.request.RefUpdates()),
+		Result:     result,
+		BytesIn:    sess.bytesIn.Load(),
+		BytesOut:   sess.bytesOut.Load(),
+		DurationMS: time.Since(sess.started).Milliseconds(),
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if err := audit.Append(path, logrotate.ConfigPolicy(s.config()), rec); err != nil {
+		sess.log.Error("Failed to write audit log", "path", path, logging.KeyError, err)
+	}
+}
+
+func (sess *session) info() control.Session {
+	return control.Session{
+		ID:         sess.id,
+		RemoteAddr: sess.remote,
+		User:       sess.user,
+		Repo:       sess.repo,
+		Operation:  sess.operation(),
+		BytesIn:    sess.bytesIn.Load(),
+		BytesOut:   sess.bytesOut.Load(),
+		Started:    sess.started,
+		Duration:   time.Since(sess.started).Round(time.Second).String(),
+	}
+}
+
+// startSession registers a session, refusing it if the server is shutting
+// down, or a push arrives during maintenance or on a replica from anyone
+// but its primary.
+func (s *Server) startSession(sess *session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return errShuttingDown
+	}
+	if s.readOnly && sess.typ == "receive-pack" {
+		return errMaintenance
+	}
+	if s.cfg.ReplicaOf != "" && sess.typ == "receive-pack" && !sess.fromPrimary {
+		return fmt.Errorf("%w, push to its primary %s instead", errReplica, s.cfg.ReplicaOf)
+	}
+	s.nextID++
+	sess.id = s.nextID
+	s.sessions[sess] = struct{}{}
+	s.opsWg.Add(1)
+	return nil
+}
+
+func (s *Server) finishSession(sess *session) {
+	s.mu.Lock()
+	delete(s.sessions, sess)
+	s.mu.Unlock()
+	s.opsWg.Done()
+}
+
+// killNoticeTimeout bounds how long killSession waits to tell the client
+// before dropping its connection.
+const killNoticeTimeout = 2 * time.Second
+
+// killSession cancels a session's git command and drops its connection.
+func (s *Server) killSession(id uint64) error {
+	s.mu.Lock()
+	var found *session
+	for sess := range s.sessions {
+		if sess.id == id {
+			found = sess
+			break
+		}
+	}
+	s.mu.Unlock()
+	if found == nil {
+		return fmt.Errorf("no session with ID %d", id)
+	}
+
+	found.cancel()
+	// A client that stopped reading can't hold up the kill or the server
+	go func() {
+		written := make(chan struct{})
+		go func() {
+			fmt.Fprintf(found.stderr, "homegit: session terminated by the server administrator\n")
+			close(written)
+		}()
+		select {
+		case <-written:
+		case <-time.After(killNoticeTimeout):
+		}
+		found.conn.Close()
+	}()
+	return nil
+}
+
+// activeSessions returns the running sessions, oldest first. s.mu must be held.
+func (s *Server) activeSessions() []*session {
+	sessions := make([]*session, 0, len(s.sessions))
+	for sess := range s.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].started.Before(sessions[j].started) })
+	return sessions
+}
+
+// busyConns returns the connections with a session in flight. s.mu must be held.
+func (s *Server) busyConns() map[net.Conn]struct{} {
+	busy := make(map[net.Conn]struct{})
+	for sess := range s.sessions {
+		busy[sess.conn] = struct{}{}
+	}
+	return busy
+}
+
+type countingReader struct {
+	r io.Reader
+	n *atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n.Add(int64(n))
+	return n, err
+}
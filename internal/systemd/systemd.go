@@ -0,0 +1,71 @@
+// Package systemd implements the parts of the systemd service protocol
+// homegit uses: socket activation and readiness notification.
+package systemd
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// Listeners returns the sockets passed in by systemd socket activation, or
+// nil if the process wasn't socket activated. The LISTEN_* variables are
+// cleared so child processes don't mistake the sockets for their own.
+func Listeners() ([]net.Listener, error) {
+	defer os.Unsetenv("LISTEN_PID")
+	defer os.Unsetenv("LISTEN_FDS")
+	defer os.Unsetenv("LISTEN_FDNAMES")
+
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil, nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil, nil
+	}
+
+	listeners := make([]net.Listener, 0, n)
+	for fd := listenFDsStart; fd < listenFDsStart+n; fd++ {
+		f := os.NewFile(uintptr(fd), "LISTEN_FD_"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		// FileListener dups the descriptor, so the original can go
+		f.Close()
+		if err != nil {
+			for _, opened := range listeners {
+				opened.Close()
+			}
+			return nil, fmt.Errorf("inherited fd %d is not a listening socket: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// Notify sends a status update such as "READY=1" to the service manager.
+// It does nothing when the process isn't running under systemd.
+func Notify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// Abstract namespace sockets are written with a leading '@'
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("failed to notify systemd: %w", err)
+	}
+	return nil
+}
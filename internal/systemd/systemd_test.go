@@ -0,0 +1,78 @@
+package systemd
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNotify(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", path)
+	if err := Notify("READY=1"); err != nil {
+		t.Fatalf("Notify failed: %v", err)
+	}
+
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Failed to read notification: %v", err)
+	}
+	if got := string(buf[:n]); got != "READY=1" {
+		t.Errorf("Expected READY=1, got %q", got)
+	}
+}
+
+func TestNotifyWithoutSystemd(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := Notify("READY=1"); err != nil {
+		t.Errorf("Expected no error outside systemd, got %v", err)
+	}
+}
+
+func TestSocketUnit(t *testing.T) {
+	u := &Unit{ListenAddrs: []string{":2222", "192.168.1.10:2222", "[::1]:2222", "unix:/run/homegit.sock"}}
+	socket := u.Socket()
+
+	for _, want := range []string{
+		"ListenStream=2222\n",
+		"ListenStream=192.168.1.10:2222\n",
+		"ListenStream=[::1]:2222\n",
+		"ListenStream=/run/homegit.sock\n",
+	} {
+		if !strings.Contains(socket, want) {
+			t.Errorf("Socket unit missing %q:\n%s", want, socket)
+		}
+	}
+}
+
+func TestServiceUnitQuoting(t *testing.T) {
+	u := &Unit{
+		Exe:    "/home/pat/My Apps/homegit",
+		Home:   "/home/pat",
+		Config: `/home/pat/100% "odd"/config`,
+	}
+	service := u.Service()
+
+	for _, want := range []string{
+		"ExecStart=\"/home/pat/My Apps/homegit\" serve\n",
+		"Environment=\"HOME=/home/pat\"\n",
+		`Environment="HOMEGIT_CONFIG=/home/pat/100%% \"odd\"/config"` + "\n",
+	} {
+		if !strings.Contains(service, want) {
+			t.Errorf("Service unit missing %q:\n%s", want, service)
+		}
+	}
+
+	u.Exe = "/opt/$pkg/homegit"
+	if service := u.Service(); !strings.Contains(service, `ExecStart="/opt/$$pkg/homegit" serve`) {
+		t.Errorf("Expected $ escaped in ExecStart:\n%s", service)
+	}
+}
@@ -0,0 +1,160 @@
+package systemd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	ServiceName = "homegit.service"
+	SocketName  = "homegit.socket"
+)
+
+// Unit describes the homegit service and socket units to install.
+type Unit struct {
+	Exe          string   // homegit binary to run
+	Home         string   // HOME for the service
+	Config       string   // config file, passed as HOMEGIT_CONFIG
+	User         string   // account to run as; system units only
+	ListenAddrs  []string // addresses from the config's listen list
+	StopTimeout  int      // seconds systemd waits for a graceful stop
+	UserInstance bool     // install under the user's systemd instance
+}
+
+// UnitDir returns where unit files live for a system or user install.
+func UnitDir(user bool) string {
+	if user {
+		if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+			return filepath.Join(dir, "systemd", "user")
+		}
+		home, _ := os.UserHomeDir()
+		return filepath.Join(home, ".config", "systemd", "user")
+	}
+	return "/etc/systemd/system"
+}
+
+// Service renders the homegit.service unit.
+func (u *Unit) Service() string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=homegit Git server\n")
+	b.WriteString("After=network.target\n")
+	fmt.Fprintf(&b, "Requires=%s\n", SocketName)
+	b.WriteString("\n[Service]\n")
+	b.WriteString("Type=notify\n")
+	// ExecStart expands $VARS, Environment doesn't
+	fmt.Fprintf(&b, "ExecStart=%s serve\n", strings.ReplaceAll(quote(u.Exe), "$", "$$"))
+	b.WriteString("ExecReload=/bin/kill -HUP $MAINPID\n")
+	fmt.Fprintf(&b, "Environment=%s\n", quote("HOME="+u.Home))
+	if u.Config != "" {
+		fmt.Fprintf(&b, "Environment=%s\n", quote("HOMEGIT_CONFIG="+u.Config))
+	}
+	if !u.UserInstance && u.User != "" {
+		fmt.Fprintf(&b, "User=%s\n", u.User)
+	}
+	// homegit drains in-flight operations itself; give it time to do so
+	fmt.Fprintf(&b, "TimeoutStopSec=%d\n", u.StopTimeout+10)
+	b.WriteString("Restart=on-failure\n")
+	b.WriteString("\n[Install]\n")
+	if u.UserInstance {
+		b.WriteString("WantedBy=default.target\n")
+	} else {
+		b.WriteString("WantedBy=multi-user.target\n")
+	}
+	return b.String()
+}
+
+// Socket renders the homegit.socket unit.
+func (u *Unit) Socket() string {
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	b.WriteString("Description=homegit Git server socket\n")
+	b.WriteString("\n[Socket]\n")
+	for _, addr := range u.ListenAddrs {
+		fmt.Fprintf(&b, "ListenStream=%s\n", listenStream(addr))
+	}
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=sockets.target\n")
+	return b.String()
+}
+
+// quote makes s a single word of a unit setting, per systemd.syntax(7):
+// double-quoted, with backslashes and quotes escaped and % doubled so it
+// isn't taken for a specifier.
+func quote(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%").Replace(s)
+	return `"` + s + `"`
+}
+
+// listenStream converts a homegit listen address to systemd's syntax. A
+// bare ":port" becomes just the port, which systemd binds on all
+// interfaces for both IPv4 and IPv6.
+func listenStream(addr string) string {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		return path
+	}
+	if port, ok := strings.CutPrefix(addr, ":"); ok {
+		return port
+	}
+	return addr
+}
+
+// Install writes the unit files and enables the socket.
+func (u *Unit) Install() error {
+	dir := UnitDir(u.UserInstance)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ServiceName), []byte(u.Service()), 0644); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, SocketName), []byte(u.Socket()), 0644); err != nil {
+		return err
+	}
+
+	if err := Systemctl(u.UserInstance, "daemon-reload"); err != nil {
+		return err
+	}
+	return Systemctl(u.UserInstance, "enable", "--now", SocketName)
+}
+
+// Uninstall stops and disables the units and removes their files.
+func Uninstall(user bool) error {
+	// Stopping fails harmlessly if the units were never started
+	Systemctl(user, "disable", "--now", SocketName, ServiceName)
+
+	dir := UnitDir(user)
+	for _, name := range []string{ServiceName, SocketName} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return Systemctl(user, "daemon-reload")
+}
+
+// Installed reports whether homegit units are installed, checking the user
+// instance first.
+func Installed() (installed, user bool) {
+	for _, user := range []bool{true, false} {
+		if _, err := os.Stat(filepath.Join(UnitDir(user), ServiceName)); err == nil {
+			return true, user
+		}
+	}
+	return false, false
+}
+
+// Systemctl runs systemctl against the system or user instance.
+func Systemctl(user bool, args ...string) error {
+	if user {
+		args = append([]string{"--user"}, args...)
+	}
+	cmd := exec.Command("systemctl", args...)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("systemctl %s: %w", strings.Join(args, " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,228 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// List is a scrolling list of items narrowed by a filter. It holds no
+// terminal state, so the same list drives Select and 'homegit ui'.
+type List struct {
+	items   []string
+	filter  string
+	visible []int // indexes into items that match the filter
+	cursor  int   // index into visible
+	offset  int   // first visible row shown
+}
+
+// NewList returns a list of items with the first one selected.
+func NewList(items []string) *List {
+	l := &List{}
+	l.SetItems(items)
+	return l
+}
+
+// SetItems replaces the items, keeping the filter and, if it's still
+// there, the selected item.
+func (l *List) SetItems(items []string) {
+	selected, _ := l.Selected()
+	l.items = items
+	l.apply()
+	l.Select(selected)
+}
+
+// Select selects item if it matches the filter, reporting whether it
+// does.
+func (l *List) Select(item string) bool {
+	for i, idx := range l.visible {
+		if l.items[idx] == item {
+			l.cursor = i
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns the current filter.
+func (l *List) Filter() string {
+	return l.filter
+}
+
+// SetFilter shows only items containing filter, ignoring case.
+func (l *List) SetFilter(filter string) {
+	l.filter = filter
+	l.apply()
+}
+
+func (l *List) apply() {
+	l.visible = l.visible[:0]
+	needle := strings.ToLower(l.filter)
+	for i, item := range l.items {
+		if strings.Contains(strings.ToLower(item), needle) {
+			l.visible = append(l.visible, i)
+		}
+	}
+	l.cursor = min(l.cursor, max(len(l.visible)-1, 0))
+}
+
+// Len returns how many items match the filter.
+func (l *List) Len() int {
+	return len(l.visible)
+}
+
+// Move moves the selection by delta rows, stopping at either end.
+func (l *List) Move(delta int) {
+	l.cursor = min(max(l.cursor+delta, 0), max(len(l.visible)-1, 0))
+}
+
+// Selected returns the selected item, or false if nothing matches.
+func (l *List) Selected() (string, bool) {
+	if len(l.visible) == 0 {
+		return "", false
+	}
+	return l.items[l.visible[l.cursor]], true
+}
+
+// Index returns the selected item's index in the full list.
+func (l *List) Index() (int, bool) {
+	if len(l.visible) == 0 {
+		return 0, false
+	}
+	return l.visible[l.cursor], true
+}
+
+// HandleKey moves the selection for navigation keys and edits the filter
+// for printable ones, reporting whether it used the key. page is the
+// number of rows a page key moves.
+func (l *List) HandleKey(key Key, page int) bool {
+	switch key.Name {
+	case KeyUp:
+		l.Move(-1)
+	case KeyDown, KeyTab:
+		l.Move(1)
+	case KeyPageUp:
+		l.Move(-page)
+	case KeyPageDown:
+		l.Move(page)
+	case KeyHome:
+		l.Move(-len(l.visible))
+	case KeyEnd:
+		l.Move(len(l.visible))
+	case KeyBackspace:
+		if l.filter == "" {
+			return false
+		}
+		f := []rune(l.filter)
+		l.SetFilter(string(f[:len(f)-1]))
+	case KeyCtrlU:
+		l.SetFilter("")
+	case "":
+		l.SetFilter(l.filter + string(key.Rune))
+	default:
+		return false
+	}
+	return true
+}
+
+// Render returns height rows of width columns, scrolled so the selection
+// shows, with the selected row highlighted when focused.
+func (l *List) Render(width, height int, focused bool) []string {
+	if l.cursor < l.offset {
+		l.offset = l.cursor
+	}
+	if l.cursor >= l.offset+height {
+		l.offset = l.cursor - height + 1
+	}
+	l.offset = max(min(l.offset, len(l.visible)-height), 0)
+
+	rows := make([]string, 0, height)
+	for i := l.offset; i < len(l.visible) && len(rows) < height; i++ {
+		row := Fit(" "+l.items[l.visible[i]], width)
+		if i == l.cursor {
+			if focused {
+				row = Reverse(row)
+			} else {
+				row = Bold(row)
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(l.visible) == 0 {
+		rows = append(rows, Dim(Fit(" (no matches)", width)))
+	}
+	for len(rows) < height {
+		rows = append(rows, strings.Repeat(" ", width))
+	}
+	return rows
+}
+
+// Select asks the user to pick one of items and returns its index, or
+// ErrCancelled. On a terminal the list can be filtered by typing; when
+// stdin or stdout isn't one, it falls back to a numbered menu read from
+// stdin.
+func Select(title string, items []string) (int, error) {
+	if !IsTerminal() {
+		return selectNumbered(os.Stdin, os.Stdout, title, items)
+	}
+	s, err := Open()
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	l := NewList(items)
+	for {
+		width, height := s.Size()
+		lines := []string{
+			Bold(title),
+			"Filter: " + l.Filter() + "█",
+			"",
+		}
+		lines = append(lines, l.Render(width, height-len(lines)-2, true)...)
+		lines = append(lines, "", Dim(fmt.Sprintf("%d of %d  ↑↓ move  type to filter  enter select  esc cancel", l.Len(), len(items))))
+		s.Draw(lines)
+
+		key, err := s.ReadKey()
+		if err != nil {
+			return 0, err
+		}
+		switch key.Name {
+		case KeyEnter:
+			if i, ok := l.Index(); ok {
+				return i, nil
+			}
+		case KeyEscape, KeyCtrlC:
+			return 0, ErrCancelled
+		default:
+			l.HandleKey(key, height-5)
+		}
+	}
+}
+
+// selectNumbered is Select without a terminal: items are numbered and
+// the choice is read as a line.
+func selectNumbered(in io.Reader, out io.Writer, title string, items []string) (int, error) {
+	fmt.Fprintln(out, title)
+	for i, item := range items {
+		fmt.Fprintf(out, "  %d) %s\n", i+1, item)
+	}
+	fmt.Fprintf(out, "  0) Cancel\n\n")
+	fmt.Fprint(out, "Enter number: ")
+
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && line == "" {
+		return 0, fmt.Errorf("failed to read input: %w", err)
+	}
+	choice, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || choice < 0 || choice > len(items) {
+		return 0, fmt.Errorf("invalid selection")
+	}
+	if choice == 0 {
+		return 0, ErrCancelled
+	}
+	return choice - 1, nil
+}
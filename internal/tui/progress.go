@@ -0,0 +1,83 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Progress reports jobs running in parallel. Each finished job prints a
+// line; on a terminal, a status line below them shows the count and the
+// jobs still running. It is safe for concurrent use.
+type Progress struct {
+	mu      sync.Mutex
+	out     io.Writer
+	live    bool
+	verb    string
+	total   int
+	done    int
+	running []string
+}
+
+// NewProgress starts reporting total jobs on stdout, described by verb,
+// e.g. "Syncing".
+func NewProgress(verb string, total int) *Progress {
+	return &Progress{out: os.Stdout, live: term.IsTerminal(int(os.Stdout.Fd())), verb: verb, total: total}
+}
+
+// Start marks the job called name as running.
+func (p *Progress) Start(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running = append(p.running, name)
+	p.redraw()
+}
+
+// Done marks the job called name as finished and prints line for it,
+// if it isn't empty.
+func (p *Progress) Done(name, line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, running := range p.running {
+		if running == name {
+			p.running = append(p.running[:i], p.running[i+1:]...)
+			break
+		}
+	}
+	p.done++
+	p.clear()
+	if line != "" {
+		fmt.Fprintln(p.out, line)
+	}
+	p.redraw()
+}
+
+// Finish removes the status line.
+func (p *Progress) Finish() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+}
+
+func (p *Progress) clear() {
+	if p.live {
+		io.WriteString(p.out, "\r\x1b[K")
+	}
+}
+
+func (p *Progress) redraw() {
+	if !p.live || p.done == p.total {
+		return
+	}
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 {
+		width = 80
+	}
+	status := fmt.Sprintf("%s %d/%d: %s", p.verb, p.done, p.total, strings.Join(p.running, ", "))
+	p.clear()
+	io.WriteString(p.out, strings.TrimRight(Fit(status, width-1), " "))
+}
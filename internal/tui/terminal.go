@@ -0,0 +1,234 @@
+// Package tui draws homegit's full-screen terminal views: a filterable
+// list that commands use to pick a repository, and the screen and key
+// handling 'homegit ui' is built on. It speaks plain ANSI escape codes.
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// ErrCancelled is returned when the user backs out of a selection.
+var ErrCancelled = errors.New("cancelled")
+
+// IsTerminal reports whether stdin and stdout are both terminals, which
+// the full-screen views need.
+func IsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// Screen is the terminal switched to raw mode and the alternate screen,
+// so the shell's contents come back when it's closed.
+type Screen struct {
+	in    *os.File
+	out   *os.File
+	state *term.State
+	buf   []byte
+}
+
+// Open takes over the terminal. Close must be called to give it back.
+func Open() (*Screen, error) {
+	if !IsTerminal() {
+		return nil, errors.New("not a terminal")
+	}
+	s := &Screen{in: os.Stdin, out: os.Stdout}
+	if err := s.Resume(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Resume enters raw mode and the alternate screen again after Suspend.
+func (s *Screen) Resume() error {
+	state, err := term.MakeRaw(int(s.in.Fd()))
+	if err != nil {
+		return fmt.Errorf("failed to set up terminal: %w", err)
+	}
+	s.state = state
+	io.WriteString(s.out, "\x1b[?1049h\x1b[?25l")
+	return nil
+}
+
+// Suspend restores the terminal, e.g. to run a command that prints to it.
+func (s *Screen) Suspend() {
+	if s.state == nil {
+		return
+	}
+	io.WriteString(s.out, "\x1b[?25h\x1b[?1049l")
+	term.Restore(int(s.in.Fd()), s.state)
+	s.state = nil
+}
+
+// Close gives the terminal back as it was.
+func (s *Screen) Close() {
+	s.Suspend()
+}
+
+// Size returns the terminal's width and height, with a fallback for
+// terminals that don't report one.
+func (s *Screen) Size() (width, height int) {
+	width, height, err := term.GetSize(int(s.out.Fd()))
+	if err != nil || width <= 0 || height <= 0 {
+		return 80, 24
+	}
+	return width, height
+}
+
+// Draw replaces the screen with lines, each cut or padded to width.
+func (s *Screen) Draw(lines []string) {
+	width, height := s.Size()
+	var b strings.Builder
+	b.WriteString("\x1b[H")
+	for i := 0; i < height; i++ {
+		line := ""
+		if i < len(lines) {
+			line = lines[i]
+		}
+		b.WriteString(Fit(line, width))
+		if i < height-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	io.WriteString(s.out, b.String())
+}
+
+// Key is one key press: a rune, or one of the named keys below.
+type Key struct {
+	Rune rune
+	Name string
+}
+
+// Names of the special keys.
+const (
+	KeyUp        = "up"
+	KeyDown      = "down"
+	KeyPageUp    = "pgup"
+	KeyPageDown  = "pgdn"
+	KeyHome      = "home"
+	KeyEnd       = "end"
+	KeyEnter     = "enter"
+	KeyEscape    = "esc"
+	KeyBackspace = "backspace"
+	KeyTab       = "tab"
+	KeyCtrlC     = "ctrl-c"
+	KeyCtrlU     = "ctrl-u"
+)
+
+// ReadKey waits for the next key press.
+func (s *Screen) ReadKey() (Key, error) {
+	for {
+		if len(s.buf) > 0 {
+			key, n := ParseKey(s.buf)
+			s.buf = s.buf[n:]
+			if key != (Key{}) {
+				return key, nil
+			}
+			continue
+		}
+		chunk := make([]byte, 64)
+		n, err := s.in.Read(chunk)
+		if err != nil {
+			return Key{}, err
+		}
+		s.buf = append(s.buf, chunk[:n]...)
+	}
+}
+
+// escapes maps the sequences terminals send for the special keys.
+var escapes = map[string]string{
+	"\x1b[A": KeyUp, "\x1bOA": KeyUp,
+	"\x1b[B": KeyDown, "\x1bOB": KeyDown,
+	"\x1b[5~": KeyPageUp, "\x1b[6~": KeyPageDown,
+	"\x1b[H": KeyHome, "\x1bOH": KeyHome, "\x1b[1~": KeyHome,
+	"\x1b[F": KeyEnd, "\x1bOF": KeyEnd, "\x1b[4~": KeyEnd,
+}
+
+// ParseKey decodes the key at the start of b and how many bytes it used.
+// Sequences it doesn't know are skipped, returning the zero Key.
+func ParseKey(b []byte) (Key, int) {
+	switch b[0] {
+	case '\r', '\n':
+		return Key{Name: KeyEnter}, 1
+	case 0x7f, 0x08:
+		return Key{Name: KeyBackspace}, 1
+	case '\t':
+		return Key{Name: KeyTab}, 1
+	case 0x03:
+		return Key{Name: KeyCtrlC}, 1
+	case 0x15:
+		return Key{Name: KeyCtrlU}, 1
+	case 0x1b:
+		if len(b) == 1 {
+			return Key{Name: KeyEscape}, 1
+		}
+		for seq, name := range escapes {
+			if strings.HasPrefix(string(b), seq) {
+				return Key{Name: name}, len(seq)
+			}
+		}
+		if b[1] != '[' && b[1] != 'O' {
+			return Key{Name: KeyEscape}, 1
+		}
+		// Skip an unknown CSI sequence up to its final byte
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return Key{}, i + 1
+			}
+		}
+		return Key{}, len(b)
+	}
+	if b[0] < ' ' {
+		return Key{}, 1
+	}
+	r, n := utf8.DecodeRune(b)
+	return Key{Rune: r}, n
+}
+
+// Fit cuts s to width columns or pads it with spaces, leaving any escape
+// codes in s alone. Each rune counts as one column.
+func Fit(s string, width int) string {
+	var b strings.Builder
+	cols := 0
+	styled := false
+	for i := 0; i < len(s); {
+		if s[i] == 0x1b {
+			end := strings.IndexByte(s[i:], 'm')
+			if end < 0 {
+				break
+			}
+			b.WriteString(s[i : i+end+1])
+			styled = true
+			i += end + 1
+			continue
+		}
+		r, n := utf8.DecodeRuneInString(s[i:])
+		if cols < width {
+			b.WriteRune(r)
+			cols++
+		}
+		i += n
+	}
+	b.WriteString(strings.Repeat(" ", max(width-cols, 0)))
+	if styled {
+		b.WriteString(reset)
+	}
+	return b.String()
+}
+
+const (
+	reset   = "\x1b[0m"
+	bold    = "\x1b[1m"
+	dim     = "\x1b[2m"
+	reverse = "\x1b[7m"
+)
+
+// Bold, Dim and Reverse style text for Draw.
+func Bold(s string) string    { return bold + s + reset }
+func Dim(s string) string     { return dim + s + reset }
+func Reverse(s string) string { return reverse + s + reset }
@@ -0,0 +1,134 @@
+package tui
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestListFilter(t *testing.T) {
+	l := NewList([]string{"notes", "website", "Dotfiles", "photos"})
+	l.Move(1)
+	if got, _ := l.Selected(); got != "website" {
+		t.Fatalf("selected %q, want website", got)
+	}
+
+	// Typing narrows the list, case-insensitively, keeping the cursor in range
+	for _, r := range "OT" {
+		l.HandleKey(Key{Rune: r}, 10)
+	}
+	if l.Filter() != "OT" || l.Len() != 3 {
+		t.Fatalf("filter %q matches %d, want OT matching 3", l.Filter(), l.Len())
+	}
+	l.Move(5)
+	if got, _ := l.Selected(); got != "photos" {
+		t.Errorf("after moving past the end selected %q, want photos", got)
+	}
+	if i, _ := l.Index(); i != 3 {
+		t.Errorf("Index = %d, want 3", i)
+	}
+
+	l.HandleKey(Key{Rune: 'x'}, 10)
+	if _, ok := l.Selected(); ok || l.Len() != 0 {
+		t.Errorf("nothing should match %q", l.Filter())
+	}
+	l.HandleKey(Key{Name: KeyBackspace}, 10)
+	if l.Filter() != "OT" {
+		t.Errorf("backspace left filter %q", l.Filter())
+	}
+	l.HandleKey(Key{Name: KeyCtrlU}, 10)
+	if l.Len() != 4 {
+		t.Errorf("clearing the filter shows %d items, want 4", l.Len())
+	}
+	if l.HandleKey(Key{Name: KeyBackspace}, 10) {
+		t.Error("backspace with an empty filter should not be used")
+	}
+}
+
+func TestListSetItemsKeepsSelection(t *testing.T) {
+	l := NewList([]string{"a", "b", "c"})
+	l.Move(2)
+	l.SetItems([]string{"c", "d"})
+	if got, _ := l.Selected(); got != "c" {
+		t.Errorf("selected %q, want c", got)
+	}
+	l.SetItems([]string{"x"})
+	if got, _ := l.Selected(); got != "x" {
+		t.Errorf("selected %q after the item went away, want x", got)
+	}
+}
+
+func TestListRenderScrolls(t *testing.T) {
+	l := NewList([]string{"a", "b", "c", "d", "e"})
+	l.HandleKey(Key{Name: KeyEnd}, 3)
+	rows := l.Render(4, 3, true)
+	if len(rows) != 3 {
+		t.Fatalf("got %d rows, want 3", len(rows))
+	}
+	if !strings.Contains(rows[0], " c") || !strings.Contains(rows[2], reverse+" e") {
+		t.Errorf("rows = %q, want c to e with e highlighted", rows)
+	}
+	l.HandleKey(Key{Name: KeyPageUp}, 3)
+	if got, _ := l.Selected(); got != "b" {
+		t.Errorf("page up selected %q, want b", got)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Key
+		n    int
+	}{
+		{"\x1b[A", Key{Name: KeyUp}, 3},
+		{"\x1bOB", Key{Name: KeyDown}, 3},
+		{"\x1b[6~", Key{Name: KeyPageDown}, 4},
+		{"\x1b", Key{Name: KeyEscape}, 1},
+		{"\x1bq", Key{Name: KeyEscape}, 1},
+		{"\x1b[1;5C", Key{}, 6},
+		{"\r", Key{Name: KeyEnter}, 1},
+		{"\x7f", Key{Name: KeyBackspace}, 1},
+		{"\x03", Key{Name: KeyCtrlC}, 1},
+		{"é!", Key{Rune: 'é'}, 2},
+	}
+	for _, tt := range tests {
+		got, n := ParseKey([]byte(tt.in))
+		if got != tt.want || n != tt.n {
+			t.Errorf("ParseKey(%q) = %+v, %d; want %+v, %d", tt.in, got, n, tt.want, tt.n)
+		}
+	}
+}
+
+func TestFit(t *testing.T) {
+	if got := Fit("héllo", 3); got != "hél" {
+		t.Errorf("Fit cut to %q", got)
+	}
+	if got := Fit("ab", 4); got != "ab  " {
+		t.Errorf("Fit padded to %q", got)
+	}
+	if got := Fit(Bold("ab")+"cd", 3); got != bold+"ab"+reset+"c"+reset {
+		t.Errorf("Fit with styles = %q", got)
+	}
+}
+
+func TestSelectNumbered(t *testing.T) {
+	items := []string{"notes", "website"}
+	var out bytes.Buffer
+	i, err := selectNumbered(strings.NewReader("2\n"), &out, "Pick:", items)
+	if err != nil || i != 1 {
+		t.Fatalf("got %d, %v; want 1", i, err)
+	}
+	if !strings.Contains(out.String(), "  2) website\n") {
+		t.Errorf("menu is missing items:\n%s", out.String())
+	}
+
+	if _, err := selectNumbered(strings.NewReader("0\n"), &out, "Pick:", items); !errors.Is(err, ErrCancelled) {
+		t.Errorf("0 should cancel, got %v", err)
+	}
+	for _, in := range []string{"3\n", "x\n", ""} {
+		if _, err := selectNumbered(strings.NewReader(in), &out, "Pick:", items); err == nil || errors.Is(err, ErrCancelled) {
+			t.Errorf("input %q should fail, got %v", in, err)
+		}
+	}
+}
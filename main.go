@@ -1,119 +1,107 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
 	"github.com/chris-roerig/homegit/cmd"
+	"github.com/chris-roerig/homegit/internal/cli"
 	"github.com/chris-roerig/homegit/internal/config"
+	"github.com/chris-roerig/homegit/internal/output"
 )
 
 func main() {
-	if len(os.Args) > 1 && (os.Args[1] == "--version" || os.Args[1] == "-v" || os.Args[1] == "version") {
-		cmd.ShowVersion()
-		os.Exit(0)
+	a := &app{}
+	root := a.commands()
+
+	// The completion scripts call back in here; answer before anything
+	// can print warnings or prompt
+	if len(os.Args) > 1 && os.Args[1] == cli.CompleteCommand {
+		for _, candidate := range root.Completions(os.Args[2:]) {
+			fmt.Println(candidate)
+		}
+		return
+	}
+
+	if err := root.Execute(os.Args[1:]); err != nil {
+		os.Exit(a.fail(err))
+	}
+}
+
+// fail reports err on stderr, as a structured error when the command was
+// asked for JSON or YAML, and returns the exit code for it.
+func (a *app) fail(err error) int {
+	code := cmd.ExitCode(err)
+	var usage *cli.UsageError
+	if errors.As(err, &usage) {
+		code = cmd.ExitUsage
+	}
+
+	if a.format.Structured() {
+		report := struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		report.Error.Code = cmd.ErrorCode(code)
+		report.Error.Message = err.Error()
+		output.Print(os.Stderr, a.format, report, nil)
+		return code
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	if usage != nil && usage.Command != nil {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", usage.Command.Path())
+	}
+	return code
+}
+
+// app is the state commands share: the config, loaded on first use so
+// that --config has been applied and --help works with a broken config.
+type app struct {
+	cfg    *config.Config
+	cfgErr error
+	loaded bool
+
+	nonInteractive bool
+	format         output.Format // from --output, on the commands that have it
+}
+
+// loadConfig returns the config and any error loading it, for commands
+// that report or repair a broken config themselves.
+func (a *app) loadConfig() (*config.Config, error) {
+	if !a.loaded {
+		a.cfg, a.cfgErr = config.Load()
+		a.loaded = true
 	}
+	return a.cfg, a.cfgErr
+}
 
-	cfg, err := config.Load()
+// config returns the config, exiting if it can't be used.
+func (a *app) config() *config.Config {
+	cfg, err := a.loadConfig()
+	if err != nil && a.format.Structured() {
+		os.Exit(a.fail(fmt.Errorf("loading config: %w", err)))
+	}
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "Check it with: homegit config validate\n")
+		os.Exit(cmd.ExitError)
 	}
-
-	if len(os.Args) < 2 {
-		if err := cmd.Help(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-		os.Exit(0)
+	for _, w := range cfg.Warnings() {
+		fmt.Fprintf(os.Stderr, "Warning: config %s\n", w)
 	}
+	return cfg
+}
 
-	command := os.Args[1]
-	switch command {
-	case "help":
-		if err := cmd.Help(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "setup":
-		if err := cmd.Setup(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "init":
-		if err := cmd.Init(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "config":
-		if err := cmd.Config(); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "serve":
-		if err := cmd.Serve(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "list":
-		if err := cmd.List(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "clone":
-		var repoName string
-		if len(os.Args) >= 3 {
-			repoName = os.Args[2]
-		}
-		if err := cmd.Clone(cfg, repoName); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "backup":
-		var repoName string
-		if len(os.Args) >= 3 {
-			repoName = os.Args[2]
-		}
-		if err := cmd.Backup(cfg, repoName); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "remove":
-		var repoName string
-		if len(os.Args) >= 3 {
-			repoName = os.Args[2]
-		}
-		if err := cmd.Remove(cfg, repoName); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "logs":
-		if err := cmd.Logs(cfg, os.Args[2:]); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "start":
-		if err := cmd.Start(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "stop":
-		if err := cmd.Stop(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "restart":
-		if err := cmd.Restart(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	case "status":
-		if err := cmd.Status(cfg); err != nil {
-			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
-			os.Exit(1)
-		}
-	default:
-		fmt.Fprintf(os.Stderr, "Unknown command: %s\n", command)
-		os.Exit(1)
+// quietConfig returns the config for shell completion, which must not
+// print anything but candidates. It is nil if the config can't be loaded.
+func (a *app) quietConfig() *config.Config {
+	cfg, err := a.loadConfig()
+	if err != nil {
+		return nil
 	}
+	return cfg
 }